@@ -0,0 +1,47 @@
+package kv
+
+import (
+	"context"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+var _ updates.ChannelAccessHasher = AccessHasher{}
+
+// AccessHasher is a generic implementation of updates.ChannelAccessHasher
+// over key-value Storage.
+//
+// Access hash is stored as a decimal integer string using
+// <prefix><userID>_<channelID> key.
+type AccessHasher struct {
+	storage Storage
+	prefix  string
+}
+
+// NewAccessHasher creates new AccessHasher.
+func NewAccessHasher(storage Storage) AccessHasher {
+	return AccessHasher{
+		storage: storage,
+		prefix:  "access_hash_",
+	}
+}
+
+// WithPrefix sets key prefix to use. Default is "access_hash_".
+func (h AccessHasher) WithPrefix(prefix string) AccessHasher {
+	h.prefix = prefix
+	return h
+}
+
+func (h AccessHasher) key(userID, channelID int64) string {
+	return h.prefix + formatInt(userID) + "_" + formatInt(channelID)
+}
+
+// SetChannelAccessHash implements updates.ChannelAccessHasher.
+func (h AccessHasher) SetChannelAccessHash(ctx context.Context, userID, channelID, accessHash int64) error {
+	return setInt(ctx, h.storage, h.key(userID, channelID), accessHash)
+}
+
+// GetChannelAccessHash implements updates.ChannelAccessHasher.
+func (h AccessHasher) GetChannelAccessHash(ctx context.Context, userID, channelID int64) (accessHash int64, found bool, err error) {
+	return getInt(ctx, h.storage, h.key(userID, channelID))
+}
@@ -0,0 +1,111 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/contrib/middleware/floodwait"
+)
+
+var _ floodwait.PenaltyStore = FloodPenalties{}
+
+// FloodPenalties is a generic implementation of floodwait.PenaltyStore
+// over key-value Storage.
+//
+// All penalties are stored as a single JSON object mapping penalty key
+// to deadline in Unix nanoseconds. Expired penalties are removed on load.
+type FloodPenalties struct {
+	storage Storage
+	key     string
+	mux     *sync.Mutex
+}
+
+// NewFloodPenalties creates new FloodPenalties.
+func NewFloodPenalties(storage Storage) FloodPenalties {
+	return FloodPenalties{
+		storage: storage,
+		key:     "floodwait_penalties",
+		mux:     new(sync.Mutex),
+	}
+}
+
+// WithKey sets key to use. Default is "floodwait_penalties".
+func (p FloodPenalties) WithKey(key string) FloodPenalties {
+	p.key = key
+	return p
+}
+
+func (p FloodPenalties) get(ctx context.Context) (map[string]int64, error) {
+	r, err := p.storage.Get(ctx, p.key)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return map[string]int64{}, nil
+		}
+		return nil, errors.Wrapf(err, "get %q", p.key)
+	}
+
+	penalties := map[string]int64{}
+	if err := json.Unmarshal([]byte(r), &penalties); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %q", p.key)
+	}
+	return penalties, nil
+}
+
+func (p FloodPenalties) set(ctx context.Context, penalties map[string]int64) error {
+	data, err := json.Marshal(penalties)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+	if err := p.storage.Set(ctx, p.key, string(data)); err != nil {
+		return errors.Wrapf(err, "set %q", p.key)
+	}
+	return nil
+}
+
+// SavePenalty implements floodwait.PenaltyStore.
+func (p FloodPenalties) SavePenalty(ctx context.Context, key string, deadline time.Time) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	penalties, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	penalties[key] = deadline.UnixNano()
+	return p.set(ctx, penalties)
+}
+
+// LoadPenalties implements floodwait.PenaltyStore.
+func (p FloodPenalties) LoadPenalties(ctx context.Context, now time.Time) (map[string]time.Time, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	penalties, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]time.Time, len(penalties))
+	for k, v := range penalties {
+		if deadline := time.Unix(0, v); deadline.After(now) {
+			r[k] = deadline
+		}
+	}
+	if len(r) == len(penalties) {
+		return r, nil
+	}
+
+	// Remove expired penalties.
+	active := make(map[string]int64, len(r))
+	for k, deadline := range r {
+		active[k] = deadline.UnixNano()
+	}
+	if err := p.set(ctx, active); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -14,3 +14,23 @@ type Storage interface {
 
 // ErrKeyNotFound is a special error to return when given key not found.
 var ErrKeyNotFound = errors.New("key not found")
+
+// Lister is an optional interface of Storage that lists stored keys.
+type Lister interface {
+	// Iterate calls f for every key-value pair with given key prefix.
+	//
+	// Iteration stops if f returns error, and this error is returned.
+	Iterate(ctx context.Context, prefix string, f func(k, v string) error) error
+}
+
+// ListStorage is a Storage implementing Lister, required by State.
+type ListStorage interface {
+	Storage
+	Lister
+}
+
+// Deleter is an optional interface of Storage that deletes stored keys.
+type Deleter interface {
+	// Delete deletes given key. Deleting missing key is not an error.
+	Delete(ctx context.Context, k string) error
+}
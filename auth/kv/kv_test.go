@@ -0,0 +1,145 @@
+package kv_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/neo"
+
+	"github.com/gotd/contrib/auth/kv"
+	"github.com/gotd/contrib/middleware/cache/cachetest"
+	"github.com/gotd/contrib/middleware/floodwait/floodwaittest"
+	"github.com/gotd/contrib/storage/storagetest"
+)
+
+type memStorage struct {
+	data map[string]string
+	mux  sync.Mutex
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{data: map[string]string{}}
+}
+
+func (m *memStorage) Set(ctx context.Context, k, v string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.data[k] = v
+	return nil
+}
+
+func (m *memStorage) Get(ctx context.Context, k string) (string, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	v, ok := m.data[k]
+	if !ok {
+		return "", kv.ErrKeyNotFound
+	}
+	return v, nil
+}
+
+func (m *memStorage) Delete(ctx context.Context, k string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	delete(m.data, k)
+	return nil
+}
+
+func (m *memStorage) len() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return len(m.data)
+}
+
+type memLister struct {
+	*memStorage
+}
+
+func (m memLister) Iterate(ctx context.Context, prefix string, f func(k, v string) error) error {
+	m.mux.Lock()
+	values := map[string]string{}
+	for k, v := range m.data {
+		if strings.HasPrefix(k, prefix) {
+			values[k] = v
+		}
+	}
+	m.mux.Unlock()
+
+	for k, v := range values {
+		if err := f(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestKV(t *testing.T) {
+	t.Run("Storage", func(t *testing.T) {
+		storagetest.TestKV(t, newMemStorage())
+	})
+	t.Run("Lister", func(t *testing.T) {
+		storagetest.TestKV(t, memLister{newMemStorage()})
+	})
+}
+
+func TestSession(t *testing.T) {
+	storagetest.TestSessionStorage(t, kv.NewSession(newMemStorage(), "session"))
+}
+
+func TestCredentials(t *testing.T) {
+	storagetest.TestCredentials(t, kv.NewCredentials(newMemStorage()))
+}
+
+func TestState(t *testing.T) {
+	storagetest.TestStateStorage(t, kv.NewState(memLister{newMemStorage()}))
+}
+
+func TestAccessHasher(t *testing.T) {
+	storagetest.TestAccessHasher(t, kv.NewAccessHasher(newMemStorage()))
+}
+
+func TestFloodPenalties(t *testing.T) {
+	floodwaittest.TestPenaltyStore(t, kv.NewFloodPenalties(newMemStorage()))
+}
+
+func TestResponseCache(t *testing.T) {
+	cachetest.TestStore(t, kv.NewResponseCache(newMemStorage()))
+}
+
+func TestResponseCacheExpired(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	n := neo.NewTime(time.Now())
+	s := newMemStorage()
+	c := kv.NewResponseCache(memLister{s}).WithClock(n)
+
+	a.NoError(c.Set(ctx, "1", []byte{1}, time.Second))
+	a.NoError(c.Set(ctx, "2", []byte{2}, time.Second))
+	a.NoError(c.Set(ctx, "3", []byte{3}, time.Hour))
+	n.Travel(time.Minute)
+
+	// Expired response is deleted on access.
+	_, found, err := c.Get(ctx, "1")
+	a.NoError(err)
+	a.False(found)
+	a.Equal(2, s.len())
+
+	a.NoError(c.Sweep(ctx))
+	a.Equal(1, s.len())
+	data, found, err := c.Get(ctx, "3")
+	a.NoError(err)
+	a.True(found)
+	a.Equal([]byte{3}, data)
+
+	// Sweep requires listing.
+	a.Error(kv.NewResponseCache(s).Sweep(ctx))
+}
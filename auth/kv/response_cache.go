@@ -0,0 +1,134 @@
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/td/clock"
+
+	"github.com/gotd/contrib/middleware/cache"
+)
+
+var _ cache.Store = ResponseCache{}
+
+// ResponseCache is a generic implementation of cache.Store over key-value
+// Storage.
+//
+// Every response is stored as <prefix><key> key with 8-byte big-endian
+// deadline in Unix nanoseconds followed by response bytes. Storage has no
+// expiration, so if Storage implements Deleter, expired responses are deleted
+// on Get, and Sweep deletes all expired responses. Otherwise, expired
+// responses are kept until overwritten.
+type ResponseCache struct {
+	storage Storage
+	prefix  string
+	clock   clock.Clock
+}
+
+// NewResponseCache creates new ResponseCache.
+func NewResponseCache(storage Storage) ResponseCache {
+	return ResponseCache{
+		storage: storage,
+		prefix:  "cache_",
+		clock:   clock.System,
+	}
+}
+
+// WithPrefix sets key prefix to use. Default is "cache_".
+func (c ResponseCache) WithPrefix(prefix string) ResponseCache {
+	c.prefix = prefix
+	return c
+}
+
+// WithClock sets clock to use. Default is to use system clock.
+func (c ResponseCache) WithClock(clk clock.Clock) ResponseCache {
+	c.clock = clk
+	return c
+}
+
+// Get implements cache.Store.
+func (c ResponseCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	k := c.prefix + key
+	r, err := c.storage.Get(ctx, k)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, errors.Wrapf(err, "get %q", k)
+	}
+	if len(r) < 8 {
+		return nil, false, errors.Errorf("invalid %q value", k)
+	}
+
+	if c.expired(r) {
+		if err := c.delete(ctx, k); err != nil {
+			return nil, false, err
+		}
+		return nil, false, nil
+	}
+	return []byte(r[8:]), true, nil
+}
+
+// expired reports whether given stored value is expired.
+func (c ResponseCache) expired(v string) bool {
+	deadline := time.Unix(0, int64(binary.BigEndian.Uint64([]byte(v[:8]))))
+	return !c.clock.Now().Before(deadline)
+}
+
+// delete deletes given key if storage implements Deleter.
+func (c ResponseCache) delete(ctx context.Context, k string) error {
+	d, ok := c.storage.(Deleter)
+	if !ok {
+		return nil
+	}
+	if err := d.Delete(ctx, k); err != nil {
+		return errors.Wrapf(err, "delete %q", k)
+	}
+	return nil
+}
+
+// Sweep deletes all expired responses.
+//
+// Storage must implement Lister and Deleter. Call Sweep periodically to keep
+// storage from growing with responses that are never requested again.
+func (c ResponseCache) Sweep(ctx context.Context) error {
+	lister, ok := c.storage.(Lister)
+	if !ok {
+		return errors.New("storage does not implement Lister")
+	}
+	if _, ok := c.storage.(Deleter); !ok {
+		return errors.New("storage does not implement Deleter")
+	}
+
+	var expired []string
+	if err := lister.Iterate(ctx, c.prefix, func(k, v string) error {
+		if len(v) < 8 || c.expired(v) {
+			expired = append(expired, k)
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "iterate")
+	}
+	for _, k := range expired {
+		if err := c.delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set implements cache.Store.
+func (c ResponseCache) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	k := c.prefix + key
+	v := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(v, uint64(c.clock.Now().Add(ttl).UnixNano()))
+	v = append(v, data...)
+
+	if err := c.storage.Set(ctx, k, string(v)); err != nil {
+		return errors.Wrapf(err, "set %q", k)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+var _ updates.StateStorage = State{}
+
+// State is a generic implementation of updates state storage
+// over key-value Storage.
+//
+// Every value is stored as a decimal integer string (strconv.FormatInt), using
+// following keys:
+//
+//	<prefix><userID>_pts, <prefix><userID>_qts,
+//	<prefix><userID>_date, <prefix><userID>_seq  user state fields
+//	<prefix><userID>_channel_<channelID>          channel pts
+//
+// ForEachChannels lists channel keys by prefix, so State keeps no channel
+// index and Storage can be shared by multiple writers.
+//
+// Note that Storage provides no transactions, so SetState and SetDateSeq
+// are not atomic.
+type State struct {
+	storage ListStorage
+	prefix  string
+}
+
+// NewState creates new State.
+func NewState(storage ListStorage) State {
+	return State{
+		storage: storage,
+		prefix:  "state_",
+	}
+}
+
+// WithPrefix sets key prefix to use. Default is "state_".
+func (s State) WithPrefix(prefix string) State {
+	s.prefix = prefix
+	return s
+}
+
+func formatInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func (s State) userKey(userID int64) string {
+	return s.prefix + formatInt(userID) + "_"
+}
+
+func (s State) fieldKey(userID int64, field string) string {
+	return s.userKey(userID) + field
+}
+
+func (s State) channelPrefix(userID int64) string {
+	return s.userKey(userID) + "channel_"
+}
+
+func (s State) channelKey(userID, channelID int64) string {
+	return s.channelPrefix(userID) + formatInt(channelID)
+}
+
+// getInt gets integer value of given key.
+func getInt(ctx context.Context, storage Storage, key string) (v int64, found bool, err error) {
+	r, err := storage.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, errors.Wrapf(err, "get %q", key)
+	}
+
+	v, err = strconv.ParseInt(r, 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "parse %q", key)
+	}
+	return v, true, nil
+}
+
+func setInt(ctx context.Context, storage Storage, key string, v int64) error {
+	if err := storage.Set(ctx, key, formatInt(v)); err != nil {
+		return errors.Wrapf(err, "set %q", key)
+	}
+	return nil
+}
+
+const (
+	fieldPts  = "pts"
+	fieldQts  = "qts"
+	fieldDate = "date"
+	fieldSeq  = "seq"
+)
+
+// GetState implements updates.StateStorage.
+func (s State) GetState(ctx context.Context, userID int64) (state updates.State, found bool, err error) {
+	var fields [4]int
+	for i, field := range []string{fieldPts, fieldQts, fieldDate, fieldSeq} {
+		v, found, err := getInt(ctx, s.storage, s.fieldKey(userID, field))
+		if err != nil || !found {
+			return updates.State{}, false, err
+		}
+		fields[i] = int(v)
+	}
+
+	return updates.State{
+		Pts:  fields[0],
+		Qts:  fields[1],
+		Date: fields[2],
+		Seq:  fields[3],
+	}, true, nil
+}
+
+// SetState implements updates.StateStorage.
+func (s State) SetState(ctx context.Context, userID int64, state updates.State) error {
+	// Pts is written last, because it is used as existence marker.
+	return s.write(ctx, userID,
+		stateField{fieldQts, state.Qts},
+		stateField{fieldDate, state.Date},
+		stateField{fieldSeq, state.Seq},
+		stateField{fieldPts, state.Pts},
+	)
+}
+
+type stateField struct {
+	field string
+	value int
+}
+
+// write sets given state fields.
+func (s State) write(ctx context.Context, userID int64, fields ...stateField) error {
+	for _, f := range fields {
+		if err := setInt(ctx, s.storage, s.fieldKey(userID, f.field), int64(f.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set sets given fields of existing state.
+func (s State) set(ctx context.Context, userID int64, fields ...stateField) error {
+	_, found, err := getInt(ctx, s.storage, s.fieldKey(userID, fieldPts))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("state not found")
+	}
+	return s.write(ctx, userID, fields...)
+}
+
+// SetPts implements updates.StateStorage.
+func (s State) SetPts(ctx context.Context, userID int64, pts int) error {
+	return s.set(ctx, userID, stateField{fieldPts, pts})
+}
+
+// SetQts implements updates.StateStorage.
+func (s State) SetQts(ctx context.Context, userID int64, qts int) error {
+	return s.set(ctx, userID, stateField{fieldQts, qts})
+}
+
+// SetDate implements updates.StateStorage.
+func (s State) SetDate(ctx context.Context, userID int64, date int) error {
+	return s.set(ctx, userID, stateField{fieldDate, date})
+}
+
+// SetSeq implements updates.StateStorage.
+func (s State) SetSeq(ctx context.Context, userID int64, seq int) error {
+	return s.set(ctx, userID, stateField{fieldSeq, seq})
+}
+
+// SetDateSeq implements updates.StateStorage.
+func (s State) SetDateSeq(ctx context.Context, userID int64, date, seq int) error {
+	return s.set(ctx, userID, stateField{fieldDate, date}, stateField{fieldSeq, seq})
+}
+
+// GetChannelPts implements updates.StateStorage.
+func (s State) GetChannelPts(ctx context.Context, userID, channelID int64) (pts int, found bool, err error) {
+	v, found, err := getInt(ctx, s.storage, s.channelKey(userID, channelID))
+	return int(v), found, err
+}
+
+// SetChannelPts implements updates.StateStorage.
+func (s State) SetChannelPts(ctx context.Context, userID, channelID int64, pts int) error {
+	return setInt(ctx, s.storage, s.channelKey(userID, channelID), int64(pts))
+}
+
+// ForEachChannels implements updates.StateStorage.
+func (s State) ForEachChannels(
+	ctx context.Context,
+	userID int64,
+	f func(ctx context.Context, channelID int64, pts int) error,
+) error {
+	prefix := s.channelPrefix(userID)
+	return s.storage.Iterate(ctx, prefix, func(k, v string) error {
+		channelID, err := strconv.ParseInt(strings.TrimPrefix(k, prefix), 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "parse channel id %q", k)
+		}
+		pts, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrapf(err, "parse %q", k)
+		}
+		return f(ctx, channelID, pts)
+	})
+}
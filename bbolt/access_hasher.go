@@ -0,0 +1,64 @@
+package bbolt
+
+import (
+	"context"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+var _ updates.ChannelAccessHasher = (*AccessHasher)(nil)
+
+// AccessHasher is updates.ChannelAccessHasher implementation using bbolt.
+//
+// Access hashes are stored in gotd_updates/<user ID>/channel_access_hashes
+// bucket, keyed by channel ID. IDs are 8-byte big-endian integers.
+type AccessHasher struct {
+	db *bolt.DB
+}
+
+// NewAccessHasher creates new channel access hash storage over bbolt.
+//
+// Caller is responsible for db.Close() invocation.
+func NewAccessHasher(db *bolt.DB) *AccessHasher { return &AccessHasher{db} }
+
+// SetChannelAccessHash implements updates.ChannelAccessHasher.
+func (h *AccessHasher) SetChannelAccessHash(_ context.Context, userID, channelID, accessHash int64) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		user, err := createUserBucket(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		hashes, err := user.CreateBucketIfNotExists(bucketAccessHashes)
+		if err != nil {
+			return err
+		}
+		return hashes.Put(id2b(channelID), i642b(accessHash))
+	})
+}
+
+// GetChannelAccessHash implements updates.ChannelAccessHasher.
+func (h *AccessHasher) GetChannelAccessHash(_ context.Context, userID, channelID int64) (accessHash int64, found bool, err error) {
+	err = h.db.View(func(tx *bolt.Tx) error {
+		user := userBucket(tx, userID)
+		if user == nil {
+			return nil
+		}
+
+		hashes := user.Bucket(bucketAccessHashes)
+		if hashes == nil {
+			return nil
+		}
+
+		v := hashes.Get(id2b(channelID))
+		if v == nil {
+			return nil
+		}
+
+		accessHash, found = b2i64(v), true
+		return nil
+	})
+	return accessHash, found, err
+}
@@ -7,7 +7,8 @@ import (
 	bboltdb "go.etcd.io/bbolt"
 
 	"github.com/gotd/contrib/bbolt"
-	"github.com/gotd/contrib/internal/tests"
+	"github.com/gotd/contrib/middleware/floodwait/floodwaittest"
+	"github.com/gotd/contrib/storage/storagetest"
 )
 
 func TestE2E(t *testing.T) {
@@ -21,7 +22,10 @@ func TestE2E(t *testing.T) {
 	}
 	bucket := []byte("test")
 
-	tests.TestSessionStorage(t, bbolt.NewSessionStorage(db, "testsession", bucket))
-	tests.TestCredentials(t, bbolt.NewCredentials(db, bucket))
-	tests.TestPeerStorage(t, bbolt.NewPeerStorage(db, bucket))
+	storagetest.TestSessionStorage(t, bbolt.NewSessionStorage(db, "testsession", bucket))
+	storagetest.TestCredentials(t, bbolt.NewCredentials(db, bucket))
+	storagetest.TestPeerStorage(t, bbolt.NewPeerStorage(db, bucket))
+	storagetest.TestStateStorage(t, bbolt.NewStateStorage(db))
+	storagetest.TestAccessHasher(t, bbolt.NewAccessHasher(db))
+	floodwaittest.TestPenaltyStore(t, bbolt.NewFloodPenalties(db, bucket))
 }
@@ -0,0 +1,20 @@
+package bbolt
+
+import (
+	"go.etcd.io/bbolt"
+
+	"github.com/gotd/contrib/auth/kv"
+)
+
+// FloodPenalties stores floodwait penalties to bbolt.
+type FloodPenalties struct {
+	kv.FloodPenalties
+}
+
+// NewFloodPenalties creates new FloodPenalties.
+func NewFloodPenalties(db *bbolt.DB, bucket []byte) FloodPenalties {
+	s := bboltStorage{db: db, bucket: bucket}
+	return FloodPenalties{
+		FloodPenalties: kv.NewFloodPenalties(s),
+	}
+}
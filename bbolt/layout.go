@@ -0,0 +1,331 @@
+package bbolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/go-faster/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/gotd/contrib/storage"
+)
+
+// Storage layout.
+//
+// Version 1 (legacy) layout:
+//
+//	<bucket>/<peer key>                          peer record
+//	<bucket>/<associated key>                    peer key
+//	<user ID, 16 bytes>/state/{pts,qts,date,seq}
+//	<user ID, 16 bytes>/channels/<channel ID, 16 bytes>
+//
+// Version 2 layout:
+//
+//	<bucket>/peer_storage/version
+//	<bucket>/peer_storage/peers/<peer key>              peer record
+//	<bucket>/peer_storage/associations/<associated key> peer key
+//	gotd_updates/version
+//	gotd_updates/<user ID>/state/{pts,qts,date,seq}
+//	gotd_updates/<user ID>/channels/<channel ID>
+//	gotd_updates/<user ID>/channel_access_hashes/<channel ID>
+//
+// IDs are 8-byte big-endian integers, values are 8-byte little-endian integers.
+// Top-level bucket of updates state is prefixed to not clash with buckets of
+// application.
+const layoutVersion = 2
+
+var (
+	bucketPeerStorage  = []byte("peer_storage")          // nolint:gochecknoglobals
+	bucketPeers        = []byte("peers")                 // nolint:gochecknoglobals
+	bucketAssociations = []byte("associations")          // nolint:gochecknoglobals
+	bucketUpdates      = []byte("gotd_updates")          // nolint:gochecknoglobals
+	bucketState        = []byte("state")                 // nolint:gochecknoglobals
+	bucketChannels     = []byte("channels")              // nolint:gochecknoglobals
+	bucketAccessHashes = []byte("channel_access_hashes") // nolint:gochecknoglobals
+	keyVersion         = []byte("version")               // nolint:gochecknoglobals
+)
+
+func id2b(v int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+func b2id(b []byte) int64 { return int64(binary.BigEndian.Uint64(b)) }
+
+// migration runs layout migration once.
+//
+// Layout is checked in read-only transaction first, so already migrated
+// databases can be opened read-only. Failed migration is retried on next
+// access.
+type migration struct {
+	mux  sync.Mutex
+	done bool
+}
+
+func (m *migration) run(db *bolt.DB, needed func(tx *bolt.Tx) (bool, error), f func(tx *bolt.Tx) error) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.done {
+		return nil
+	}
+
+	var ok bool
+	if err := db.View(func(tx *bolt.Tx) (err error) {
+		ok, err = needed(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+	if ok {
+		if err := db.Update(f); err != nil {
+			return err
+		}
+	}
+
+	m.done = true
+	return nil
+}
+
+// checkVersion checks layout version of given bucket.
+//
+// Returns true if bucket is already migrated.
+func checkVersion(b *bolt.Bucket) (bool, error) {
+	v := b.Get(keyVersion)
+	if v == nil {
+		return false, nil
+	}
+	if version := b2i(v); version != layoutVersion {
+		return false, errors.Errorf("unsupported layout version %d", version)
+	}
+	return true, nil
+}
+
+// isLegacyPeer reports whether given key-value pair of peer storage bucket is
+// a peer stored using legacy layout.
+func isLegacyPeer(k, v []byte) bool {
+	if v == nil {
+		// Nested bucket.
+		return false
+	}
+	var key storage.PeerKey
+	return key.Parse(k) == nil
+}
+
+// needPeersMigration reports whether peer storage in given bucket should be
+// migrated to the latest layout.
+func needPeersMigration(tx *bolt.Tx, bucket []byte) (bool, error) {
+	root := tx.Bucket(bucket)
+	if root == nil {
+		return false, nil
+	}
+	if ps := root.Bucket(bucketPeerStorage); ps != nil {
+		if ok, err := checkVersion(ps); ok || err != nil {
+			return false, err
+		}
+	}
+
+	var found bool
+	if err := root.ForEach(func(k, v []byte) error {
+		found = found || isLegacyPeer(k, v)
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// migratePeers migrates peer storage in given bucket to the latest layout.
+func migratePeers(tx *bolt.Tx, bucket []byte) error {
+	root, err := tx.CreateBucketIfNotExists(bucket)
+	if err != nil {
+		return errors.Wrap(err, "create bucket")
+	}
+	ps, err := root.CreateBucketIfNotExists(bucketPeerStorage)
+	if err != nil {
+		return errors.Wrap(err, "create peer storage bucket")
+	}
+	if ok, err := checkVersion(ps); ok || err != nil {
+		return err
+	}
+
+	peers, err := ps.CreateBucketIfNotExists(bucketPeers)
+	if err != nil {
+		return errors.Wrap(err, "create peers bucket")
+	}
+	associations, err := ps.CreateBucketIfNotExists(bucketAssociations)
+	if err != nil {
+		return errors.Wrap(err, "create associations bucket")
+	}
+
+	// Legacy layout stores peers and associations along with other keys
+	// of the bucket, like session or credentials. Only associations of
+	// stored peers are moved, other values may look like peer keys too.
+	type pair struct {
+		bucket *bolt.Bucket
+		k, v   []byte
+	}
+	var moved []pair
+	legacy := map[string]struct{}{}
+	if err := root.ForEach(func(k, v []byte) error {
+		if isLegacyPeer(k, v) {
+			moved = append(moved, pair{peers, bytes.Clone(k), bytes.Clone(v)})
+			legacy[string(k)] = struct{}{}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := root.ForEach(func(k, v []byte) error {
+		if _, ok := legacy[string(v)]; ok && v != nil && !isLegacyPeer(k, v) {
+			moved = append(moved, pair{associations, bytes.Clone(k), bytes.Clone(v)})
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, p := range moved {
+		if err := p.bucket.Put(p.k, p.v); err != nil {
+			return errors.Wrap(err, "put")
+		}
+		if err := root.Delete(p.k); err != nil {
+			return errors.Wrap(err, "delete legacy key")
+		}
+	}
+
+	return ps.Put(keyVersion, i2b(layoutVersion))
+}
+
+// isLegacyUserBucket reports whether given top-level bucket is a legacy
+// per-user state bucket.
+func isLegacyUserBucket(name []byte, b *bolt.Bucket) bool {
+	if len(name) != 16 || binary.LittleEndian.Uint64(name[8:]) != 0 {
+		return false
+	}
+	return b.Bucket(bucketState) != nil || b.Bucket(bucketChannels) != nil
+}
+
+// migrateLegacyIDs copies legacy bucket with 16-byte little-endian ID keys to
+// the given bucket with 8-byte big-endian ID keys.
+func migrateLegacyIDs(from, to *bolt.Bucket) error {
+	return from.ForEach(func(k, v []byte) error {
+		if len(k) != 16 || v == nil {
+			return nil
+		}
+		return to.Put(id2b(b2i64(k)), v)
+	})
+}
+
+// migrateLegacyUser copies legacy per-user bucket to the updates bucket.
+func migrateLegacyUser(root, b *bolt.Bucket, userID int64) error {
+	user, err := root.CreateBucketIfNotExists(id2b(userID))
+	if err != nil {
+		return errors.Wrap(err, "create user bucket")
+	}
+
+	if state := b.Bucket(bucketState); state != nil {
+		to, err := user.CreateBucketIfNotExists(bucketState)
+		if err != nil {
+			return errors.Wrap(err, "create state bucket")
+		}
+		if err := state.ForEach(to.Put); err != nil {
+			return errors.Wrap(err, "copy state")
+		}
+	}
+
+	if channels := b.Bucket(bucketChannels); channels != nil {
+		to, err := user.CreateBucketIfNotExists(bucketChannels)
+		if err != nil {
+			return errors.Wrap(err, "create channels bucket")
+		}
+		if err := migrateLegacyIDs(channels, to); err != nil {
+			return errors.Wrap(err, "copy channels")
+		}
+	}
+
+	return nil
+}
+
+// needUpdatesMigration reports whether updates state should be migrated to the
+// latest layout.
+func needUpdatesMigration(tx *bolt.Tx) (bool, error) {
+	if root := tx.Bucket(bucketUpdates); root != nil {
+		if ok, err := checkVersion(root); ok || err != nil {
+			return false, err
+		}
+	}
+
+	var found bool
+	if err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		found = found || isLegacyUserBucket(name, b)
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// migrateUpdates migrates updates state to the latest layout.
+func migrateUpdates(tx *bolt.Tx) error {
+	root, err := tx.CreateBucketIfNotExists(bucketUpdates)
+	if err != nil {
+		return errors.Wrap(err, "create updates bucket")
+	}
+	if ok, err := checkVersion(root); ok || err != nil {
+		return err
+	}
+
+	var legacy [][]byte
+	if err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if isLegacyUserBucket(name, b) {
+			legacy = append(legacy, bytes.Clone(name))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, name := range legacy {
+		if err := migrateLegacyUser(root, tx.Bucket(name), b2i64(name)); err != nil {
+			return errors.Wrapf(err, "migrate user %d", b2i64(name))
+		}
+		if err := tx.DeleteBucket(name); err != nil {
+			return errors.Wrap(err, "delete legacy bucket")
+		}
+	}
+
+	return root.Put(keyVersion, i2b(layoutVersion))
+}
+
+// userBucket returns per-user bucket of updates state.
+//
+// Returns nil if bucket does not exist.
+func userBucket(tx *bolt.Tx, userID int64) *bolt.Bucket {
+	root := tx.Bucket(bucketUpdates)
+	if root == nil {
+		return nil
+	}
+	return root.Bucket(id2b(userID))
+}
+
+// createUserBucket returns per-user bucket of updates state, creating it if necessary.
+func createUserBucket(tx *bolt.Tx, userID int64) (*bolt.Bucket, error) {
+	root := tx.Bucket(bucketUpdates)
+	if root == nil {
+		legacy, err := needUpdatesMigration(tx)
+		if err != nil {
+			return nil, err
+		}
+		if root, err = tx.CreateBucket(bucketUpdates); err != nil {
+			return nil, err
+		}
+		// Otherwise version is set by migration.
+		if !legacy {
+			if err := root.Put(keyVersion, i2b(layoutVersion)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return root.CreateBucketIfNotExists(id2b(userID))
+}
@@ -0,0 +1,218 @@
+package bbolt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"path"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+	bboltdb "go.etcd.io/bbolt"
+
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/storage"
+)
+
+func legacyID(v int64) []byte {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+func TestLayoutMigration(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	db, err := bboltdb.Open(path.Join(t.TempDir(), "bbolt.db"), 0666, &bboltdb.Options{}) // nolint:gocritic
+	a.NoError(err)
+	defer func() { a.NoError(db.Close()) }()
+
+	var (
+		bucket = []byte("test")
+		peer   = storage.Peer{
+			Version: storage.LatestVersion,
+			Key:     dialogs.DialogKey{Kind: dialogs.Chat, ID: 10},
+		}
+		userID    int64 = 1
+		channelID int64 = 2
+	)
+	peerKey := storage.KeyFromPeer(peer).Bytes(nil)
+	peerData, err := json.Marshal(peer)
+	a.NoError(err)
+
+	// Fill database using legacy layout.
+	a.NoError(db.Update(func(tx *bboltdb.Tx) error {
+		b, err := tx.CreateBucket(bucket)
+		a.NoError(err)
+		a.NoError(b.Put([]byte("session"), []byte(`{"Version":1}`)))
+		a.NoError(b.Put(peerKey, peerData))
+		a.NoError(b.Put([]byte("username"), peerKey))
+		// Unrelated value which looks like a key of missing peer.
+		a.NoError(b.Put([]byte("kv"), []byte("peer1_20")))
+
+		user, err := tx.CreateBucket(legacyID(userID))
+		a.NoError(err)
+		state, err := user.CreateBucket(bucketState)
+		a.NoError(err)
+		for k, v := range map[string]int{"pts": 1, "qts": 2, "date": 3, "seq": 4} {
+			a.NoError(state.Put([]byte(k), i2b(v)))
+		}
+		channels, err := user.CreateBucket(bucketChannels)
+		a.NoError(err)
+		a.NoError(channels.Put(legacyID(channelID), i2b(5)))
+		return nil
+	}))
+
+	// Access hashes are never stored using legacy layout.
+	hasher := NewAccessHasher(db)
+	a.NoError(hasher.SetChannelAccessHash(ctx, userID, channelID, 6))
+
+	peers := NewPeerStorage(db, bucket)
+	p, err := peers.Find(ctx, storage.KeyFromPeer(peer))
+	a.NoError(err)
+	a.Equal(peer.Key, p.Key)
+	p, err = peers.Resolve(ctx, "username")
+	a.NoError(err)
+	a.Equal(peer.Key, p.Key)
+
+	iter, err := peers.Iterate(ctx)
+	a.NoError(err)
+	var iterated []dialogs.DialogKey
+	for iter.Next(ctx) {
+		iterated = append(iterated, iter.Value().Key)
+	}
+	a.NoError(iter.Err())
+	a.NoError(iter.Close())
+	a.Equal([]dialogs.DialogKey{peer.Key}, iterated)
+
+	s := NewStateStorage(db)
+	state, found, err := s.GetState(ctx, userID)
+	a.NoError(err)
+	a.True(found)
+	a.Equal(updates.State{Pts: 1, Qts: 2, Date: 3, Seq: 4}, state)
+
+	pts, found, err := s.GetChannelPts(ctx, userID, channelID)
+	a.NoError(err)
+	a.True(found)
+	a.Equal(5, pts)
+
+	hash, found, err := hasher.GetChannelAccessHash(ctx, userID, channelID)
+	a.NoError(err)
+	a.True(found)
+	a.Equal(int64(6), hash)
+
+	// Legacy keys must be removed, unrelated keys must be kept.
+	a.NoError(db.View(func(tx *bboltdb.Tx) error {
+		a.Nil(tx.Bucket(legacyID(userID)))
+
+		b := tx.Bucket(bucket)
+		a.Equal([]byte(`{"Version":1}`), b.Get([]byte("session")))
+		a.Equal([]byte("peer1_20"), b.Get([]byte("kv")))
+		a.Nil(b.Get(peerKey))
+		a.Nil(b.Get([]byte("username")))
+		return nil
+	}))
+
+	// Migration is idempotent.
+	s = NewStateStorage(db)
+	_, found, err = s.GetState(ctx, userID)
+	a.NoError(err)
+	a.True(found)
+}
+
+func TestLayoutReadOnly(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	var (
+		file   = path.Join(t.TempDir(), "bbolt.db")
+		bucket = []byte("test")
+		peer   = storage.Peer{
+			Version: storage.LatestVersion,
+			Key:     dialogs.DialogKey{Kind: dialogs.Chat, ID: 10},
+		}
+		userID int64 = 1
+		state        = updates.State{Pts: 1, Qts: 2, Date: 3, Seq: 4}
+	)
+
+	db, err := bboltdb.Open(file, 0666, &bboltdb.Options{}) // nolint:gocritic
+	a.NoError(err)
+	a.NoError(NewPeerStorage(db, bucket).Assign(ctx, "username", peer))
+	a.NoError(NewStateStorage(db).SetState(ctx, userID, state))
+	a.NoError(db.Close())
+
+	db, err = bboltdb.Open(file, 0666, &bboltdb.Options{ReadOnly: true}) // nolint:gocritic
+	a.NoError(err)
+	defer func() { a.NoError(db.Close()) }()
+
+	p, err := NewPeerStorage(db, bucket).Resolve(ctx, "username")
+	a.NoError(err)
+	a.Equal(peer.Key, p.Key)
+
+	got, found, err := NewStateStorage(db).GetState(ctx, userID)
+	a.NoError(err)
+	a.True(found)
+	a.Equal(state, got)
+
+	_, found, err = NewAccessHasher(db).GetChannelAccessHash(ctx, userID, 2)
+	a.NoError(err)
+	a.False(found)
+}
+
+func TestMigrationRetry(t *testing.T) {
+	a := require.New(t)
+
+	db, err := bboltdb.Open(path.Join(t.TempDir(), "bbolt.db"), 0666, &bboltdb.Options{}) // nolint:gocritic
+	a.NoError(err)
+	defer func() { a.NoError(db.Close()) }()
+
+	var (
+		m     migration
+		calls int
+		fail  = errors.New("fail")
+	)
+	needed := func(tx *bboltdb.Tx) (bool, error) { return true, nil }
+	migrate := func(tx *bboltdb.Tx) error {
+		calls++
+		if calls == 1 {
+			return fail
+		}
+		return nil
+	}
+
+	a.ErrorIs(m.run(db, needed, migrate), fail)
+	a.NoError(m.run(db, needed, migrate))
+	a.NoError(m.run(db, needed, migrate))
+	a.Equal(2, calls)
+}
+
+func TestLayoutVersion(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	db, err := bboltdb.Open(path.Join(t.TempDir(), "bbolt.db"), 0666, &bboltdb.Options{}) // nolint:gocritic
+	a.NoError(err)
+	defer func() { a.NoError(db.Close()) }()
+
+	bucket := []byte("test")
+	var p storage.Peer
+	a.NoError(p.FromInputPeer(&tg.InputPeerUser{UserID: 10, AccessHash: 10}))
+	a.NoError(NewPeerStorage(db, bucket).Add(ctx, p))
+	a.NoError(NewAccessHasher(db).SetChannelAccessHash(ctx, 1, 2, 3))
+
+	// New buckets use the latest layout, so layout check is not a scan.
+	a.NoError(db.View(func(tx *bboltdb.Tx) error {
+		ok, err := checkVersion(tx.Bucket(bucket).Bucket(bucketPeerStorage))
+		a.NoError(err)
+		a.True(ok)
+		ok, err = checkVersion(tx.Bucket(bucketUpdates))
+		a.NoError(err)
+		a.True(ok)
+		return nil
+	}))
+}
@@ -1,7 +1,6 @@
 package bbolt
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 
@@ -13,20 +12,51 @@ import (
 
 var _ storage.PeerStorage = PeerStorage{}
 
-// PeerStorage is a peer storage based on pebble.
+// PeerStorage is a peer storage based on bbolt.
+//
+// Peers and associated keys are stored in separate nested buckets of given
+// bucket, existing databases with legacy layout are migrated on first access.
 type PeerStorage struct {
-	bbolt  *bbolt.DB
-	bucket []byte
+	bbolt   *bbolt.DB
+	bucket  []byte
+	migrate *migration
 }
 
 // NewPeerStorage creates new peer storage using bbolt.
 func NewPeerStorage(db *bbolt.DB, bucket []byte) *PeerStorage {
-	return &PeerStorage{bbolt: db, bucket: bucket}
+	return &PeerStorage{bbolt: db, bucket: bucket, migrate: new(migration)}
+}
+
+func (s PeerStorage) migrateLayout() error {
+	if err := s.migrate.run(s.bbolt, func(tx *bbolt.Tx) (bool, error) {
+		return needPeersMigration(tx, s.bucket)
+	}, func(tx *bbolt.Tx) error {
+		return migratePeers(tx, s.bucket)
+	}); err != nil {
+		return errors.Wrap(err, "migrate")
+	}
+	return nil
+}
+
+// nested returns nested bucket of peer storage.
+//
+// Returns nil if bucket does not exist.
+func (s PeerStorage) nested(tx *bbolt.Tx, name []byte) *bbolt.Bucket {
+	root := tx.Bucket(s.bucket)
+	if root == nil {
+		return nil
+	}
+	ps := root.Bucket(bucketPeerStorage)
+	if ps == nil {
+		return nil
+	}
+	return ps.Bucket(name)
 }
 
 type bboltIterator struct {
 	tx      *bbolt.Tx
 	iter    *bbolt.Cursor
+	started bool
 	lastErr error
 	value   storage.Peer
 }
@@ -35,29 +65,35 @@ func (p *bboltIterator) Close() error {
 	return p.tx.Rollback()
 }
 
+func (p *bboltIterator) next() (k, v []byte) {
+	if !p.started {
+		p.started = true
+		return p.iter.First()
+	}
+	return p.iter.Next()
+}
+
 func (p *bboltIterator) Next(ctx context.Context) bool {
-Next:
-	k, v := p.iter.Next()
-	if v == nil {
+	if p.iter == nil {
 		return false
 	}
 
-	for !bytes.HasPrefix(k, storage.PeerKeyPrefix) {
-		k, v = p.iter.Next()
+	for k, v := p.next(); k != nil; k, v = p.next() {
 		if v == nil {
-			return false
+			continue // nested bucket
 		}
-	}
 
-	if err := json.Unmarshal(v, &p.value); err != nil {
-		if errors.Is(err, storage.ErrPeerUnmarshalMustInvalidate) {
-			goto Next // skip
+		if err := json.Unmarshal(v, &p.value); err != nil {
+			if errors.Is(err, storage.ErrPeerUnmarshalMustInvalidate) {
+				continue // skip
+			}
+			p.lastErr = errors.Wrap(err, "unmarshal")
+			return false
 		}
-		p.lastErr = errors.Wrap(err, "unmarshal")
-		return false
+		return true
 	}
 
-	return true
+	return false
 }
 
 func (p *bboltIterator) Err() error {
@@ -69,32 +105,54 @@ func (p *bboltIterator) Value() storage.Peer {
 }
 
 // Iterate creates and returns new PeerIterator.
+//
+// Iterator holds read-only transaction until closed.
 func (s PeerStorage) Iterate(ctx context.Context) (storage.PeerIterator, error) {
+	if err := s.migrateLayout(); err != nil {
+		return nil, err
+	}
+
 	tx, err := s.bbolt.Begin(false)
 	if err != nil {
 		return nil, errors.Wrap(err, "create tx")
 	}
 
-	bucket := tx.Bucket(s.bucket)
-	if bucket == nil {
-		return nil, errors.Errorf("bucket %q does not exist", s.bucket)
+	iter := &bboltIterator{tx: tx}
+	if peers := s.nested(tx, bucketPeers); peers != nil {
+		iter.iter = peers.Cursor()
 	}
-
-	cur := bucket.Cursor()
-	cur.Seek(storage.PeerKeyPrefix)
-	cur.Prev()
-	return &bboltIterator{
-		tx:   tx,
-		iter: cur,
-	}, nil
+	return iter, nil
 }
 
-func (s PeerStorage) add(associated []string, value storage.Peer) (err error) {
-	err = s.bbolt.Batch(func(tx *bbolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists(s.bucket)
+func (s PeerStorage) add(associated []string, value storage.Peer) error {
+	if err := s.migrateLayout(); err != nil {
+		return err
+	}
+
+	return s.bbolt.Batch(func(tx *bbolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(s.bucket)
 		if err != nil {
 			return errors.Wrap(err, "create bucket")
 		}
+		ps := root.Bucket(bucketPeerStorage)
+		if ps == nil {
+			// Legacy peers are already migrated, so new bucket uses the
+			// latest layout.
+			if ps, err = root.CreateBucket(bucketPeerStorage); err != nil {
+				return errors.Wrap(err, "create peer storage bucket")
+			}
+			if err := ps.Put(keyVersion, i2b(layoutVersion)); err != nil {
+				return errors.Wrap(err, "set version")
+			}
+		}
+		peers, err := ps.CreateBucketIfNotExists(bucketPeers)
+		if err != nil {
+			return errors.Wrap(err, "create peers bucket")
+		}
+		associations, err := ps.CreateBucketIfNotExists(bucketAssociations)
+		if err != nil {
+			return errors.Wrap(err, "create associations bucket")
+		}
 
 		data, err := json.Marshal(value)
 		if err != nil {
@@ -102,19 +160,18 @@ func (s PeerStorage) add(associated []string, value storage.Peer) (err error) {
 		}
 		id := storage.KeyFromPeer(value).Bytes(nil)
 
-		if err := bucket.Put(id, data); err != nil {
+		if err := peers.Put(id, data); err != nil {
 			return errors.Wrap(err, "set id <-> data")
 		}
 
 		for _, key := range associated {
-			if err := bucket.Put([]byte(key), id); err != nil {
+			if err := associations.Put([]byte(key), id); err != nil {
 				return errors.Wrap(err, "set key <-> id")
 			}
 		}
 
 		return nil
 	})
-	return
 }
 
 // Add adds given peer to the storage.
@@ -122,26 +179,34 @@ func (s PeerStorage) Add(ctx context.Context, value storage.Peer) error {
 	return s.add(value.Keys(), value)
 }
 
+func unmarshalPeer(data []byte, p *storage.Peer) error {
+	if err := json.Unmarshal(data, p); err != nil {
+		if errors.Is(err, storage.ErrPeerUnmarshalMustInvalidate) {
+			return storage.ErrPeerNotFound
+		}
+		return errors.Wrap(err, "unmarshal")
+	}
+	return nil
+}
+
 // Find finds peer using given key.
 func (s PeerStorage) Find(ctx context.Context, key storage.PeerKey) (p storage.Peer, rerr error) {
+	if err := s.migrateLayout(); err != nil {
+		return storage.Peer{}, err
+	}
+
 	rerr = s.bbolt.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(s.bucket)
-		if bucket == nil {
-			return errors.Errorf("bucket %q does not exist", s.bucket)
+		peers := s.nested(tx, bucketPeers)
+		if peers == nil {
+			return storage.ErrPeerNotFound
 		}
 
-		data := bucket.Get(key.Bytes(nil))
+		data := peers.Get(key.Bytes(nil))
 		if data == nil {
 			return storage.ErrPeerNotFound
 		}
 
-		if err := json.Unmarshal(data, &p); err != nil {
-			if errors.Is(err, storage.ErrPeerUnmarshalMustInvalidate) {
-				return storage.ErrPeerNotFound
-			}
-			return errors.Wrap(err, "unmarshal")
-		}
-		return nil
+		return unmarshalPeer(data, &p)
 	})
 	return
 }
@@ -153,29 +218,32 @@ func (s PeerStorage) Assign(ctx context.Context, key string, value storage.Peer)
 
 // Resolve finds peer using associated key.
 func (s PeerStorage) Resolve(ctx context.Context, key string) (p storage.Peer, rerr error) {
+	if err := s.migrateLayout(); err != nil {
+		return storage.Peer{}, err
+	}
+
 	rerr = s.bbolt.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(s.bucket)
-		if bucket == nil {
-			return errors.Errorf("bucket %q does not exist", s.bucket)
+		associations := s.nested(tx, bucketAssociations)
+		if associations == nil {
+			return storage.ErrPeerNotFound
 		}
 
-		id := bucket.Get([]byte(key))
+		id := associations.Get([]byte(key))
 		if id == nil {
 			return storage.ErrPeerNotFound
 		}
 
-		data := bucket.Get(id)
-		if data == nil {
+		peers := s.nested(tx, bucketPeers)
+		if peers == nil {
 			return storage.ErrPeerNotFound
 		}
 
-		if err := json.Unmarshal(data, &p); err != nil {
-			if errors.Is(err, storage.ErrPeerUnmarshalMustInvalidate) {
-				return storage.ErrPeerNotFound
-			}
-			return errors.Wrap(err, "unmarshal")
+		data := peers.Get(id)
+		if data == nil {
+			return storage.ErrPeerNotFound
 		}
-		return nil
+
+		return unmarshalPeer(data, &p)
 	})
 	return
 }
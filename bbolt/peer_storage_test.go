@@ -0,0 +1,40 @@
+package bbolt
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	bboltdb "go.etcd.io/bbolt"
+
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram/query/dialogs"
+
+	"github.com/gotd/contrib/storage"
+)
+
+func TestMissingBucket(t *testing.T) {
+	db, err := bboltdb.Open(path.Join(t.TempDir(), "bbolt.db"), 0666, &bboltdb.Options{}) // nolint:gocritic
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	bucket := []byte("missing")
+
+	_, err = NewSessionStorage(db, "session", bucket).LoadSession(ctx)
+	require.ErrorIs(t, err, session.ErrNotFound)
+
+	peers := NewPeerStorage(db, bucket)
+	_, err = peers.Find(ctx, storage.PeerKey{Kind: dialogs.User, ID: 10})
+	require.ErrorIs(t, err, storage.ErrPeerNotFound)
+	_, err = peers.Resolve(ctx, "username")
+	require.ErrorIs(t, err, storage.ErrPeerNotFound)
+
+	if iter, err := peers.Iterate(ctx); err == nil {
+		require.False(t, iter.Next(ctx))
+		require.NoError(t, iter.Close())
+	}
+
+	// Close blocks while read-only transaction is open.
+	require.NoError(t, db.Close())
+}
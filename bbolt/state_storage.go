@@ -15,7 +15,7 @@ func i2b(v int) []byte { b := make([]byte, 8); binary.LittleEndian.PutUint64(b,
 func b2i(b []byte) int { return int(binary.LittleEndian.Uint64(b)) }
 
 func i642b(v int64) []byte {
-	b := make([]byte, 16)
+	b := make([]byte, 8)
 	binary.LittleEndian.PutUint64(b, uint64(v))
 	return b
 }
@@ -25,59 +25,75 @@ func b2i64(b []byte) int64 { return int64(binary.LittleEndian.Uint64(b)) }
 var _ updates.StateStorage = (*State)(nil)
 
 // State is updates.StateStorage implementation using bbolt.
+//
+// Existing databases with legacy layout are migrated on first access.
 type State struct {
-	db *bolt.DB
+	db      *bolt.DB
+	migrate *migration
 }
 
 // NewStateStorage creates new state storage over bbolt.
 //
 // Caller is responsible for db.Close() invocation.
-func NewStateStorage(db *bolt.DB) *State { return &State{db} }
+func NewStateStorage(db *bolt.DB) *State { return &State{db: db, migrate: new(migration)} }
 
-func (s *State) GetState(_ context.Context, userID int64) (state updates.State, found bool, err error) {
-	tx, err := s.db.Begin(false)
-	if err != nil {
-		return updates.State{}, false, err
+func (s *State) view(f func(tx *bolt.Tx) error) error {
+	if err := s.migrate.run(s.db, needUpdatesMigration, migrateUpdates); err != nil {
+		return fmt.Errorf("migrate: %w", err)
 	}
-	defer func() { _ = tx.Rollback() }()
+	return s.db.View(f)
+}
 
-	user := tx.Bucket(i642b(userID))
-	if user == nil {
-		return updates.State{}, false, nil
+func (s *State) update(f func(tx *bolt.Tx) error) error {
+	if err := s.migrate.run(s.db, needUpdatesMigration, migrateUpdates); err != nil {
+		return fmt.Errorf("migrate: %w", err)
 	}
+	return s.db.Update(f)
+}
 
-	stateBucket := user.Bucket([]byte("state"))
-	if stateBucket == nil {
-		return updates.State{}, false, nil
-	}
+func (s *State) GetState(_ context.Context, userID int64) (state updates.State, found bool, err error) {
+	err = s.view(func(tx *bolt.Tx) error {
+		user := userBucket(tx, userID)
+		if user == nil {
+			return nil
+		}
 
-	var (
-		pts  = stateBucket.Get([]byte("pts"))
-		qts  = stateBucket.Get([]byte("qts"))
-		date = stateBucket.Get([]byte("date"))
-		seq  = stateBucket.Get([]byte("seq"))
-	)
+		stateBucket := user.Bucket(bucketState)
+		if stateBucket == nil {
+			return nil
+		}
 
-	if pts == nil || qts == nil || date == nil || seq == nil {
-		return updates.State{}, false, nil
-	}
+		var (
+			pts  = stateBucket.Get([]byte("pts"))
+			qts  = stateBucket.Get([]byte("qts"))
+			date = stateBucket.Get([]byte("date"))
+			seq  = stateBucket.Get([]byte("seq"))
+		)
 
-	return updates.State{
-		Pts:  b2i(pts),
-		Qts:  b2i(qts),
-		Date: b2i(date),
-		Seq:  b2i(seq),
-	}, true, nil
+		if pts == nil || qts == nil || date == nil || seq == nil {
+			return nil
+		}
+
+		state = updates.State{
+			Pts:  b2i(pts),
+			Qts:  b2i(qts),
+			Date: b2i(date),
+			Seq:  b2i(seq),
+		}
+		found = true
+		return nil
+	})
+	return state, found, err
 }
 
 func (s *State) SetState(_ context.Context, userID int64, state updates.State) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		user, err := tx.CreateBucketIfNotExists(i642b(userID))
+	return s.update(func(tx *bolt.Tx) error {
+		user, err := createUserBucket(tx, userID)
 		if err != nil {
 			return err
 		}
 
-		b, err := user.CreateBucketIfNotExists([]byte("state"))
+		b, err := user.CreateBucketIfNotExists(bucketState)
 		if err != nil {
 			return err
 		}
@@ -97,138 +113,99 @@ func (s *State) SetState(_ context.Context, userID int64, state updates.State) e
 	})
 }
 
-func (s *State) SetPts(_ context.Context, userID int64, pts int) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		user, err := tx.CreateBucketIfNotExists(i642b(userID))
-		if err != nil {
-			return err
+// set sets given fields of existing state.
+func (s *State) set(userID int64, fields map[string]int) error {
+	return s.update(func(tx *bolt.Tx) error {
+		user := userBucket(tx, userID)
+		if user == nil {
+			return fmt.Errorf("state not found")
 		}
 
-		state := user.Bucket([]byte("state"))
+		state := user.Bucket(bucketState)
 		if state == nil {
 			return fmt.Errorf("state not found")
 		}
-		return state.Put([]byte("pts"), i2b(pts))
+		for k, v := range fields {
+			if err := state.Put([]byte(k), i2b(v)); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 }
 
-func (s *State) SetQts(_ context.Context, userID int64, qts int) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		user, err := tx.CreateBucketIfNotExists(i642b(userID))
-		if err != nil {
-			return err
-		}
+func (s *State) SetPts(_ context.Context, userID int64, pts int) error {
+	return s.set(userID, map[string]int{"pts": pts})
+}
 
-		state := user.Bucket([]byte("state"))
-		if state == nil {
-			return fmt.Errorf("state not found")
-		}
-		return state.Put([]byte("qts"), i2b(qts))
-	})
+func (s *State) SetQts(_ context.Context, userID int64, qts int) error {
+	return s.set(userID, map[string]int{"qts": qts})
 }
 
 func (s *State) SetDate(_ context.Context, userID int64, date int) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		user, err := tx.CreateBucketIfNotExists(i642b(userID))
-		if err != nil {
-			return err
-		}
-
-		state := user.Bucket([]byte("state"))
-		if state == nil {
-			return fmt.Errorf("state not found")
-		}
-		return state.Put([]byte("date"), i2b(date))
-	})
+	return s.set(userID, map[string]int{"date": date})
 }
 
 func (s *State) SetSeq(_ context.Context, userID int64, seq int) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		user, err := tx.CreateBucketIfNotExists(i642b(userID))
-		if err != nil {
-			return err
-		}
-
-		state := user.Bucket([]byte("state"))
-		if state == nil {
-			return fmt.Errorf("state not found")
-		}
-		return state.Put([]byte("seq"), i2b(seq))
-	})
+	return s.set(userID, map[string]int{"seq": seq})
 }
 
 func (s *State) SetDateSeq(_ context.Context, userID int64, date, seq int) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		user, err := tx.CreateBucketIfNotExists(i642b(userID))
-		if err != nil {
-			return err
-		}
-
-		state := user.Bucket([]byte("state"))
-		if state == nil {
-			return fmt.Errorf("state not found")
-		}
-		if err := state.Put([]byte("date"), i2b(date)); err != nil {
-			return err
-		}
-		return state.Put([]byte("seq"), i2b(seq))
-	})
+	return s.set(userID, map[string]int{"date": date, "seq": seq})
 }
 
 func (s *State) GetChannelPts(_ context.Context, userID, channelID int64) (pts int, found bool, err error) {
-	tx, err := s.db.Begin(false)
-	if err != nil {
-		return 0, false, err
-	}
-	defer func() { _ = tx.Rollback() }()
-
-	user := tx.Bucket(i642b(userID))
-	if user == nil {
-		return 0, false, nil
-	}
+	err = s.view(func(tx *bolt.Tx) error {
+		user := userBucket(tx, userID)
+		if user == nil {
+			return nil
+		}
 
-	channels := user.Bucket([]byte("channels"))
-	if channels == nil {
-		return 0, false, nil
-	}
+		channels := user.Bucket(bucketChannels)
+		if channels == nil {
+			return nil
+		}
 
-	p := channels.Get(i642b(channelID))
-	if p == nil {
-		return 0, false, nil
-	}
+		p := channels.Get(id2b(channelID))
+		if p == nil {
+			return nil
+		}
 
-	return b2i(p), true, nil
+		pts, found = b2i(p), true
+		return nil
+	})
+	return pts, found, err
 }
 
 func (s *State) SetChannelPts(_ context.Context, userID, channelID int64, pts int) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		user, err := tx.CreateBucketIfNotExists(i642b(userID))
+	return s.update(func(tx *bolt.Tx) error {
+		user, err := createUserBucket(tx, userID)
 		if err != nil {
 			return err
 		}
 
-		channels, err := user.CreateBucketIfNotExists([]byte("channels"))
+		channels, err := user.CreateBucketIfNotExists(bucketChannels)
 		if err != nil {
 			return err
 		}
-		return channels.Put(i642b(channelID), i2b(pts))
+		return channels.Put(id2b(channelID), i2b(pts))
 	})
 }
 
 func (s *State) ForEachChannels(ctx context.Context, userID int64, f func(ctx context.Context, channelID int64, pts int) error) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		user, err := tx.CreateBucketIfNotExists(i642b(userID))
-		if err != nil {
-			return err
+	return s.view(func(tx *bolt.Tx) error {
+		user := userBucket(tx, userID)
+		if user == nil {
+			return nil
 		}
 
-		channels, err := user.CreateBucketIfNotExists([]byte("channels"))
-		if err != nil {
-			return err
+		channels := user.Bucket(bucketChannels)
+		if channels == nil {
+			return nil
 		}
 
 		return channels.ForEach(func(k, v []byte) error {
-			return f(ctx, b2i64(k), b2i(v))
+			return f(ctx, b2id(k), b2i(v))
 		})
 	})
 }
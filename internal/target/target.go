@@ -0,0 +1,91 @@
+// Package target extracts target peer of Telegram API requests.
+package target
+
+import (
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// Kind is a kind of peer.
+type Kind uint8
+
+// Peer kinds.
+const (
+	None Kind = iota
+	Self
+	User
+	Chat
+	Channel
+)
+
+// String returns name of kind, like "user", or empty string for None.
+func (k Kind) String() string {
+	switch k {
+	case Self:
+		return "self"
+	case User:
+		return "user"
+	case Chat:
+		return "chat"
+	case Channel:
+		return "channel"
+	default:
+		return ""
+	}
+}
+
+// Peer identifies target peer of request.
+type Peer struct {
+	Kind Kind
+	ID   int64
+}
+
+// FromInputPeer returns peer of given input peer.
+func FromInputPeer(peer tg.InputPeerClass) Peer {
+	switch v := peer.(type) {
+	case *tg.InputPeerSelf:
+		return Peer{Kind: Self}
+	case *tg.InputPeerUser:
+		return Peer{Kind: User, ID: v.UserID}
+	case *tg.InputPeerUserFromMessage:
+		return Peer{Kind: User, ID: v.UserID}
+	case *tg.InputPeerChat:
+		return Peer{Kind: Chat, ID: v.ChatID}
+	case *tg.InputPeerChannel:
+		return Peer{Kind: Channel, ID: v.ChannelID}
+	case *tg.InputPeerChannelFromMessage:
+		return Peer{Kind: Channel, ID: v.ChannelID}
+	default:
+		return Peer{}
+	}
+}
+
+// FromInputChannel returns peer of given input channel.
+func FromInputChannel(channel tg.InputChannelClass) Peer {
+	switch v := channel.(type) {
+	case *tg.InputChannel:
+		return Peer{Kind: Channel, ID: v.ChannelID}
+	case *tg.InputChannelFromMessage:
+		return Peer{Kind: Channel, ID: v.ChannelID}
+	default:
+		return Peer{}
+	}
+}
+
+// FromRequest extracts target peer of request from its peer, to_peer or
+// channel field, like of messages.sendMessage, messages.forwardMessages or
+// channels.editTitle.
+//
+// Returns zero Peer if request has no target peer.
+func FromRequest(input bin.Encoder) Peer {
+	switch v := input.(type) {
+	case interface{ GetPeer() tg.InputPeerClass }:
+		return FromInputPeer(v.GetPeer())
+	case interface{ GetToPeer() tg.InputPeerClass }:
+		return FromInputPeer(v.GetToPeer())
+	case interface{ GetChannel() tg.InputChannelClass }:
+		return FromInputChannel(v.GetChannel())
+	default:
+		return Peer{}
+	}
+}
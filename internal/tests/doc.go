@@ -1,2 +1,2 @@
-// Package tests contains common storage tests and some test utilities.
+// Package tests contains some test utilities.
 package tests
@@ -0,0 +1,26 @@
+// Package tracehook reports time spent inside middlewares, like waiting for
+// rate limits, to tracing set up by outer middleware.
+package tracehook
+
+import (
+	"context"
+	"time"
+)
+
+// Func records span of given name, started and ended at given time, as
+// child of span of ctx.
+type Func func(ctx context.Context, name string, start, end time.Time)
+
+type hookKey struct{}
+
+// With returns context with given hook.
+func With(ctx context.Context, f Func) context.Context {
+	return context.WithValue(ctx, hookKey{}, f)
+}
+
+// Span reports span of given name to hook of ctx, if any.
+func Span(ctx context.Context, name string, start, end time.Time) {
+	if f, ok := ctx.Value(hookKey{}).(Func); ok {
+		f(ctx, name, start, end)
+	}
+}
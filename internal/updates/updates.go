@@ -0,0 +1,33 @@
+// Package updates inspects batches of Telegram updates.
+package updates
+
+import "github.com/gotd/td/tg"
+
+// Names returns TypeNames of updates of batch, like "updateNewMessage".
+//
+// Short updates, like updateShortMessage, and updatesTooLong are returned
+// as is.
+func Names(u tg.UpdatesClass) []string {
+	var list []tg.UpdateClass
+	switch v := u.(type) {
+	case *tg.Updates:
+		list = v.Updates
+	case *tg.UpdatesCombined:
+		list = v.Updates
+	case *tg.UpdateShort:
+		list = []tg.UpdateClass{v.Update}
+	case nil:
+		return nil
+	default:
+		return []string{u.TypeName()}
+	}
+
+	names := make([]string, 0, len(list))
+	for _, update := range list {
+		if update == nil {
+			continue
+		}
+		names = append(names, update.TypeName())
+	}
+	return names
+}
@@ -0,0 +1,25 @@
+package updates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestNames(t *testing.T) {
+	a := require.New(t)
+	a.Equal([]string{"updateNewMessage", "updateDeleteMessages"}, Names(&tg.Updates{
+		Updates: []tg.UpdateClass{
+			&tg.UpdateNewMessage{Message: &tg.MessageEmpty{}},
+			&tg.UpdateDeleteMessages{},
+		},
+	}))
+	a.Equal([]string{"updateUserTyping"}, Names(&tg.UpdateShort{
+		Update: &tg.UpdateUserTyping{},
+	}))
+	a.Equal([]string{"updateShortMessage"}, Names(&tg.UpdateShortMessage{}))
+	a.Equal([]string{"updatesTooLong"}, Names(&tg.UpdatesTooLong{}))
+	a.Nil(Names(nil))
+}
@@ -5,24 +5,43 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/multierr"
+	"go.uber.org/zap"
 
 	"github.com/gotd/td/bin"
 	"github.com/gotd/td/tdp"
 	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
 )
 
 // Debug is pretty-print debugging invoker middleware.
+//
+// Sensitive fields of requests and results are masked by Redact, see
+// WithRedact.
 type Debug struct {
-	next tg.Invoker
-	out  io.Writer
+	next   tg.Invoker
+	out    io.Writer
+	log    *zap.Logger
+	body   bool
+	filter func(method string) bool
+	sample int
+	redact func(v bin.Object)
+
+	mux   sync.Mutex
+	calls map[string]int
 }
 
 // NewDebug creates new Debug middleware.
 func NewDebug(next tg.Invoker) *Debug {
-	return &Debug{next: next}
+	return &Debug{
+		next:   next,
+		redact: Redact,
+		calls:  map[string]int{},
+	}
 }
 
 // WithOutput sets output writer.
@@ -31,37 +50,224 @@ func (d *Debug) WithOutput(out io.Writer) *Debug {
 	return d
 }
 
-func formatObject(input interface{}) string {
-	o, ok := input.(tdp.Object)
+// WithLog sets logger to log calls as structured entries with method,
+// duration and error, instead of printing them to output writer.
+//
+// Calls are logged at debug level, failed calls at warn level.
+func (d *Debug) WithLog(log *zap.Logger) *Debug {
+	d.log = log
+	return d
+}
+
+// WithBody sets whether to log JSON-encoded requests and results along with
+// structured entries. Default is false.
+func (d *Debug) WithBody(enabled bool) *Debug {
+	d.body = enabled
+	return d
+}
+
+// WithFilter sets function reporting whether to log calls of given method,
+// e.g. "messages.sendMessage". Default is to log calls of all methods.
+func (d *Debug) WithFilter(f func(method string) bool) *Debug {
+	d.filter = f
+	return d
+}
+
+// WithSampling sets to log only every n-th call of each method. Failed
+// calls are logged regardless of sampling.
+func (d *Debug) WithSampling(n int) *Debug {
+	d.sample = n
+	return d
+}
+
+// WithRedact sets function to mask sensitive fields of requests and results.
+// Function is called with decoded copy of value, so it can modify it.
+// Default is Redact, nil disables redaction.
+func (d *Debug) WithRedact(f func(v bin.Object)) *Debug {
+	d.redact = f
+	return d
+}
+
+// sampled reports whether call of method should be logged.
+func (d *Debug) sampled(method string) bool {
+	if d.sample <= 1 {
+		return true
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	n := d.calls[method]
+	d.calls[method] = (n + 1) % d.sample
+	return n == 0
+}
+
+// object returns value to log, redacted if necessary.
+//
+// Values which can't be redacted are returned as is, unless they are of
+// auth.* or account.* types.
+func (d *Debug) object(v interface{}) (interface{}, bool) {
+	if d.redact == nil {
+		return unbox(v), true
+	}
+	if o, ok := d.redactCopy(v); ok {
+		return o, true
+	}
+	if sensitiveType(v) {
+		return nil, false
+	}
+	return unbox(v), true
+}
+
+// sensitiveType reports whether v is of auth.* or account.* type.
+func sensitiveType(v interface{}) bool {
+	t, ok := unbox(v).(interface{ TypeName() string })
 	if !ok {
-		// Handle tg.*Box values.
-		rv := reflect.Indirect(reflect.ValueOf(input))
-		for i := 0; i < rv.NumField(); i++ {
-			if v, ok := rv.Field(i).Interface().(tdp.Object); ok {
-				return formatObject(v)
-			}
+		return false
+	}
+	name := t.TypeName()
+	return strings.HasPrefix(name, "auth.") || strings.HasPrefix(name, "account.")
+}
+
+// redactCopy returns redacted copy of v.
+func (d *Debug) redactCopy(v interface{}) (interface{}, bool) {
+	e, ok := v.(bin.Encoder)
+	if !ok {
+		return nil, false
+	}
+
+	// Decode copy into value of the same type, so values of any type, like
+	// vectors or boxes, can be redacted.
+	t := reflect.TypeOf(v)
+	if t.Kind() != reflect.Pointer {
+		return nil, false
+	}
+	o, ok := reflect.New(t.Elem()).Interface().(bin.Object)
+	if !ok {
+		return nil, false
+	}
+
+	var b bin.Buffer
+	if err := e.Encode(&b); err != nil {
+		return nil, false
+	}
+	if err := o.Decode(&b); err != nil {
+		return nil, false
+	}
+	d.redact(o)
+	return unbox(o), true
+}
+
+// unbox returns value of tg.*Box, like tg.AuthSentCodeBox, or v itself.
+func unbox(v interface{}) interface{} {
+	if _, ok := v.(tdp.Object); ok {
+		return v
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return v
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		if o, ok := rv.Field(i).Interface().(tdp.Object); ok {
+			return o
 		}
+	}
+	return v
+}
 
+func formatObject(input interface{}) string {
+	o, ok := unbox(input).(tdp.Object)
+	if !ok {
 		return fmt.Sprintf("%T (not object)", input)
 	}
 	return tdp.Format(o)
 }
 
+// format returns pretty-printed value.
+func (d *Debug) format(v interface{}) string {
+	o, ok := d.object(v)
+	if !ok {
+		return fmt.Sprintf("%T (not redacted)", v)
+	}
+	return formatObject(o)
+}
+
 // Invoke implements tg.Invoker.
 func (d *Debug) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
-	_, rerr := fmt.Fprintln(d.out, "→", formatObject(input))
+	var method string
+	if t, ok := input.(interface{ TypeName() string }); ok {
+		method = t.TypeName()
+	}
+	if d.filter != nil && !d.filter(method) {
+		return d.next.Invoke(ctx, input, output)
+	}
+
+	sampled := d.sampled(method)
+	if d.log != nil {
+		return d.invokeLog(ctx, method, sampled, input, output)
+	}
+	return d.invokePrint(ctx, sampled, input, output)
+}
+
+func (d *Debug) invokePrint(ctx context.Context, sampled bool, input bin.Encoder, output bin.Decoder) (rerr error) {
+	if sampled {
+		_, rerr = fmt.Fprintln(d.out, "→", d.format(input))
+	}
 
 	start := time.Now()
 	if err := d.next.Invoke(ctx, input, output); err != nil {
+		if !sampled {
+			_, werr := fmt.Fprintln(d.out, "→", d.format(input))
+			rerr = multierr.Append(rerr, werr)
+		}
 		rerr = multierr.Append(rerr, err)
 		_, err := fmt.Fprintln(d.out, "←", err)
 		return multierr.Append(rerr, err)
 	}
+	if !sampled {
+		return nil
+	}
 
 	_, err := fmt.Fprintf(d.out,
 		"← (%s) %s\n",
 		time.Since(start).Round(time.Millisecond),
-		formatObject(output),
+		d.format(output),
 	)
 	return multierr.Append(rerr, err)
 }
+
+func (d *Debug) invokeLog(ctx context.Context, method string, sampled bool, input bin.Encoder, output bin.Decoder) error {
+	start := time.Now()
+	err := d.next.Invoke(ctx, input, output)
+	if err == nil && !sampled {
+		return nil
+	}
+
+	fields := []zap.Field{
+		zap.String("method", method),
+		zap.Duration("duration", time.Since(start)),
+	}
+	if d.body {
+		if o, ok := d.object(input); ok {
+			fields = append(fields, zap.Reflect("request", o))
+		}
+		if err == nil {
+			if o, ok := d.object(output); ok {
+				fields = append(fields, zap.Reflect("result", o))
+			}
+		}
+	}
+	if err != nil {
+		if rpcErr, ok := tgerr.As(err); ok {
+			fields = append(fields,
+				zap.Int("error_code", rpcErr.Code),
+				zap.String("error_type", rpcErr.Type),
+			)
+		}
+		d.log.Warn("Invoke failed", append(fields, zap.Error(err))...)
+		return err
+	}
+
+	d.log.Debug("Invoke", fields...)
+	return nil
+}
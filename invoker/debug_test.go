@@ -0,0 +1,213 @@
+package invoker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+func sentCode(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	switch input.(type) {
+	case *tg.AuthSendCodeRequest:
+		var b bin.Buffer
+		if err := (&tg.AuthSentCode{
+			Type:          &tg.AuthSentCodeTypeApp{Length: 5},
+			PhoneCodeHash: "secret-hash",
+		}).Encode(&b); err != nil {
+			return err
+		}
+		return output.Decode(&b)
+	default:
+		return tgerr.New(400, "PHONE_CODE_INVALID")
+	}
+}
+
+func TestDebug(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	raw := tg.NewClient(NewDebug(telegram.InvokeFunc(sentCode)).WithOutput(&out))
+
+	_, err := raw.AuthSendCode(ctx, &tg.AuthSendCodeRequest{PhoneNumber: "+79001234567"})
+	a.NoError(err)
+	_, err = raw.AuthSignIn(ctx, &tg.AuthSignInRequest{PhoneNumber: "+79001234567", PhoneCode: "12345"})
+	a.True(tgerr.Is(err, "PHONE_CODE_INVALID"))
+
+	s := out.String()
+	a.Contains(s, "auth.sendCode")
+	a.Contains(s, "auth.sentCode")
+	a.Contains(s, "PHONE_CODE_INVALID")
+	a.Contains(s, redacted)
+	a.NotContains(s, "+79001234567")
+	a.NotContains(s, "12345")
+	a.NotContains(s, "secret-hash")
+}
+
+func TestDebugLog(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	raw := tg.NewClient(NewDebug(telegram.InvokeFunc(sentCode)).
+		WithLog(zap.New(core)).
+		WithBody(true).
+		WithSampling(2).
+		WithFilter(func(method string) bool {
+			return method != "auth.logOut"
+		}),
+	)
+
+	for i := 0; i < 3; i++ {
+		_, err := raw.AuthSendCode(ctx, &tg.AuthSendCodeRequest{PhoneNumber: "+79001234567"})
+		a.NoError(err)
+	}
+	// Failed calls are not sampled.
+	for i := 0; i < 2; i++ {
+		_, err := raw.AuthSignIn(ctx, &tg.AuthSignInRequest{PhoneNumber: "+79001234567"})
+		a.Error(err)
+	}
+	_, err := raw.AuthLogOut(ctx)
+	a.Error(err)
+
+	entries := logs.All()
+	a.Len(entries, 4)
+	for _, e := range entries[:2] {
+		a.Equal(zapcore.DebugLevel, e.Level)
+		fields := e.ContextMap()
+		a.Equal("auth.sendCode", fields["method"])
+		a.Equal(redacted, fields["request"].(*tg.AuthSendCodeRequest).PhoneNumber)
+		a.Equal(redacted, fields["result"].(*tg.AuthSentCode).PhoneCodeHash)
+	}
+	for _, e := range entries[2:] {
+		a.Equal(zapcore.WarnLevel, e.Level)
+		fields := e.ContextMap()
+		a.Equal("auth.signIn", fields["method"])
+		a.Equal("PHONE_CODE_INVALID", fields["error_type"])
+		a.EqualValues(400, fields["error_code"])
+	}
+}
+
+func TestRedact(t *testing.T) {
+	a := require.New(t)
+
+	req := &tg.AccountUpdatePasswordSettingsRequest{
+		Password: &tg.InputCheckPasswordSRP{
+			SRPID: 1,
+			A:     []byte{1, 2, 3},
+			M1:    []byte{4, 5, 6},
+		},
+		NewSettings: tg.AccountPasswordInputSettings{
+			NewPasswordHash: []byte{7, 8, 9},
+			Hint:            "hint",
+			Email:           "user@example.com",
+		},
+	}
+	Redact(req)
+
+	srp := req.Password.(*tg.InputCheckPasswordSRP)
+	a.Equal(int64(1), srp.SRPID)
+	a.Equal([]byte(redacted), srp.A)
+	a.Equal([]byte(redacted), srp.M1)
+	a.Equal([]byte(redacted), req.NewSettings.NewPasswordHash)
+	a.Equal(redacted, req.NewSettings.Email)
+	a.Equal("hint", req.NewSettings.Hint)
+
+	// Other types are not affected.
+	u := &tg.User{Phone: "79001234567"}
+	Redact(u)
+	a.Equal("79001234567", u.Phone)
+}
+
+func TestRedactSignIn(t *testing.T) {
+	a := require.New(t)
+
+	result := &tg.AuthAuthorizationBox{Authorization: &tg.AuthAuthorization{
+		FutureAuthToken: []byte{1, 2, 3},
+		User: &tg.User{
+			ID:        1,
+			FirstName: "John",
+			Phone:     "79001234567",
+		},
+	}}
+	Redact(result)
+
+	auth := result.Authorization.(*tg.AuthAuthorization)
+	a.Equal([]byte(redacted), auth.FutureAuthToken)
+	u := auth.User.(*tg.User)
+	a.Equal(redacted, u.Phone)
+	a.Equal("John", u.FirstName)
+	a.Equal(int64(1), u.ID)
+}
+
+func TestDebugVector(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	contactIDs := telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		var b bin.Buffer
+		if err := (&tg.IntVector{Elems: []int{10, 20}}).Encode(&b); err != nil {
+			return err
+		}
+		return output.Decode(&b)
+	})
+
+	var out bytes.Buffer
+	_, err := tg.NewClient(NewDebug(contactIDs).WithOutput(&out)).ContactsGetContactIDs(ctx, 0)
+	a.NoError(err)
+	a.NotContains(out.String(), "not redacted")
+	a.Contains(out.String(), "20")
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	_, err = tg.NewClient(NewDebug(contactIDs).WithLog(zap.New(core)).WithBody(true)).ContactsGetContactIDs(ctx, 0)
+	a.NoError(err)
+	entries := logs.All()
+	a.Len(entries, 1)
+	a.Equal([]int{10, 20}, entries[0].ContextMap()["result"].(*tg.IntVector).Elems)
+}
+
+// undecodable is request which can't be decoded, so can't be redacted.
+type undecodable struct {
+	tg.HelpGetNearestDCRequest
+}
+
+func (*undecodable) Decode(*bin.Buffer) error { return errors.New("not implemented") }
+
+// undecodableAuth is auth.* request which can't be redacted.
+type undecodableAuth struct {
+	tg.AuthSendCodeRequest
+}
+
+func (*undecodableAuth) Decode(*bin.Buffer) error { return errors.New("not implemented") }
+
+func TestDebugUndecodable(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	d := NewDebug(telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		return nil
+	})).WithOutput(&out)
+
+	a.NoError(d.Invoke(ctx, &undecodable{}, nil))
+	a.Contains(out.String(), "help.getNearestDc")
+	a.NotContains(out.String(), "not redacted")
+
+	out.Reset()
+	a.NoError(d.Invoke(ctx, &undecodableAuth{
+		AuthSendCodeRequest: tg.AuthSendCodeRequest{PhoneNumber: "+79001234567"},
+	}, nil))
+	a.Contains(out.String(), "not redacted")
+	a.NotContains(out.String(), "+79001234567")
+}
@@ -0,0 +1,22 @@
+// Package mock implements a scriptable fake tg.Invoker for unit tests.
+//
+// Expected requests are declared per method, optionally filtered by
+// matchers on decoded request fields, with a result or an error to respond
+// per call:
+//
+//	m := mock.New()
+//	m.Expect("messages.sendMessage").
+//		Match(mock.Peer(&tg.InputPeerUser{UserID: 10})).
+//		Respond(&tg.Updates{})
+//	m.Expect("upload.getFile").
+//		Times(3).
+//		Respond(&tg.UploadFile{Type: &tg.StorageFilePartial{}}).
+//		FailOn(3, tgerr.New(420, "FLOOD_WAIT_5"))
+//
+//	// Run code under test with tg.NewClient(m).
+//
+//	require.NoError(t, m.Verify())
+//
+// Requests and results pass through their TL encoding, like with real
+// Telegram, so code under test gets its own copies of results.
+package mock
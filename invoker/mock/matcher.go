@@ -0,0 +1,59 @@
+package mock
+
+import (
+	"bytes"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/internal/target"
+)
+
+// Matcher reports whether decoded request matches expectation.
+type Matcher func(req bin.Object) bool
+
+// Request returns Matcher of requests of type T satisfying f, e.g.:
+//
+//	mock.Request(func(req *tg.MessagesSendMessageRequest) bool {
+//		return req.Message == "hello"
+//	})
+func Request[T bin.Object](f func(req T) bool) Matcher {
+	return func(req bin.Object) bool {
+		v, ok := req.(T)
+		return ok && f(v)
+	}
+}
+
+// Equal returns Matcher of requests identical to expected one.
+func Equal(expected bin.Encoder) Matcher {
+	var b bin.Buffer
+	if err := expected.Encode(&b); err != nil {
+		// Invalid request matches nothing.
+		return func(req bin.Object) bool { return false }
+	}
+	return func(req bin.Object) bool {
+		var got bin.Buffer
+		if err := req.Encode(&got); err != nil {
+			return false
+		}
+		return bytes.Equal(b.Buf, got.Buf)
+	}
+}
+
+// Peer returns Matcher of requests to given peer by its peer, to_peer or
+// channel field, like messages.sendMessage, messages.forwardMessages or
+// channels.editTitle.
+func Peer(peer tg.InputPeerClass) Matcher {
+	expected := target.FromInputPeer(peer)
+	return func(req bin.Object) bool {
+		return target.FromRequest(req) == expected
+	}
+}
+
+// Channel returns Matcher of requests to given channel, like Peer.
+func Channel(channel tg.InputChannelClass) Matcher {
+	expected := target.FromInputChannel(channel)
+	return func(req bin.Object) bool {
+		return target.FromRequest(req) == expected
+	}
+}
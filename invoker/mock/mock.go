@@ -0,0 +1,247 @@
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// ErrUnexpected is returned by Mock if request does not match any
+// expectation.
+var ErrUnexpected = errors.New("unexpected request")
+
+// response is a response to request.
+type response struct {
+	result bin.Encoder
+	err    error
+	do     func(req bin.Object) (bin.Encoder, error)
+}
+
+func (r response) get(req bin.Object) (bin.Encoder, error) {
+	if r.do != nil {
+		return r.do(req)
+	}
+	return r.result, r.err
+}
+
+// Expectation is an expected request.
+//
+// Expectation should be configured before requests are sent.
+type Expectation struct {
+	method   string
+	matchers []Matcher
+	times    int
+	anyTimes bool
+	calls    int
+
+	response *response
+	on       map[int]response
+}
+
+// Match adds matchers of request. Request matches expectation if it matches
+// all matchers.
+func (e *Expectation) Match(matchers ...Matcher) *Expectation {
+	e.matchers = append(e.matchers, matchers...)
+	return e
+}
+
+// Times sets number of expected calls. Default is 1.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	e.anyTimes = false
+	return e
+}
+
+// AnyTimes allows any number of calls, including none.
+func (e *Expectation) AnyTimes() *Expectation {
+	e.anyTimes = true
+	return e
+}
+
+// Respond sets result of calls.
+func (e *Expectation) Respond(result bin.Encoder) *Expectation {
+	e.response = &response{result: result}
+	return e
+}
+
+// Fail sets error of calls, e.g. tgerr.New(400, "PEER_ID_INVALID").
+func (e *Expectation) Fail(err error) *Expectation {
+	e.response = &response{err: err}
+	return e
+}
+
+// Do sets function returning result or error of calls.
+func (e *Expectation) Do(f func(req bin.Object) (bin.Encoder, error)) *Expectation {
+	e.response = &response{do: f}
+	return e
+}
+
+// RespondOn sets result of n-th call, starting from 1, overriding Respond,
+// Fail and Do.
+func (e *Expectation) RespondOn(n int, result bin.Encoder) *Expectation {
+	e.on[n] = response{result: result}
+	return e
+}
+
+// FailOn sets error of n-th call, starting from 1, overriding Respond, Fail
+// and Do.
+func (e *Expectation) FailOn(n int, err error) *Expectation {
+	e.on[n] = response{err: err}
+	return e
+}
+
+// exhausted reports whether all expected calls happened.
+func (e *Expectation) exhausted() bool {
+	return !e.anyTimes && e.calls >= e.times
+}
+
+// matches reports whether request matches expectation.
+func (e *Expectation) matches(method string, req bin.Object) bool {
+	if e.method != method {
+		return false
+	}
+	for _, m := range e.matchers {
+		if !m(req) {
+			return false
+		}
+	}
+	return true
+}
+
+var _ tg.Invoker = (*Mock)(nil)
+
+// Mock is a fake tg.Invoker responding to expected requests.
+type Mock struct {
+	mux          sync.Mutex
+	expectations []*Expectation
+	unexpected   []string
+}
+
+// New creates new Mock without expectations.
+func New() *Mock {
+	return &Mock{}
+}
+
+// Expect adds expectation of request of given method, e.g.
+// "messages.sendMessage".
+//
+// Request is matched to the first expectation of its method, in order of
+// adding, which matches it and is not exhausted yet.
+func (m *Mock) Expect(method string) *Expectation {
+	e := &Expectation{
+		method: method,
+		times:  1,
+		on:     map[int]response{},
+	}
+
+	m.mux.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mux.Unlock()
+	return e
+}
+
+// Verify returns error if some expected calls did not happen or unexpected
+// requests were sent.
+func (m *Mock) Verify() error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var err error
+	for _, method := range m.unexpected {
+		err = multierr.Append(err, errors.Wrap(ErrUnexpected, method))
+	}
+	for _, e := range m.expectations {
+		if !e.anyTimes && e.calls < e.times {
+			err = multierr.Append(err, errors.Errorf("%s: expected %d calls, got %d", e.method, e.times, e.calls))
+		}
+	}
+	return err
+}
+
+// constructors returns constructors of TL types by type ID.
+var constructors = sync.OnceValue(tg.TypesConstructorMap) // nolint:gochecknoglobals
+
+// decode returns decoded copy of request.
+func decode(input bin.Encoder) (bin.Object, string, error) {
+	var b bin.Buffer
+	if err := input.Encode(&b); err != nil {
+		return nil, "", errors.Wrap(err, "encode request")
+	}
+	id, err := b.PeekID()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "peek request type")
+	}
+	constructor, ok := constructors()[id]
+	if !ok {
+		return nil, "", errors.Errorf("unknown request type %#x", id)
+	}
+
+	req := constructor()
+	if err := req.Decode(&b); err != nil {
+		return nil, "", errors.Wrap(err, "decode request")
+	}
+	var method string
+	if t, ok := req.(interface{ TypeName() string }); ok {
+		method = t.TypeName()
+	}
+	return req, method, nil
+}
+
+// call returns response to request.
+func (m *Mock) call(method string, req bin.Object) (response, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for _, e := range m.expectations {
+		if e.exhausted() || !e.matches(method, req) {
+			continue
+		}
+		e.calls++
+		if r, ok := e.on[e.calls]; ok {
+			return r, nil
+		}
+		if e.response == nil {
+			return response{}, errors.Errorf("no response to %s set", method)
+		}
+		return *e.response, nil
+	}
+
+	m.unexpected = append(m.unexpected, method)
+	return response{}, errors.Wrap(ErrUnexpected, method)
+}
+
+// Invoke implements tg.Invoker.
+func (m *Mock) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	req, method, err := decode(input)
+	if err != nil {
+		return err
+	}
+	r, err := m.call(method, req)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.get(req)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return errors.Errorf("nil result of %s", method)
+	}
+	if output == nil {
+		return nil
+	}
+	var b bin.Buffer
+	if err := result.Encode(&b); err != nil {
+		return errors.Wrap(err, "encode result")
+	}
+	if err := output.Decode(&b); err != nil {
+		return errors.Wrap(err, "decode result")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package mock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+
+	"github.com/gotd/contrib/invoker/mock"
+)
+
+func TestMock(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	m := mock.New()
+	m.Expect("messages.sendMessage").
+		Match(mock.Peer(&tg.InputPeerUser{UserID: 10})).
+		Respond(&tg.Updates{Date: 1})
+	m.Expect("messages.sendMessage").
+		Match(mock.Request(func(req *tg.MessagesSendMessageRequest) bool {
+			return req.Message == "hello"
+		})).
+		Fail(tgerr.New(400, "PEER_ID_INVALID"))
+	m.Expect("upload.getFile").
+		Times(3).
+		Respond(&tg.UploadFile{Type: &tg.StorageFilePartial{}, Bytes: []byte{1}}).
+		FailOn(3, tgerr.New(420, "FLOOD_WAIT_5"))
+	m.Expect("help.getConfig").
+		AnyTimes().
+		Do(func(req bin.Object) (bin.Encoder, error) {
+			return &tg.Config{ThisDC: 2}, nil
+		})
+	raw := tg.NewClient(m)
+
+	u, err := raw.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:    &tg.InputPeerUser{UserID: 10},
+		Message: "hello",
+	})
+	a.NoError(err)
+	a.Equal(&tg.Updates{Date: 1}, u)
+
+	_, err = raw.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:    &tg.InputPeerUser{UserID: 20},
+		Message: "hello",
+	})
+	a.True(tgerr.Is(err, "PEER_ID_INVALID"))
+
+	for i := 0; i < 2; i++ {
+		f, err := raw.UploadGetFile(ctx, &tg.UploadGetFileRequest{
+			Location: &tg.InputDocumentFileLocation{ID: 1},
+		})
+		a.NoError(err)
+		a.Equal([]byte{1}, f.(*tg.UploadFile).Bytes)
+	}
+	_, err = raw.UploadGetFile(ctx, &tg.UploadGetFileRequest{
+		Location: &tg.InputDocumentFileLocation{ID: 1},
+	})
+	d, ok := tgerr.AsFloodWait(err)
+	a.True(ok)
+	a.Equal(5, int(d.Seconds()))
+
+	cfg, err := raw.HelpGetConfig(ctx)
+	a.NoError(err)
+	a.Equal(2, cfg.ThisDC)
+
+	a.NoError(m.Verify())
+}
+
+func TestMockVerify(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	m := mock.New()
+	m.Expect("help.getConfig").
+		Match(mock.Equal(&tg.HelpGetConfigRequest{})).
+		Respond(&tg.Config{})
+	m.Expect("channels.editTitle").
+		Match(mock.Channel(&tg.InputChannel{ChannelID: 10})).
+		Respond(&tg.Updates{})
+	raw := tg.NewClient(m)
+
+	_, err := raw.HelpGetConfig(ctx)
+	a.NoError(err)
+	// Exhausted.
+	_, err = raw.HelpGetConfig(ctx)
+	a.ErrorIs(err, mock.ErrUnexpected)
+	// Not matched.
+	_, err = raw.ChannelsEditTitle(ctx, &tg.ChannelsEditTitleRequest{
+		Channel: &tg.InputChannel{ChannelID: 20},
+	})
+	a.ErrorIs(err, mock.ErrUnexpected)
+
+	err = m.Verify()
+	a.ErrorIs(err, mock.ErrUnexpected)
+	a.ErrorContains(err, "channels.editTitle: expected 1 calls, got 0")
+}
+
+func TestMockNilResult(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	m := mock.New()
+	m.Expect("help.getConfig").Respond(nil)
+	m.Expect("help.getConfig").Do(func(req bin.Object) (bin.Encoder, error) {
+		return nil, nil
+	})
+	raw := tg.NewClient(m)
+
+	for i := 0; i < 2; i++ {
+		_, err := raw.HelpGetConfig(ctx)
+		a.ErrorContains(err, "nil result")
+	}
+	a.NoError(m.Verify())
+}
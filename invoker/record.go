@@ -0,0 +1,295 @@
+package invoker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// Record is a recorded RPC call.
+type Record struct {
+	// Method is a TypeName of request, e.g. "messages.sendMessage".
+	Method string `json:"method"`
+	// Request is a TL-encoded request.
+	Request []byte `json:"request"`
+	// ResultType is a TypeName of result, e.g. "updates".
+	ResultType string `json:"result_type,omitempty"`
+	// Result is a TL-encoded result, if call succeeded.
+	Result []byte `json:"result,omitempty"`
+	// Error is an error of call, if any.
+	Error *RecordError `json:"error,omitempty"`
+}
+
+// RecordError is a recorded RPC call error.
+type RecordError struct {
+	// Code is an RPC error code, e.g. 420, or zero if error is not an RPC
+	// error.
+	Code int `json:"code,omitempty"`
+	// Message is an RPC error message, e.g. "FLOOD_WAIT_3", or error text.
+	Message string `json:"message"`
+	// Kind is a kind of well-known error which error matches, e.g.
+	// "canceled" for context.Canceled, if any.
+	Kind string `json:"kind,omitempty"`
+}
+
+// errorKinds are kinds of well-known errors, recorded to be matched by
+// errors.Is on replay.
+var errorKinds = []struct { // nolint:gochecknoglobals
+	kind string
+	err  error
+}{
+	{kind: "canceled", err: context.Canceled},
+	{kind: "deadline_exceeded", err: context.DeadlineExceeded},
+	{kind: "unexpected_eof", err: io.ErrUnexpectedEOF},
+	{kind: "eof", err: io.EOF},
+}
+
+// errorKind returns kind of well-known error which err matches, if any.
+func errorKind(err error) string {
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.kind
+		}
+	}
+	return ""
+}
+
+// replayedError is a replayed error matching well-known error.
+type replayedError struct {
+	msg  string
+	kind error
+}
+
+func (e *replayedError) Error() string { return e.msg }
+
+func (e *replayedError) Unwrap() error { return e.kind }
+
+// err returns error to replay.
+func (e *RecordError) err() error {
+	if e.Code != 0 {
+		return tgerr.New(e.Code, e.Message)
+	}
+	for _, k := range errorKinds {
+		if k.kind == e.Kind {
+			return &replayedError{msg: e.Message, kind: k.err}
+		}
+	}
+	return errors.New(e.Message)
+}
+
+// ReadRecords reads records written by Recorder.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	d := json.NewDecoder(r)
+	for {
+		var rec Record
+		if err := d.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, errors.Wrapf(err, "decode record %d", len(records))
+		}
+		records = append(records, rec)
+	}
+}
+
+// typeNames returns TypeNames of TL types by type ID.
+var typeNames = sync.OnceValue(func() map[uint32]string { // nolint:gochecknoglobals
+	r := map[uint32]string{}
+	for id, name := range tg.TypesMap() {
+		name, _, _ = strings.Cut(name, "#")
+		r[id] = name
+	}
+	return r
+})
+
+// typeNameOf returns TypeName of TL-encoded value.
+func typeNameOf(data []byte) string {
+	id, err := (&bin.Buffer{Buf: data}).PeekID()
+	if err != nil {
+		return ""
+	}
+	return typeNames()[id]
+}
+
+// constructors returns constructors of TL types by type ID.
+var constructors = sync.OnceValue(tg.TypesConstructorMap) // nolint:gochecknoglobals
+
+// decodeObject returns decoded TL-encoded value, or nil if its type is
+// unknown.
+func decodeObject(data []byte) (bin.Object, error) {
+	id, err := (&bin.Buffer{Buf: data}).PeekID()
+	if err != nil {
+		return nil, nil
+	}
+	constructor, ok := constructors()[id]
+	if !ok {
+		return nil, nil
+	}
+
+	v := constructor()
+	if err := v.Decode(&bin.Buffer{Buf: append([]byte(nil), data...)}); err != nil {
+		return nil, errors.Wrap(err, "decode")
+	}
+	return v, nil
+}
+
+// redact applies redaction function to TL-encoded value, returning
+// re-encoded value. Values of unknown types are returned as is.
+func redact(f func(v bin.Object), data []byte) ([]byte, error) {
+	if f == nil {
+		return data, nil
+	}
+	v, err := decodeObject(data)
+	if err != nil || v == nil {
+		return data, err
+	}
+
+	f(v)
+	var b bin.Buffer
+	if err := v.Encode(&b); err != nil {
+		return nil, errors.Wrap(err, "encode")
+	}
+	return b.Buf, nil
+}
+
+// captureResult is a bin.Decoder copying raw result before decoding.
+type captureResult struct {
+	next bin.Decoder
+	data []byte
+}
+
+// Decode implements bin.Decoder.
+func (c *captureResult) Decode(b *bin.Buffer) error {
+	c.data = append(c.data[:0], b.Buf...)
+	return c.next.Decode(b)
+}
+
+// Recorder is invoker middleware recording every RPC call to output as
+// JSON lines, to be served later by Replayer.
+//
+// Recording failures do not affect result of call, see WithErrorHandler.
+type Recorder struct {
+	mux     sync.Mutex
+	out     *json.Encoder
+	redact  func(v bin.Object)
+	onError func(ctx context.Context, err error)
+}
+
+// NewRecorder creates new Recorder middleware writing records to out.
+func NewRecorder(out io.Writer) *Recorder {
+	return &Recorder{
+		out:     json.NewEncoder(out),
+		onError: func(ctx context.Context, err error) {},
+	}
+}
+
+// WithErrorHandler sets handler of recording errors, like redaction, encoding
+// or write failures. Default is to ignore them.
+func (r *Recorder) WithErrorHandler(f func(ctx context.Context, err error)) *Recorder {
+	r.onError = f
+	return r
+}
+
+// WithRedact sets function to redact sensitive fields of requests and
+// results before recording, e.g.:
+//
+//	recorder.WithRedact(func(v bin.Object) {
+//		switch v := v.(type) {
+//		case *tg.AuthSendCodeRequest:
+//			v.PhoneNumber = "+10000000000"
+//		case *tg.AuthSignInRequest:
+//			v.PhoneNumber = "+10000000000"
+//			v.PhoneCode = "12345"
+//		}
+//	})
+//
+// Function is called with decoded copy of value, so it can modify it.
+func (r *Recorder) WithRedact(f func(v bin.Object)) *Recorder {
+	r.redact = f
+	return r
+}
+
+// record creates record of call.
+func (r *Recorder) record(input bin.Encoder, result []byte, err error) (Record, error) {
+	var b bin.Buffer
+	if err := input.Encode(&b); err != nil {
+		return Record{}, errors.Wrap(err, "encode request")
+	}
+	request, rerr := redact(r.redact, b.Buf)
+	if rerr != nil {
+		return Record{}, errors.Wrap(rerr, "redact request")
+	}
+	rec := Record{
+		Method:  typeNameOf(request),
+		Request: request,
+	}
+
+	if err != nil {
+		rec.Error = &RecordError{Message: err.Error(), Kind: errorKind(err)}
+		if rpcErr, ok := tgerr.As(err); ok {
+			rec.Error.Code = rpcErr.Code
+			rec.Error.Message = rpcErr.Message
+		}
+		return rec, nil
+	}
+
+	if rec.Result, rerr = redact(r.redact, result); rerr != nil {
+		return Record{}, errors.Wrap(rerr, "redact result")
+	}
+	rec.ResultType = typeNameOf(rec.Result)
+	return rec, nil
+}
+
+// save records call, returning recording error, if any.
+func (r *Recorder) save(input bin.Encoder, result []byte, err error) error {
+	rec, rerr := r.record(input, result, err)
+	if rerr != nil {
+		return errors.Wrap(rerr, "record")
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if err := r.out.Encode(rec); err != nil {
+		return errors.Wrap(err, "write record")
+	}
+	return nil
+}
+
+// Handle implements telegram.Middleware.
+func (r *Recorder) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		var (
+			result []byte
+			err    error
+		)
+		if e, ok := output.(bin.Encoder); ok {
+			if err = next.Invoke(ctx, input, output); err == nil {
+				var b bin.Buffer
+				if rerr := e.Encode(&b); rerr != nil {
+					r.onError(ctx, errors.Wrap(rerr, "record: encode result"))
+					return nil
+				}
+				result = b.Buf
+			}
+		} else {
+			c := &captureResult{next: output}
+			err = next.Invoke(ctx, input, c)
+			result = c.data
+		}
+
+		if rerr := r.save(input, result, err); rerr != nil {
+			r.onError(ctx, rerr)
+		}
+		return err
+	}
+}
@@ -0,0 +1,115 @@
+package invoker
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/gotd/td/bin"
+)
+
+// redacted replaces masked values.
+const redacted = "[redacted]"
+
+// sensitiveFields are parts of names of sensitive fields of auth.* and
+// account.* types, like PhoneNumber, PhoneCodeHash or FutureAuthToken.
+var sensitiveFields = []string{ // nolint:gochecknoglobals
+	"Phone",
+	"Code",
+	"Hash",
+	"Email",
+	"Password",
+	"Token",
+	"Secret",
+}
+
+// Redact masks sensitive fields of v and values it contains in place:
+// string and bytes fields with phone numbers, login codes, hashes, emails,
+// passwords, tokens and secrets of auth.* and account.* types, like
+// tg.AuthSignInRequest or tg.AccountPasswordInputSettings, phone numbers of
+// objects contained in auth.* and account.* types, like tg.User of
+// tg.AuthAuthorization, and SRP values of tg.InputCheckPasswordSRP.
+//
+// Redact can be used with Recorder.WithRedact.
+func Redact(v bin.Object) {
+	redactValue(reflect.ValueOf(v), false)
+}
+
+// redactValue redacts given value. If nested is true, value is contained
+// in auth.* or account.* type.
+func redactValue(v reflect.Value, nested bool) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			redactValue(v.Elem(), nested)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			redactValue(v.Index(i), nested)
+		}
+	case reflect.Struct:
+		redactStruct(v, nested)
+	}
+}
+
+func redactStruct(v reflect.Value, nested bool) {
+	if !v.CanAddr() {
+		// Can't be modified.
+		return
+	}
+	var name string
+	if t, ok := v.Addr().Interface().(interface{ TypeName() string }); ok {
+		name = t.TypeName()
+	}
+	sensitive := strings.HasPrefix(name, "auth.") || strings.HasPrefix(name, "account.")
+	srp := name == "inputCheckPasswordSRP"
+
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		f, field := v.Field(i), t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if (srp && (field.Name == "A" || field.Name == "M1")) ||
+			(sensitive && isSensitive(field.Name)) ||
+			(nested && isPersonal(field.Name)) {
+			mask(f, nested || sensitive)
+			continue
+		}
+		redactValue(f, nested || sensitive)
+	}
+}
+
+// isPersonal reports whether field of object contained in auth.* or
+// account.* type is personal data, like tg.User.Phone.
+func isPersonal(field string) bool {
+	return strings.Contains(field, "Phone")
+}
+
+func isSensitive(field string) bool {
+	for _, s := range sensitiveFields {
+		if strings.Contains(field, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// mask masks non-empty string or bytes value. Other values are redacted
+// recursively.
+func mask(v reflect.Value, nested bool) {
+	switch {
+	case v.Kind() == reflect.String:
+		if v.Len() > 0 {
+			v.SetString(redacted)
+		}
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		if v.Len() > 0 {
+			v.SetBytes([]byte(redacted))
+		}
+	default:
+		redactValue(v, nested)
+	}
+}
@@ -0,0 +1,151 @@
+package invoker
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// ErrNotRecorded is returned by Replayer if request does not match any
+// record.
+var ErrNotRecorded = errors.New("request not recorded")
+
+// ReplayMode is a mode of matching requests to records.
+type ReplayMode int
+
+const (
+	// ReplayStrict requires requests to be identical to records and to be
+	// sent in recorded order.
+	ReplayStrict ReplayMode = iota
+	// ReplayLenient matches requests to records of the same method in any
+	// order, preferring unused records and identical requests. Records can
+	// be used multiple times.
+	ReplayLenient
+)
+
+var _ tg.Invoker = (*Replayer)(nil)
+
+// Replayer is a tg.Invoker serving records written by Recorder, so code
+// using Telegram can be tested offline.
+type Replayer struct {
+	mux     sync.Mutex
+	records []Record
+	used    []bool
+	next    int
+	mode    ReplayMode
+	redact  func(v bin.Object)
+}
+
+// NewReplayer creates new Replayer of given records in ReplayStrict mode.
+func NewReplayer(records []Record) *Replayer {
+	return &Replayer{
+		records: records,
+		used:    make([]bool, len(records)),
+	}
+}
+
+// WithMode sets mode of matching requests. Default is ReplayStrict.
+func (r *Replayer) WithMode(mode ReplayMode) *Replayer {
+	r.mode = mode
+	return r
+}
+
+// WithRedact sets function to redact requests before matching. It should be
+// the same function as passed to Recorder.WithRedact.
+func (r *Replayer) WithRedact(f func(v bin.Object)) *Replayer {
+	r.redact = f
+	return r
+}
+
+// Remaining returns records which were not used yet.
+func (r *Replayer) Remaining() []Record {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var remaining []Record
+	for i, rec := range r.records {
+		if !r.used[i] {
+			remaining = append(remaining, rec)
+		}
+	}
+	return remaining
+}
+
+// match returns index of record matching request.
+// Assumes the mutex is locked.
+func (r *Replayer) match(method string, request []byte) (int, error) {
+	if r.mode == ReplayStrict {
+		if r.next >= len(r.records) {
+			return 0, errors.Wrapf(ErrNotRecorded, "unexpected %s after the last record", method)
+		}
+		i := r.next
+		rec := r.records[i]
+		if rec.Method != method {
+			return 0, errors.Wrapf(ErrNotRecorded, "unexpected %s, record %d is %s", method, i, rec.Method)
+		}
+		if !bytes.Equal(rec.Request, request) {
+			return 0, errors.Wrapf(ErrNotRecorded, "%s does not match record %d", method, i)
+		}
+		r.next++
+		return i, nil
+	}
+
+	// Lower rank is better.
+	selected, selectedRank := -1, 0
+	for i, rec := range r.records {
+		if rec.Method != method {
+			continue
+		}
+		rank := 0
+		if r.used[i] {
+			rank += 2
+		}
+		if !bytes.Equal(rec.Request, request) {
+			rank++
+		}
+		if selected < 0 || rank < selectedRank {
+			selected, selectedRank = i, rank
+		}
+	}
+	if selected < 0 {
+		return 0, errors.Wrapf(ErrNotRecorded, "no records of %s", method)
+	}
+	return selected, nil
+}
+
+// Invoke implements tg.Invoker.
+func (r *Replayer) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	var b bin.Buffer
+	if err := input.Encode(&b); err != nil {
+		return errors.Wrap(err, "encode request")
+	}
+	request, err := redact(r.redact, b.Buf)
+	if err != nil {
+		return errors.Wrap(err, "redact request")
+	}
+	method := typeNameOf(request)
+
+	r.mux.Lock()
+	i, err := r.match(method, request)
+	if err == nil {
+		r.used[i] = true
+	}
+	r.mux.Unlock()
+	if err != nil {
+		return err
+	}
+
+	rec := r.records[i]
+	if rec.Error != nil {
+		return rec.Error.err()
+	}
+	if err := output.Decode(&bin.Buffer{Buf: append([]byte(nil), rec.Result...)}); err != nil {
+		return errors.Wrapf(err, "decode record %d", i)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package invoker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+func record(t *testing.T, f func(v bin.Object)) []Record {
+	t.Helper()
+	a := require.New(t)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	next := telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		switch input.(type) {
+		case *tg.HelpGetConfigRequest:
+			var b bin.Buffer
+			if err := (&tg.Config{ThisDC: 2}).Encode(&b); err != nil {
+				return err
+			}
+			return output.Decode(&b)
+		case *tg.AuthSendCodeRequest:
+			return tgerr.New(420, "FLOOD_WAIT_3")
+		default:
+			return output.Decode(&bin.Buffer{})
+		}
+	})
+	invoker := tg.NewClient(NewRecorder(&out).WithRedact(f).Handle(next))
+
+	cfg, err := invoker.HelpGetConfig(ctx)
+	a.NoError(err)
+	a.Equal(2, cfg.ThisDC)
+	_, err = invoker.AuthSendCode(ctx, &tg.AuthSendCodeRequest{PhoneNumber: "+79001234567"})
+	a.True(tgerr.Is(err, "FLOOD_WAIT"))
+
+	records, err := ReadRecords(&out)
+	a.NoError(err)
+	return records
+}
+
+func TestRecorder(t *testing.T) {
+	a := require.New(t)
+	records := record(t, func(v bin.Object) {
+		if v, ok := v.(*tg.AuthSendCodeRequest); ok {
+			v.PhoneNumber = "+10000000000"
+		}
+	})
+	a.Len(records, 2)
+
+	a.Equal("help.getConfig", records[0].Method)
+	a.Equal("config", records[0].ResultType)
+	a.Nil(records[0].Error)
+
+	a.Equal("auth.sendCode", records[1].Method)
+	a.Equal(&RecordError{Code: 420, Message: "FLOOD_WAIT_3"}, records[1].Error)
+	var req tg.AuthSendCodeRequest
+	a.NoError(req.Decode(&bin.Buffer{Buf: records[1].Request}))
+	a.Equal("+10000000000", req.PhoneNumber)
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func TestRecorderErrors(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	next := telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if _, ok := input.(*tg.AuthSendCodeRequest); ok {
+			return tgerr.New(420, "FLOOD_WAIT_3")
+		}
+		var b bin.Buffer
+		if err := (&tg.Config{ThisDC: 2}).Encode(&b); err != nil {
+			return err
+		}
+		return output.Decode(&b)
+	})
+	var errs []error
+	invoker := tg.NewClient(NewRecorder(errWriter{}).WithErrorHandler(func(ctx context.Context, err error) {
+		errs = append(errs, err)
+	}).Handle(next))
+
+	// Recording failures do not change result of call.
+	cfg, err := invoker.HelpGetConfig(ctx)
+	a.NoError(err)
+	a.Equal(2, cfg.ThisDC)
+	_, err = invoker.AuthSendCode(ctx, &tg.AuthSendCodeRequest{})
+	a.True(tgerr.Is(err, "FLOOD_WAIT"))
+
+	a.Len(errs, 2)
+	for _, err := range errs {
+		a.ErrorIs(err, io.ErrClosedPipe)
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	ctx := context.Background()
+	hideNumber := func(v bin.Object) {
+		if v, ok := v.(*tg.AuthSendCodeRequest); ok {
+			v.PhoneNumber = "+10000000000"
+		}
+	}
+	records := record(t, hideNumber)
+
+	t.Run("Strict", func(t *testing.T) {
+		a := require.New(t)
+		r := NewReplayer(records).WithRedact(hideNumber)
+		invoker := tg.NewClient(r)
+
+		// Out of order.
+		_, err := invoker.AuthSendCode(ctx, &tg.AuthSendCodeRequest{PhoneNumber: "+79001234567"})
+		a.ErrorIs(err, ErrNotRecorded)
+
+		cfg, err := invoker.HelpGetConfig(ctx)
+		a.NoError(err)
+		a.Equal(2, cfg.ThisDC)
+		// Not identical.
+		_, err = invoker.AuthSendCode(ctx, &tg.AuthSendCodeRequest{PhoneNumber: "+79001234567", APIID: 1})
+		a.ErrorIs(err, ErrNotRecorded)
+		_, err = invoker.AuthSendCode(ctx, &tg.AuthSendCodeRequest{PhoneNumber: "+79001234567"})
+		a.True(tgerr.Is(err, "FLOOD_WAIT"))
+		a.Empty(r.Remaining())
+
+		_, err = invoker.HelpGetConfig(ctx)
+		a.ErrorIs(err, ErrNotRecorded)
+	})
+	t.Run("Lenient", func(t *testing.T) {
+		a := require.New(t)
+		r := NewReplayer(records).WithMode(ReplayLenient)
+		invoker := tg.NewClient(r)
+
+		_, err := invoker.AuthSendCode(ctx, &tg.AuthSendCodeRequest{PhoneNumber: "+79001234567"})
+		a.True(tgerr.Is(err, "FLOOD_WAIT"))
+		a.Equal([]Record{records[0]}, r.Remaining())
+
+		for i := 0; i < 2; i++ {
+			cfg, err := invoker.HelpGetConfig(ctx)
+			a.NoError(err)
+			a.Equal(2, cfg.ThisDC)
+		}
+		a.Empty(r.Remaining())
+
+		_, err = invoker.HelpGetNearestDC(ctx)
+		a.ErrorIs(err, ErrNotRecorded)
+	})
+}
+
+func TestReplayerErrorKind(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	next := telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		switch input.(type) {
+		case *tg.HelpGetConfigRequest:
+			return errors.Wrap(context.DeadlineExceeded, "rpc")
+		case *tg.HelpGetNearestDCRequest:
+			return io.EOF
+		default:
+			return errors.New("custom")
+		}
+	})
+	recorder := tg.NewClient(NewRecorder(&out).Handle(next))
+	_, err := recorder.HelpGetConfig(ctx)
+	a.ErrorIs(err, context.DeadlineExceeded)
+	_, err = recorder.HelpGetNearestDC(ctx)
+	a.ErrorIs(err, io.EOF)
+	_, err = recorder.HelpGetAppConfig(ctx, 0)
+	a.Error(err)
+
+	records, err := ReadRecords(&out)
+	a.NoError(err)
+	a.Len(records, 3)
+	a.Equal("deadline_exceeded", records[0].Error.Kind)
+	a.Equal("eof", records[1].Error.Kind)
+	a.Empty(records[2].Error.Kind)
+
+	invoker := tg.NewClient(NewReplayer(records))
+	_, err = invoker.HelpGetConfig(ctx)
+	a.ErrorIs(err, context.DeadlineExceeded)
+	a.EqualError(err, "rpc: context deadline exceeded")
+	_, err = invoker.HelpGetNearestDC(ctx)
+	a.ErrorIs(err, io.EOF)
+	_, err = invoker.HelpGetAppConfig(ctx, 0)
+	a.EqualError(err, "custom")
+	a.NotErrorIs(err, io.EOF)
+}
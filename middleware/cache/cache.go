@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// DefaultTTL returns default cache time of methods.
+func DefaultTTL() map[string]time.Duration {
+	return map[string]time.Duration{
+		"help.getConfig":          time.Hour,
+		"help.getAppConfig":       time.Hour,
+		"help.getNearestDc":       time.Hour,
+		"messages.getStickerSet":  time.Hour,
+		"users.getFullUser":       time.Minute,
+		"channels.getFullChannel": time.Minute,
+	}
+}
+
+// notModified returns type IDs of "not modified" responses of methods with
+// hash parameter, like help.appConfigNotModified.
+var notModified = sync.OnceValue(func() map[uint32]struct{} { // nolint:gochecknoglobals
+	r := map[uint32]struct{}{}
+	for id, name := range tg.TypesMap() {
+		if strings.Contains(name, "NotModified#") {
+			r[id] = struct{}{}
+		}
+	}
+	return r
+})
+
+// Cache is a tg.Invoker that caches responses of read requests.
+//
+// Store errors do not fail requests: request is sent as if response is not
+// cached.
+type Cache struct {
+	store Store
+	scope string
+	ttl   map[string]time.Duration
+}
+
+// New returns a new invoker caching responses of DefaultTTL methods in
+// given store.
+//
+// Responses of some methods depend on the account, like
+// users.getFullUser(inputUserSelf), so entries are kept per scope. Use ID of
+// the authorized user as scope, especially if store is shared between
+// accounts.
+func New(store Store, scope string) *Cache {
+	return &Cache{
+		store: store,
+		scope: scope,
+		ttl:   DefaultTTL(),
+	}
+}
+
+// clone returns a copy of the Cache.
+func (c *Cache) clone() *Cache {
+	ttl := make(map[string]time.Duration, len(c.ttl))
+	for k, v := range c.ttl {
+		ttl[k] = v
+	}
+	return &Cache{
+		store: c.store,
+		scope: c.scope,
+		ttl:   ttl,
+	}
+}
+
+// WithTTL sets cache time of method, e.g. "messages.getStickerSet". Only
+// read methods should be cached. Zero disables caching of method.
+func (c *Cache) WithTTL(method string, ttl time.Duration) *Cache {
+	c = c.clone()
+	if ttl <= 0 {
+		delete(c.ttl, method)
+	} else {
+		c.ttl[method] = ttl
+	}
+	return c
+}
+
+// key returns cache key of request.
+func key(scope, method string, b *bin.Buffer) string {
+	h := sha256.Sum256(b.Buf)
+	return scope + ":" + method + ":" + hex.EncodeToString(h[:])
+}
+
+// Handle implements telegram.Middleware.
+func (c *Cache) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		t, ok := input.(interface{ TypeName() string })
+		if !ok {
+			return next.Invoke(ctx, input, output)
+		}
+		method := t.TypeName()
+		ttl, ok := c.ttl[method]
+		if !ok {
+			return next.Invoke(ctx, input, output)
+		}
+		result, ok := output.(bin.Encoder)
+		if !ok {
+			// Response can't be encoded to cache.
+			return next.Invoke(ctx, input, output)
+		}
+
+		var b bin.Buffer
+		if err := input.Encode(&b); err != nil {
+			return next.Invoke(ctx, input, output)
+		}
+		k := key(c.scope, method, &b)
+
+		if data, found, err := c.store.Get(ctx, k); err == nil && found {
+			if err := output.Decode(&bin.Buffer{Buf: append([]byte(nil), data...)}); err == nil {
+				return nil
+			}
+			// Corrupted or outdated entry, request again.
+		}
+
+		if err := next.Invoke(ctx, input, output); err != nil {
+			return err
+		}
+
+		b.Reset()
+		if err := result.Encode(&b); err != nil {
+			return nil
+		}
+		if id, err := b.PeekID(); err == nil {
+			if _, ok := notModified()[id]; ok {
+				return nil
+			}
+		}
+		// Caching is best-effort.
+		_ = c.store.Set(ctx, k, b.Buf, ttl)
+		return nil
+	}
+}
@@ -0,0 +1,152 @@
+package cache_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/neo"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/middleware/cache"
+	"github.com/gotd/contrib/middleware/cache/cachetest"
+)
+
+// resultInvoker returns given result.
+type resultInvoker struct {
+	calls  int
+	result bin.Encoder
+	err    error
+}
+
+func (i *resultInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	i.calls++
+	if i.err != nil {
+		return i.err
+	}
+	var b bin.Buffer
+	if err := i.result.Encode(&b); err != nil {
+		return err
+	}
+	return output.Decode(&b)
+}
+
+type failingStore struct{}
+
+func (failingStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return nil, false, errors.New("unavailable")
+}
+
+func (failingStore) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	return errors.New("unavailable")
+}
+
+func TestMemory(t *testing.T) {
+	cachetest.TestStore(t, cache.NewMemory())
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	clk := neo.NewTime(time.Now())
+	store := cache.NewMemory().WithClock(clk)
+	c := cache.New(store, "1")
+
+	t.Run("Cached", func(t *testing.T) {
+		a := require.New(t)
+		next := &resultInvoker{result: &tg.Config{ThisDC: 2}}
+		h := c.Handle(next)
+
+		for i := 0; i < 2; i++ {
+			var cfg tg.Config
+			a.NoError(h.Invoke(ctx, &tg.HelpGetConfigRequest{}, &cfg))
+			a.Equal(2, cfg.ThisDC)
+		}
+		a.Equal(1, next.calls)
+
+		// Expired.
+		clk.Travel(time.Hour)
+		var cfg tg.Config
+		a.NoError(h.Invoke(ctx, &tg.HelpGetConfigRequest{}, &cfg))
+		a.Equal(2, next.calls)
+	})
+	t.Run("Arguments", func(t *testing.T) {
+		a := require.New(t)
+		next := &resultInvoker{result: &tg.MessagesStickerSet{
+			Set: tg.StickerSet{ID: 1, Title: "gotd"},
+		}}
+		h := c.Handle(next)
+
+		for _, id := range []int64{1, 2, 1} {
+			var box tg.MessagesStickerSetBox
+			a.NoError(h.Invoke(ctx, &tg.MessagesGetStickerSetRequest{
+				Stickerset: &tg.InputStickerSetID{ID: id},
+			}, &box))
+			set, ok := box.StickerSet.(*tg.MessagesStickerSet)
+			a.True(ok)
+			a.Equal("gotd", set.Set.Title)
+		}
+		a.Equal(2, next.calls)
+	})
+	t.Run("Scope", func(t *testing.T) {
+		a := require.New(t)
+		req := &tg.UsersGetFullUserRequest{ID: &tg.InputUserSelf{}}
+
+		for _, id := range []int64{1, 2} {
+			next := &resultInvoker{result: &tg.UsersUserFull{
+				FullUser: tg.UserFull{ID: id},
+			}}
+			h := cache.New(store, strconv.FormatInt(id, 10)).Handle(next)
+
+			var full tg.UsersUserFull
+			a.NoError(h.Invoke(ctx, req, &full))
+			a.Equal(id, full.FullUser.ID)
+			a.Equal(1, next.calls)
+		}
+	})
+	t.Run("NotModified", func(t *testing.T) {
+		a := require.New(t)
+		next := &resultInvoker{result: &tg.HelpAppConfigNotModified{}}
+		h := c.Handle(next)
+
+		for i := 0; i < 2; i++ {
+			var box tg.HelpAppConfigBox
+			a.NoError(h.Invoke(ctx, &tg.HelpGetAppConfigRequest{Hash: 10}, &box))
+			a.IsType(&tg.HelpAppConfigNotModified{}, box.AppConfig)
+		}
+		a.Equal(2, next.calls)
+	})
+	t.Run("NotCached", func(t *testing.T) {
+		a := require.New(t)
+		next := &resultInvoker{result: &tg.Config{}}
+		h := c.WithTTL("help.getConfig", 0).Handle(next)
+
+		for i := 0; i < 2; i++ {
+			a.NoError(h.Invoke(ctx, &tg.HelpGetConfigRequest{}, &tg.Config{}))
+		}
+		a.Equal(2, next.calls)
+	})
+	t.Run("Error", func(t *testing.T) {
+		a := require.New(t)
+		next := &resultInvoker{err: errors.New("failed")}
+		h := cache.New(cache.NewMemory(), "1").Handle(next)
+
+		for i := 0; i < 2; i++ {
+			a.ErrorIs(h.Invoke(ctx, &tg.HelpGetConfigRequest{}, &tg.Config{}), next.err)
+		}
+		a.Equal(2, next.calls)
+	})
+	t.Run("StoreUnavailable", func(t *testing.T) {
+		a := require.New(t)
+		next := &resultInvoker{result: &tg.Config{ThisDC: 2}}
+		h := cache.New(failingStore{}, "1").Handle(next)
+
+		var cfg tg.Config
+		a.NoError(h.Invoke(ctx, &tg.HelpGetConfigRequest{}, &cfg))
+		a.Equal(2, cfg.ThisDC)
+	})
+}
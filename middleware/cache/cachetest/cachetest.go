@@ -0,0 +1,41 @@
+// Package cachetest contains conformance test suite for cache.Store
+// implementations.
+//
+// Suite expects a fresh (empty) store, because it checks behavior of missing
+// values.
+package cachetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/contrib/middleware/cache"
+)
+
+// TestStore runs conformance tests for given cache.Store implementation.
+func TestStore(t *testing.T, store cache.Store) {
+	ctx := t.Context()
+
+	t.Run("ResponseCache", func(t *testing.T) {
+		a := require.New(t)
+
+		_, found, err := store.Get(ctx, "help.getConfig:1")
+		a.NoError(err)
+		a.False(found)
+
+		a.NoError(store.Set(ctx, "help.getConfig:1", []byte{1, 2, 3}, time.Hour))
+		data, found, err := store.Get(ctx, "help.getConfig:1")
+		a.NoError(err)
+		a.True(found)
+		a.Equal([]byte{1, 2, 3}, data)
+
+		// Expiration.
+		a.NoError(store.Set(ctx, "help.getConfig:2", []byte{4}, 10*time.Millisecond))
+		a.Eventually(func() bool {
+			_, found, err := store.Get(ctx, "help.getConfig:2")
+			return err == nil && !found
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
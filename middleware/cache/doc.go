@@ -0,0 +1,13 @@
+// Package cache implements a tg.Invoker that caches responses of read
+// requests.
+//
+// Responses are cached as TL-encoded bytes per scope, method and encoded
+// request, for a time set per method, see DefaultTTL. Scope separates
+// accounts sharing the store, like a user ID. Cached responses are kept in a
+// Store: in memory, or in Redis or Pebble using redis.ResponseCache and
+// pebble.ResponseCache.
+//
+// Methods with hash parameter, like help.getAppConfig, are cached per hash
+// value, and their "not modified" responses are never cached, so callers
+// passing hash of their own copy still get actual response.
+package cache
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/clock"
+)
+
+// Store is a byte store of cached responses.
+type Store interface {
+	// Get returns data with given key if it is not expired.
+	Get(ctx context.Context, key string) (data []byte, found bool, err error)
+	// Set sets data with given key, expiring after ttl.
+	Set(ctx context.Context, key string, data []byte, ttl time.Duration) error
+}
+
+// minSweep is a minimum number of entries to start eviction of expired ones.
+const minSweep = 64
+
+type entry struct {
+	data     []byte
+	deadline time.Time
+}
+
+// Memory is an in-memory Store.
+//
+// Expired entries are evicted as new ones are added.
+type Memory struct {
+	clock   clock.Clock
+	mux     sync.Mutex
+	entries map[string]entry
+	sweepAt int
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory creates new in-memory Store.
+func NewMemory() *Memory {
+	return &Memory{
+		clock:   clock.System,
+		entries: map[string]entry{},
+		sweepAt: minSweep,
+	}
+}
+
+// WithClock sets clock to use. Default is to use system clock.
+func (m *Memory) WithClock(c clock.Clock) *Memory {
+	m.clock = c
+	return m
+}
+
+// Get implements Store.
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !m.clock.Now().Before(e.deadline) {
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	return e.data, true, nil
+}
+
+// Set implements Store.
+func (m *Memory) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := m.clock.Now()
+	if len(m.entries) >= m.sweepAt {
+		for k, e := range m.entries {
+			if !now.Before(e.deadline) {
+				delete(m.entries, k)
+			}
+		}
+		m.sweepAt = 2 * len(m.entries)
+		if m.sweepAt < minSweep {
+			m.sweepAt = minSweep
+		}
+	}
+
+	m.entries[key] = entry{
+		data:     append([]byte(nil), data...),
+		deadline: now.Add(ttl),
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package circuitbreaker
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/middleware/retry"
+)
+
+// ErrOpen is returned by Breaker if circuit of request is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+const (
+	defaultWindow      = 10 * time.Second
+	defaultMinRequests = 10
+	defaultRatio       = 0.5
+	defaultOpenTimeout = 30 * time.Second
+	defaultProbes      = 1
+)
+
+// minSweep is a minimum number of circuits to start eviction of idle ones.
+const minSweep = 64
+
+// circuits is a state shared by Breaker copies.
+//
+// Idle closed circuits are evicted as new ones are added, so keys with
+// high cardinality, like peers, do not leak.
+type circuits struct {
+	mux      sync.Mutex
+	circuits map[string]*circuit
+	sweepAt  int
+}
+
+// add adds new circuit with given key, evicting idle ones if necessary.
+// Assumes the mutex is locked.
+func (s *circuits) add(now time.Time, key string, c *circuit) {
+	if len(s.circuits) >= s.sweepAt {
+		for k, v := range s.circuits {
+			if v.idle(now) {
+				delete(s.circuits, k)
+			}
+		}
+		s.sweepAt = 2 * len(s.circuits)
+		if s.sweepAt < minSweep {
+			s.sweepAt = minSweep
+		}
+	}
+	s.circuits[key] = c
+}
+
+// Breaker is a tg.Invoker that fails requests fast while their circuit is
+// open.
+type Breaker struct {
+	clock     clock.Clock
+	settings  settings
+	key       func(ctx context.Context, input bin.Encoder) string
+	isFailure func(err error) bool
+	onChange  func(ctx context.Context, c StateChange)
+
+	state *circuits
+}
+
+// methodKey returns TypeName of request.
+func methodKey(ctx context.Context, input bin.Encoder) string {
+	if t, ok := input.(interface{ TypeName() string }); ok {
+		return t.TypeName()
+	}
+	return ""
+}
+
+// New returns a new invoker circuit breaker.
+func New() *Breaker {
+	return &Breaker{
+		clock: clock.System,
+		settings: settings{
+			window:      defaultWindow,
+			minRequests: defaultMinRequests,
+			ratio:       defaultRatio,
+			openTimeout: defaultOpenTimeout,
+			probes:      defaultProbes,
+		},
+		key:       methodKey,
+		isFailure: retry.IsTransient,
+		onChange:  func(ctx context.Context, c StateChange) {},
+		state: &circuits{
+			circuits: map[string]*circuit{},
+			sweepAt:  minSweep,
+		},
+	}
+}
+
+// clone returns a copy of the Breaker.
+func (b *Breaker) clone() *Breaker {
+	return &Breaker{
+		clock:     b.clock,
+		settings:  b.settings,
+		key:       b.key,
+		isFailure: b.isFailure,
+		onChange:  b.onChange,
+		state:     b.state,
+	}
+}
+
+// WithClock sets clock to use. Default is to use system clock.
+func (b *Breaker) WithClock(c clock.Clock) *Breaker {
+	b = b.clone()
+	b.clock = c
+	return b
+}
+
+// WithKey sets function returning key of circuit of request. Default is
+// TypeName of request, e.g. "upload.getFile".
+func (b *Breaker) WithKey(f func(ctx context.Context, input bin.Encoder) string) *Breaker {
+	b = b.clone()
+	b.key = f
+	return b
+}
+
+// WithFailureRatio sets ratio of failed requests, from 0 to 1, which opens
+// circuit, if at least minRequests completed in a window and at least one of
+// them failed. Counts are reset every window. Default is 0.5 of at least 10
+// requests in 10 seconds.
+//
+// Ratio out of range is clamped, so ratio 0 opens circuit on any failure.
+func (b *Breaker) WithFailureRatio(ratio float64, minRequests int, window time.Duration) *Breaker {
+	ratio = math.Min(math.Max(ratio, 0), 1)
+	b = b.clone()
+	b.settings.ratio = ratio
+	b.settings.minRequests = minRequests
+	b.settings.window = window
+	return b
+}
+
+// WithOpenTimeout sets time circuit stays open before probing. Default is
+// 30 seconds.
+func (b *Breaker) WithOpenTimeout(d time.Duration) *Breaker {
+	b = b.clone()
+	b.settings.openTimeout = d
+	return b
+}
+
+// WithProbes sets number of successful probe requests of half-open circuit
+// to close it. It is also a limit of concurrent probes. Default is 1.
+func (b *Breaker) WithProbes(n int) *Breaker {
+	b = b.clone()
+	b.settings.probes = n
+	return b
+}
+
+// WithFailure sets function reporting whether error is a failure. Default
+// is retry.IsTransient: internal server errors, timeouts and transport
+// errors.
+func (b *Breaker) WithFailure(f func(err error) bool) *Breaker {
+	b = b.clone()
+	b.isFailure = f
+	return b
+}
+
+// WithCallback sets callback for circuit state change event.
+func (b *Breaker) WithCallback(f func(ctx context.Context, c StateChange)) *Breaker {
+	b = b.clone()
+	b.onChange = f
+	return b
+}
+
+// State returns state of circuit with given key.
+func (b *Breaker) State(key string) State {
+	b.state.mux.Lock()
+	defer b.state.mux.Unlock()
+
+	c, ok := b.state.circuits[key]
+	if !ok {
+		return Closed
+	}
+	return c.state
+}
+
+// States returns state of every circuit which is not closed.
+func (b *Breaker) States() map[string]State {
+	b.state.mux.Lock()
+	defer b.state.mux.Unlock()
+
+	r := map[string]State{}
+	for key, c := range b.state.circuits {
+		if c.state != Closed {
+			r[key] = c.state
+		}
+	}
+	return r
+}
+
+func (b *Breaker) allow(ctx context.Context, key string) (uint64, bool) {
+	b.state.mux.Lock()
+	now := b.clock.Now()
+	c, ok := b.state.circuits[key]
+	if !ok {
+		c = &circuit{windowEnd: now.Add(b.settings.window)}
+		b.state.add(now, key, c)
+	}
+	gen, allowed, from, changed := c.allow(now, b.settings)
+	to := c.state
+	b.state.mux.Unlock()
+
+	if changed {
+		b.onChange(ctx, StateChange{Key: key, From: from, To: to})
+	}
+	return gen, allowed
+}
+
+func (b *Breaker) done(ctx context.Context, key string, gen uint64, err error) {
+	r := success
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		r = canceled
+	case b.isFailure(err):
+		r = failure
+	}
+
+	b.state.mux.Lock()
+	from, changed := b.state.circuits[key].done(b.clock.Now(), b.settings, gen, r)
+	to := b.state.circuits[key].state
+	b.state.mux.Unlock()
+
+	if changed {
+		b.onChange(ctx, StateChange{Key: key, From: from, To: to})
+	}
+}
+
+// Handle implements telegram.Middleware.
+func (b *Breaker) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		key := b.key(ctx, input)
+		gen, ok := b.allow(ctx, key)
+		if !ok {
+			return errors.Wrapf(ErrOpen, "circuit %q", key)
+		}
+
+		err := next.Invoke(ctx, input, output)
+		b.done(ctx, key, gen, err)
+		return err
+	}
+}
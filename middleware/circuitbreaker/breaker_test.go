@@ -0,0 +1,201 @@
+package circuitbreaker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/neo"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+type invokeFunc func(ctx context.Context) error
+
+func (f invokeFunc) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	return f(ctx)
+}
+
+func TestBreaker(t *testing.T) {
+	const method = "upload.getFile"
+
+	ctx := context.Background()
+	clk := neo.NewTime(time.Now())
+
+	var (
+		calls   int
+		err     error
+		changes []StateChange
+	)
+	next := invokeFunc(func(ctx context.Context) error {
+		calls++
+		return err
+	})
+	b := New().
+		WithClock(clk).
+		WithFailureRatio(0.5, 4, time.Minute).
+		WithOpenTimeout(10 * time.Second).
+		WithCallback(func(ctx context.Context, c StateChange) {
+			changes = append(changes, c)
+		})
+	h := b.Handle(next)
+	getFile := &tg.UploadGetFileRequest{Location: &tg.InputDocumentFileLocation{}}
+
+	a := require.New(t)
+	invoke := func(expected error) {
+		t.Helper()
+		a.ErrorIs(h.Invoke(ctx, getFile, nil), expected)
+	}
+
+	internal := tgerr.New(500, "INTERNAL")
+	invoke(nil)
+	// Not a failure.
+	err = tgerr.New(400, "FILE_REFERENCE_EXPIRED")
+	invoke(err)
+	err = internal
+	invoke(internal)
+	a.Equal(Closed, b.State(method))
+	invoke(internal)
+	a.Equal(Open, b.State(method))
+	a.Equal(map[string]State{method: Open}, b.States())
+
+	// Fail fast.
+	calls = 0
+	invoke(ErrOpen)
+	a.Zero(calls)
+	// Other methods are not affected.
+	a.ErrorIs(h.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil), internal)
+	a.Equal(1, calls)
+
+	// Failed probe.
+	clk.Travel(10 * time.Second)
+	invoke(internal)
+	a.Equal(Open, b.State(method))
+	invoke(ErrOpen)
+
+	// Canceled probe.
+	clk.Travel(10 * time.Second)
+	canceled, cancel := context.WithCancel(ctx)
+	next = func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	}
+	a.ErrorIs(b.Handle(next).Invoke(canceled, getFile, nil), context.Canceled)
+	a.Equal(HalfOpen, b.State(method))
+
+	// Successful probe.
+	err = nil
+	invoke(nil)
+	a.Equal(Closed, b.State(method))
+	a.Empty(b.States())
+
+	a.Equal([]StateChange{
+		{Key: method, From: Closed, To: Open},
+		{Key: method, From: Open, To: HalfOpen},
+		{Key: method, From: HalfOpen, To: Open},
+		{Key: method, From: Open, To: HalfOpen},
+		{Key: method, From: HalfOpen, To: Closed},
+	}, changes)
+}
+
+func TestBreakerProbes(t *testing.T) {
+	ctx := context.Background()
+	clk := neo.NewTime(time.Now())
+	b := New().WithClock(clk).WithFailureRatio(1, 1, time.Minute).WithProbes(2)
+
+	a := require.New(t)
+	internal := tgerr.New(500, "INTERNAL")
+	a.ErrorIs(b.Handle(invokeFunc(func(ctx context.Context) error {
+		return internal
+	})).Invoke(ctx, &tg.HelpGetConfigRequest{}, nil), internal)
+	a.Equal(Open, b.State("help.getConfig"))
+
+	clk.Travel(defaultOpenTimeout)
+	// Concurrent probes are limited.
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	h := b.Handle(invokeFunc(func(ctx context.Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}))
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- h.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil) }()
+		<-started
+	}
+	a.ErrorIs(h.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil), ErrOpen)
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		a.NoError(<-done)
+	}
+	a.Equal(Closed, b.State("help.getConfig"))
+}
+
+func TestBreakerCallerErrors(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	b := New().WithFailureRatio(1, 1, time.Minute)
+
+	for _, err := range []error{context.Canceled, context.DeadlineExceeded} {
+		a.ErrorIs(b.Handle(invokeFunc(func(ctx context.Context) error {
+			return err
+		})).Invoke(ctx, &tg.HelpGetConfigRequest{}, nil), err)
+	}
+	// Caller's own cancellation is not a failure of server.
+	a.Equal(Closed, b.State("help.getConfig"))
+}
+
+func TestBreakerRatio(t *testing.T) {
+	a := require.New(t)
+	a.Equal(0.0, New().WithFailureRatio(-1, 1, time.Minute).settings.ratio)
+	a.Equal(1.0, New().WithFailureRatio(1.5, 1, time.Minute).settings.ratio)
+
+	// Circuit is not opened without failures.
+	b := New().WithFailureRatio(0.01, 1, time.Minute)
+	h := b.Handle(invokeFunc(func(ctx context.Context) error { return nil }))
+	for i := 0; i < 10; i++ {
+		a.NoError(h.Invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil))
+	}
+	a.Equal(Closed, b.State("help.getConfig"))
+}
+
+func TestBreakerEviction(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	clk := neo.NewTime(time.Now())
+
+	var key int
+	b := New().WithClock(clk).WithFailureRatio(1, 1, time.Minute).
+		WithKey(func(ctx context.Context, input bin.Encoder) string {
+			return fmt.Sprint(key)
+		})
+	internal := tgerr.New(500, "INTERNAL")
+	failing := b.Handle(invokeFunc(func(ctx context.Context) error { return internal }))
+	h := b.Handle(invokeFunc(func(ctx context.Context) error { return nil }))
+
+	a.ErrorIs(failing.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil), internal)
+	a.Equal(Open, b.State("0"))
+	for key = 1; key < minSweep; key++ {
+		a.NoError(h.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil))
+	}
+	a.Len(b.state.circuits, minSweep)
+
+	// Idle closed circuits are evicted.
+	clk.Travel(time.Minute)
+	a.NoError(h.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil))
+	a.Len(b.state.circuits, 2)
+	a.Equal(Open, b.State("0"))
+}
+
+func TestStateString(t *testing.T) {
+	a := require.New(t)
+	a.Equal("closed", Closed.String())
+	a.Equal("open", Open.String())
+	a.Equal("half-open", HalfOpen.String())
+}
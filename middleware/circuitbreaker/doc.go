@@ -0,0 +1,10 @@
+// Package circuitbreaker implements a tg.Invoker that fails fast when
+// requests keep failing.
+//
+// Every method, or other key set by Breaker.WithKey, has its own circuit.
+// Circuit is closed while requests succeed. When ratio of failed requests
+// exceeds the threshold, circuit opens and requests fail immediately with
+// ErrOpen. After a timeout circuit becomes half-open and lets a few probe
+// requests through: their success closes the circuit, failure opens it
+// again.
+package circuitbreaker
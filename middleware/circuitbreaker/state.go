@@ -0,0 +1,172 @@
+package circuitbreaker
+
+import (
+	"time"
+)
+
+// State of circuit.
+type State int
+
+// Circuit states.
+const (
+	// Closed circuit lets requests through and counts failures.
+	Closed State = iota
+	// Open circuit fails requests immediately.
+	Open
+	// HalfOpen circuit lets a few probe requests through.
+	HalfOpen
+)
+
+// String implements fmt.Stringer.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// StateChange event.
+type StateChange struct {
+	// Key of circuit, e.g. "upload.getFile".
+	Key string
+	// From is a previous state.
+	From State
+	// To is a new state.
+	To State
+}
+
+// settings of circuit.
+type settings struct {
+	window      time.Duration
+	minRequests int
+	ratio       float64
+	openTimeout time.Duration
+	probes      int
+}
+
+// circuit is a state machine of a single key.
+type circuit struct {
+	state State
+	// generation is changed on every state change or counts reset, so
+	// results of requests started before are ignored.
+	generation uint64
+	// windowEnd is the end of current counting window of closed circuit.
+	windowEnd time.Time
+	// openUntil is the end of open state.
+	openUntil time.Time
+
+	// requests and failures are counts of completed requests of closed
+	// circuit in current window.
+	requests int
+	failures int
+	// inFlight and successes are counts of probes of half-open circuit.
+	inFlight  int
+	successes int
+	// pending is a count of allowed requests which are not completed yet.
+	pending int
+}
+
+// idle reports whether circuit is closed and has no requests in current
+// window, so it can be dropped.
+func (c *circuit) idle(now time.Time) bool {
+	return c.state == Closed && c.pending == 0 && !now.Before(c.windowEnd)
+}
+
+// setState changes state of circuit, returning false if it is unchanged.
+func (c *circuit) setState(now time.Time, s settings, state State) bool {
+	if c.state == state {
+		return false
+	}
+	c.state = state
+	c.generation++
+	c.requests, c.failures, c.inFlight, c.successes = 0, 0, 0, 0
+	switch state {
+	case Closed:
+		c.windowEnd = now.Add(s.window)
+	case Open:
+		c.openUntil = now.Add(s.openTimeout)
+	}
+	return true
+}
+
+// allow reports whether request is allowed at now and returns generation of
+// request. from is a previous state if state changed.
+func (c *circuit) allow(now time.Time, s settings) (gen uint64, ok bool, from State, changed bool) {
+	from = c.state
+	switch c.state {
+	case Closed:
+		if !now.Before(c.windowEnd) {
+			// Start new window.
+			c.generation++
+			c.requests, c.failures = 0, 0
+			c.windowEnd = now.Add(s.window)
+		}
+	case Open:
+		if now.Before(c.openUntil) {
+			return 0, false, from, false
+		}
+		changed = c.setState(now, s, HalfOpen)
+	}
+	if c.state == HalfOpen {
+		if c.inFlight >= s.probes {
+			return 0, false, from, changed
+		}
+		c.inFlight++
+	}
+	c.pending++
+	return c.generation, true, from, changed
+}
+
+// outcome of request.
+type outcome int
+
+const (
+	success outcome = iota
+	failure
+	// canceled request tells nothing about health of circuit.
+	canceled
+)
+
+// done records outcome of request with given generation. from is a previous
+// state if state changed.
+func (c *circuit) done(now time.Time, s settings, gen uint64, r outcome) (from State, changed bool) {
+	from = c.state
+	c.pending--
+	if gen != c.generation {
+		return from, false
+	}
+
+	switch c.state {
+	case Closed:
+		if r == canceled {
+			return from, false
+		}
+		c.requests++
+		if r == failure {
+			c.failures++
+		}
+		if c.failures > 0 && c.requests >= s.minRequests &&
+			float64(c.failures) >= s.ratio*float64(c.requests) {
+			return from, c.setState(now, s, Open)
+		}
+	case HalfOpen:
+		c.inFlight--
+		switch r {
+		case canceled:
+			return from, false
+		case failure:
+			return from, c.setState(now, s, Open)
+		}
+		c.successes++
+		if c.successes >= s.probes {
+			return from, c.setState(now, s, Closed)
+		}
+	}
+	return from, false
+}
@@ -27,6 +27,22 @@
 // chat-specific, not request-specific"), so the Waiter retries only the
 // offending request and leaves unrelated requests of the same type untouched.
 //
+// By default requests are keyed by type only. Use Waiter.WithKeyBy with
+// KeyByPeer and KeyByDC to additionally key them by target peer and DC, so
+// FLOOD_WAIT delays only requests to the same chat or DC.
+//
+// # Persistence
+//
+// By default the Waiter keeps per-method penalties only in memory. Use
+// WithPenaltyStore to persist wait deadlines, so a restarted program does not
+// immediately hit the same limit again. Generic key-value, bbolt and Redis
+// stores are available in auth/kv, bbolt and redis packages.
+//
+// A SharedPenaltyStore, like redis.FloodState, is consulted before scheduling
+// every request, so multiple processes using the same account respect each
+// other's penalties. If the store is unreachable, the Waiter falls back to
+// local scheduling.
+//
 // # Limits
 //
 // Both waiters bound retries via WithMaxRetries and the per-attempt wait via
@@ -0,0 +1,81 @@
+// Package floodwaittest contains conformance test suite for
+// floodwait.PenaltyStore implementations.
+//
+// Suite expects a fresh (empty) store, because it checks behavior of missing
+// values.
+package floodwaittest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/contrib/middleware/floodwait"
+)
+
+// TestPenaltyStore runs conformance tests for given floodwait.PenaltyStore
+// implementation. If store implements floodwait.SharedPenaltyStore, sharing
+// is tested too.
+func TestPenaltyStore(t *testing.T, store floodwait.PenaltyStore) {
+	ctx := t.Context()
+
+	t.Run("PenaltyStore", func(t *testing.T) {
+		now := time.Date(2077, 10, 23, 0, 3, 0, 0, time.UTC)
+
+		t.Run("Empty", func(t *testing.T) {
+			a := require.New(t)
+
+			penalties, err := store.LoadPenalties(ctx, now)
+			a.NoError(err)
+			a.Empty(penalties)
+		})
+		t.Run("SaveLoad", func(t *testing.T) {
+			a := require.New(t)
+
+			a.NoError(store.SavePenalty(ctx, "1", now.Add(time.Minute)))
+			a.NoError(store.SavePenalty(ctx, "2", now.Add(time.Hour)))
+			// Overwrite.
+			a.NoError(store.SavePenalty(ctx, "1", now.Add(2*time.Minute)))
+
+			penalties, err := store.LoadPenalties(ctx, now)
+			a.NoError(err)
+			a.Len(penalties, 2)
+			a.True(now.Add(2*time.Minute).Equal(penalties["1"]), "got %s", penalties["1"])
+			a.True(now.Add(time.Hour).Equal(penalties["2"]), "got %s", penalties["2"])
+		})
+		t.Run("Expired", func(t *testing.T) {
+			a := require.New(t)
+
+			later := now.Add(10 * time.Minute)
+			penalties, err := store.LoadPenalties(ctx, later)
+			a.NoError(err)
+			a.Len(penalties, 1)
+			a.Contains(penalties, "2")
+		})
+
+		shared, ok := store.(floodwait.SharedPenaltyStore)
+		if !ok {
+			return
+		}
+		t.Run("Shared", func(t *testing.T) {
+			a := require.New(t)
+
+			_, found, err := shared.Penalty(ctx, "3")
+			a.NoError(err)
+			a.False(found)
+
+			a.NoError(shared.SavePenalty(ctx, "3", now.Add(time.Hour)))
+			deadline, found, err := shared.Penalty(ctx, "3")
+			a.NoError(err)
+			a.True(found)
+			a.True(now.Add(time.Hour).Equal(deadline), "got %s", deadline)
+
+			// Shared penalty must not be shortened by other process.
+			a.NoError(shared.SavePenalty(ctx, "3", now.Add(time.Minute)))
+			deadline, _, err = shared.Penalty(ctx, "3")
+			a.NoError(err)
+			a.True(now.Add(time.Hour).Equal(deadline), "got %s", deadline)
+		})
+	})
+}
@@ -0,0 +1,109 @@
+package floodwait
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/td/bin"
+
+	"github.com/gotd/contrib/internal/target"
+)
+
+// KeyBy configures which request properties, in addition to request type,
+// identify requests sharing the same flood limit.
+//
+// Per-method waits (FLOOD_WAIT, FLOOD_PREMIUM_WAIT) delay only requests
+// with the same key.
+type KeyBy uint8
+
+const (
+	// KeyByPeer keys requests by target peer, extracted from peer, to_peer
+	// and channel fields of request.
+	KeyByPeer KeyBy = 1 << iota
+	// KeyByDC keys requests by DC ID, set by ContextWithDC.
+	KeyByDC
+)
+
+type dcKey struct{}
+
+// ContextWithDC returns context with DC ID of request, used to key requests
+// if KeyByDC is set.
+//
+// Useful when the same Waiter handles invokers of multiple DCs.
+func ContextWithDC(ctx context.Context, dc int) context.Context {
+	return context.WithValue(ctx, dcKey{}, dc)
+}
+
+func dcFromContext(ctx context.Context) int {
+	dc, _ := ctx.Value(dcKey{}).(int)
+	return dc
+}
+
+// key identifies requests sharing the same flood limit.
+type key struct {
+	typeID uint32
+	peer   target.Peer
+	dc     int
+}
+
+// newKey creates key of given request.
+func newKey(ctx context.Context, input bin.Encoder, by KeyBy) key {
+	var k key
+	if obj, ok := input.(object); ok {
+		k.typeID = obj.TypeID()
+	}
+	if by&KeyByPeer != 0 {
+		k.peer = target.FromRequest(input)
+	}
+	if by&KeyByDC != 0 {
+		k.dc = dcFromContext(ctx)
+	}
+	return k
+}
+
+// String returns string representation of key, used as penalty key.
+//
+// Key of request type only is encoded as decimal TypeID, otherwise
+// TypeID, peer kind, peer ID and DC ID are joined with "_".
+func (k key) String() string {
+	r := strconv.FormatUint(uint64(k.typeID), 10)
+	if k.peer == (target.Peer{}) && k.dc == 0 {
+		return r
+	}
+	return r + "_" +
+		strconv.Itoa(int(k.peer.Kind)) + "_" +
+		strconv.FormatInt(k.peer.ID, 10) + "_" +
+		strconv.Itoa(k.dc)
+}
+
+func (k *key) parse(s string) error {
+	parts := strings.Split(s, "_")
+	if len(parts) != 1 && len(parts) != 4 {
+		return errors.Errorf("invalid key %q", s)
+	}
+
+	typeID, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return errors.Wrap(err, "parse type id")
+	}
+	r := key{typeID: uint32(typeID)}
+	if len(parts) == 4 {
+		kind, err := strconv.ParseUint(parts[1], 10, 8)
+		if err != nil {
+			return errors.Wrap(err, "parse peer kind")
+		}
+		r.peer.Kind = target.Kind(kind)
+		if r.peer.ID, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+			return errors.Wrap(err, "parse peer id")
+		}
+		if r.dc, err = strconv.Atoi(parts[3]); err != nil {
+			return errors.Wrap(err, "parse dc id")
+		}
+	}
+
+	*k = r
+	return nil
+}
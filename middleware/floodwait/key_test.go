@@ -0,0 +1,96 @@
+package floodwait
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/neo"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/internal/target"
+)
+
+func TestNewKey(t *testing.T) {
+	ctx := ContextWithDC(context.Background(), 2)
+	send := &tg.MessagesSendMessageRequest{Peer: &tg.InputPeerUser{UserID: 10}}
+	sendID := send.TypeID()
+
+	tests := []struct {
+		name  string
+		input bin.Encoder
+		by    KeyBy
+		want  key
+	}{
+		{"Type", send, 0, key{typeID: sendID}},
+		{"Peer", send, KeyByPeer, key{typeID: sendID, peer: target.Peer{Kind: target.User, ID: 10}}},
+		{"DC", send, KeyByDC, key{typeID: sendID, dc: 2}},
+		{"PeerDC", send, KeyByPeer | KeyByDC, key{
+			typeID: sendID,
+			peer:   target.Peer{Kind: target.User, ID: 10},
+			dc:     2,
+		}},
+		{"Self", &tg.MessagesSendMessageRequest{Peer: &tg.InputPeerSelf{}}, KeyByPeer, key{
+			typeID: sendID,
+			peer:   target.Peer{Kind: target.Self},
+		}},
+		{"ToPeer", &tg.MessagesForwardMessagesRequest{
+			FromPeer: &tg.InputPeerChat{ChatID: 1},
+			ToPeer:   &tg.InputPeerChannel{ChannelID: 20},
+		}, KeyByPeer, key{
+			typeID: tg.MessagesForwardMessagesRequestTypeID,
+			peer:   target.Peer{Kind: target.Channel, ID: 20},
+		}},
+		{"Channel", &tg.ChannelsEditTitleRequest{
+			Channel: &tg.InputChannel{ChannelID: 30},
+		}, KeyByPeer, key{
+			typeID: tg.ChannelsEditTitleRequestTypeID,
+			peer:   target.Peer{Kind: target.Channel, ID: 30},
+		}},
+		{"NoPeer", &tg.HelpGetConfigRequest{}, KeyByPeer, key{
+			typeID: tg.HelpGetConfigRequestTypeID,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := require.New(t)
+			k := newKey(ctx, tt.input, tt.by)
+			a.Equal(tt.want, k)
+
+			var parsed key
+			a.NoError(parsed.parse(k.String()))
+			a.Equal(k, parsed)
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		var k key
+		for _, s := range []string{"", "1_2", "a", "1_a_2_3", "1_2_a_3", "1_2_3_a"} {
+			require.Error(t, k.parse(s), s)
+		}
+	})
+}
+
+func TestSchedulerPeerKeys(t *testing.T) {
+	a := require.New(t)
+	n := neo.NewTime(time.Now())
+	sch := newScheduler(n, time.Second)
+
+	var (
+		first  = key{typeID: 1, peer: target.Peer{Kind: target.User, ID: 1}}
+		second = key{typeID: 1, peer: target.Peer{Kind: target.User, ID: 2}}
+	)
+	// Flood wait on first peer must not delay requests to second one.
+	sch.flood(&scheduled{request: request{key: first}}, 5*time.Second)
+	sch.schedule(request{key: first})
+	sch.schedule(request{key: second})
+	requests := sch.gather(nil)
+	a.Len(requests, 1)
+	a.Equal(second, requests[0].request.key)
+
+	n.Travel(10*time.Second + time.Millisecond)
+	a.Len(sch.gather(nil), 2)
+}
@@ -0,0 +1,208 @@
+package floodwait
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/atomic"
+
+	"github.com/gotd/td/clock"
+)
+
+// PenaltyStore persists flood wait penalties, so Waiter resumes scheduling
+// with the same delays after restart.
+//
+// Keys are opaque strings identifying a group of requests sharing the same
+// limit, e.g. requests of the same type.
+type PenaltyStore interface {
+	// SavePenalty saves deadline until which requests with given key are delayed.
+	SavePenalty(ctx context.Context, key string, deadline time.Time) error
+	// LoadPenalties returns saved deadlines by key. Deadlines which are
+	// not after now are expired and may be omitted or removed by store.
+	LoadPenalties(ctx context.Context, now time.Time) (map[string]time.Time, error)
+}
+
+// SharedPenaltyStore is a PenaltyStore shared by multiple processes using
+// the same account, like Redis.
+//
+// Instead of loading all penalties on Run, Waiter looks up penalty of every
+// request before scheduling it, so penalties saved by other processes are
+// respected too.
+type SharedPenaltyStore interface {
+	PenaltyStore
+	// Penalty returns deadline until which requests with given key are delayed.
+	Penalty(ctx context.Context, key string) (deadline time.Time, found bool, err error)
+}
+
+const (
+	// penaltyTimeout limits a single penalty store call.
+	penaltyTimeout = time.Second
+	// penaltyBackoff is a time to skip penalty store calls after failure.
+	penaltyBackoff = 5 * time.Second
+	// penaltyCacheTTL is a time to reuse shared penalty looked up from store.
+	penaltyCacheTTL = time.Second
+	// penaltyCacheSize limits number of cached shared penalties.
+	penaltyCacheSize = 1024
+)
+
+// cachedPenalty is a shared penalty looked up from store.
+type cachedPenalty struct {
+	deadline time.Time
+	found    bool
+	expires  time.Time
+}
+
+// penalties wraps PenaltyStore.
+//
+// Store calls are skipped for a while after failure, so an unreachable store
+// does not slow down requests: scheduling falls back to local state. Shared
+// penalties are cached for a short time, and penalties are saved in
+// background by run, so store latency does not delay requests either.
+type penalties struct {
+	store   PenaltyStore
+	shared  SharedPenaltyStore
+	retryAt atomic.Int64
+
+	mux     sync.Mutex
+	cache   map[key]cachedPenalty
+	pending map[key]time.Time
+	saved   chan struct{}
+}
+
+func newPenalties(store PenaltyStore) *penalties {
+	p := &penalties{
+		store:   store,
+		cache:   map[key]cachedPenalty{},
+		pending: map[key]time.Time{},
+		saved:   make(chan struct{}, 1),
+	}
+	p.shared, _ = store.(SharedPenaltyStore)
+	return p
+}
+
+func (p *penalties) available(now time.Time) bool {
+	return now.UnixNano() >= p.retryAt.Load()
+}
+
+// failed handles store call error.
+func (p *penalties) failed(ctx context.Context, now time.Time) {
+	if ctx.Err() != nil {
+		// Caller is gone, store is not to blame.
+		return
+	}
+	p.retryAt.Store(now.Add(penaltyBackoff).UnixNano())
+}
+
+// load returns all saved penalties.
+//
+// Shared penalties are looked up per request, so nothing is loaded for them.
+func (p *penalties) load(ctx context.Context, now time.Time) (map[string]time.Time, error) {
+	if p == nil || p.shared != nil {
+		return nil, nil
+	}
+	return p.store.LoadPenalties(ctx, now)
+}
+
+// save queues penalty deadline to be saved by run.
+func (p *penalties) save(now time.Time, k key, deadline time.Time) {
+	if p == nil {
+		return
+	}
+
+	p.mux.Lock()
+	if d, ok := p.pending[k]; !ok || d.Before(deadline) {
+		p.pending[k] = deadline
+	}
+	if p.shared != nil {
+		p.cache[k] = cachedPenalty{
+			deadline: deadline,
+			found:    true,
+			expires:  now.Add(penaltyCacheTTL),
+		}
+	}
+	p.mux.Unlock()
+
+	select {
+	case p.saved <- struct{}{}:
+	default:
+	}
+}
+
+// run saves queued penalties until ctx is done, reporting errors to onError.
+//
+// Penalties queued before ctx is done are saved anyway, so they survive
+// restart.
+func (p *penalties) run(ctx context.Context, c clock.Clock, onError func(ctx context.Context, err error)) {
+	for {
+		select {
+		case <-p.saved:
+			p.flush(ctx, c, onError)
+		case <-ctx.Done():
+			p.flush(context.WithoutCancel(ctx), c, onError)
+			return
+		}
+	}
+}
+
+// flush saves queued penalties.
+func (p *penalties) flush(ctx context.Context, c clock.Clock, onError func(ctx context.Context, err error)) {
+	p.mux.Lock()
+	pending := p.pending
+	p.pending = map[key]time.Time{}
+	p.mux.Unlock()
+
+	for k, deadline := range pending {
+		now := c.Now()
+		if !p.available(now) || !deadline.After(now) {
+			continue
+		}
+
+		storeCtx, cancel := context.WithTimeout(ctx, penaltyTimeout)
+		err := p.store.SavePenalty(storeCtx, k.String(), deadline)
+		cancel()
+		if err != nil {
+			p.failed(ctx, now)
+			onError(ctx, errors.Wrap(err, "save penalty"))
+		}
+	}
+}
+
+// lookup returns deadline of shared penalty with given key.
+func (p *penalties) lookup(ctx context.Context, now time.Time, k key) (time.Time, bool, error) {
+	if p == nil || p.shared == nil {
+		return time.Time{}, false, nil
+	}
+
+	p.mux.Lock()
+	cached, ok := p.cache[k]
+	p.mux.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.deadline, cached.found && cached.deadline.After(now), nil
+	}
+	if !p.available(now) {
+		return time.Time{}, false, nil
+	}
+
+	storeCtx, cancel := context.WithTimeout(ctx, penaltyTimeout)
+	defer cancel()
+	deadline, found, err := p.shared.Penalty(storeCtx, k.String())
+	if err != nil {
+		p.failed(ctx, now)
+		return time.Time{}, false, errors.Wrap(err, "lookup penalty")
+	}
+
+	p.mux.Lock()
+	if len(p.cache) >= penaltyCacheSize {
+		// Entries expire soon anyway.
+		p.cache = map[key]cachedPenalty{}
+	}
+	p.cache[k] = cachedPenalty{
+		deadline: deadline,
+		found:    found,
+		expires:  now.Add(penaltyCacheTTL),
+	}
+	p.mux.Unlock()
+	return deadline, found && deadline.After(now), nil
+}
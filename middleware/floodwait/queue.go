@@ -9,10 +9,13 @@ import (
 type scheduled struct {
 	request  request
 	sendTime time.Time
-	index    int
+	// index is an index of item in the heap, or -1 if item is not queued.
+	index int
+	// canceled is set if caller is gone, so item must not be queued again.
+	canceled bool
 }
 
-type scheduledHeap []scheduled
+type scheduledHeap []*scheduled
 
 func (r scheduledHeap) Len() int { return len(r) }
 
@@ -28,7 +31,7 @@ func (r scheduledHeap) Swap(i, j int) {
 
 func (r *scheduledHeap) Push(x interface{}) {
 	n := len(*r)
-	item := x.(scheduled)
+	item := x.(*scheduled)
 	item.index = n
 	*r = append(*r, item)
 }
@@ -37,6 +40,7 @@ func (r *scheduledHeap) Pop() interface{} {
 	old := *r
 	n := len(old)
 	item := old[n-1]
+	old[n-1] = nil  // avoid memory leak
 	item.index = -1 // for safety
 	*r = old[0 : n-1]
 	return item
@@ -45,21 +49,82 @@ func (r *scheduledHeap) Pop() interface{} {
 type queue struct {
 	requests    scheduledHeap
 	requestsMux sync.Mutex
+	// wake is signaled when the earliest send time decreases.
+	wake chan struct{}
 }
 
 func newQueue(initialCapacity int) *queue {
 	r := make(scheduledHeap, 0, initialCapacity)
-	return &queue{requests: r}
+	return &queue{
+		requests: r,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (q *queue) add(r request, t time.Time) *scheduled {
+	s := &scheduled{
+		request: r,
+		index:   -1,
+	}
+	q.push(s, t)
+	return s
+}
+
+// push adds item to the queue again, unless it is canceled.
+func (q *queue) push(s *scheduled, t time.Time) {
+	q.requestsMux.Lock()
+	defer q.requestsMux.Unlock()
+
+	if s.canceled {
+		return
+	}
+	s.sendTime = t
+	heap.Push(&q.requests, s)
+	if s.index == 0 {
+		// New earliest item.
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// next returns the earliest send time.
+func (q *queue) next() (time.Time, bool) {
+	q.requestsMux.Lock()
+	defer q.requestsMux.Unlock()
+
+	if len(q.requests) < 1 {
+		return time.Time{}, false
+	}
+	return q.requests[0].sendTime, true
+}
+
+// remove removes canceled item from the queue.
+//
+// Returns false if item is not queued, e.g. it is being sent.
+func (q *queue) remove(s *scheduled) bool {
+	q.requestsMux.Lock()
+	defer q.requestsMux.Unlock()
+
+	s.canceled = true
+	if s.index < 0 {
+		return false
+	}
+	heap.Remove(&q.requests, s.index)
+	return true
 }
 
-func (q *queue) add(r request, t time.Time) {
+// drain removes and returns all queued items.
+func (q *queue) drain() []*scheduled {
 	q.requestsMux.Lock()
 	defer q.requestsMux.Unlock()
 
-	heap.Push(&q.requests, scheduled{
-		request:  r,
-		sendTime: t,
-	})
+	r := make([]*scheduled, 0, len(q.requests))
+	for q.requests.Len() > 0 {
+		r = append(r, heap.Pop(&q.requests).(*scheduled))
+	}
+	return r
 }
 
 func (q *queue) len() int {
@@ -87,7 +152,7 @@ func (q *queue) move(k key, now time.Time, dur time.Duration) {
 	heap.Init(&q.requests)
 }
 
-func (q *queue) gather(now time.Time, req []scheduled) []scheduled {
+func (q *queue) gather(now time.Time, req []*scheduled) []*scheduled {
 	q.requestsMux.Lock()
 	defer q.requestsMux.Unlock()
 
@@ -96,7 +161,7 @@ func (q *queue) gather(now time.Time, req []scheduled) []scheduled {
 			return req
 		}
 
-		next := heap.Pop(&q.requests).(scheduled)
+		next := heap.Pop(&q.requests).(*scheduled)
 		if now.Before(next.sendTime) {
 			heap.Push(&q.requests, next)
 			return req
@@ -104,3 +169,13 @@ func (q *queue) gather(now time.Time, req []scheduled) []scheduled {
 		req = append(req, next)
 	}
 }
+
+// each calls f for every queued item.
+func (q *queue) each(f func(s *scheduled)) {
+	q.requestsMux.Lock()
+	defer q.requestsMux.Unlock()
+
+	for _, s := range q.requests {
+		f(s)
+	}
+}
@@ -14,7 +14,7 @@ func TestQueue(t *testing.T) {
 	now := time.Date(2077, 10, 23, 0, 3, 0, 0, time.UTC)
 	for i := range [10]struct{}{} {
 		q.add(request{
-			key: key(i),
+			key: key{typeID: uint32(i)},
 		}, now.Add(time.Duration(i)*time.Second))
 	}
 
@@ -24,7 +24,7 @@ func TestQueue(t *testing.T) {
 	a.Equal(9, q.len())
 
 	now = now.Add(10 * time.Second)
-	q.move(5, now, 10*time.Second)
+	q.move(key{typeID: 5}, now, 10*time.Second)
 
 	a.Len(q.gather(now, nil), 8)
 	a.Equal(1, q.len())
@@ -32,3 +32,35 @@ func TestQueue(t *testing.T) {
 	a.Len(q.gather(now.Add(10*time.Second), nil), 1)
 	a.Equal(0, q.len())
 }
+
+func TestQueueRemove(t *testing.T) {
+	a := require.New(t)
+
+	q := newQueue(16)
+	now := time.Date(2077, 10, 23, 0, 3, 0, 0, time.UTC)
+	var items []*scheduled
+	for i := range [5]struct{}{} {
+		items = append(items, q.add(request{
+			key: key{typeID: uint32(i)},
+		}, now.Add(time.Duration(i)*time.Second)))
+	}
+
+	a.True(q.remove(items[2]))
+	a.False(q.remove(items[2]))
+	a.Equal(4, q.len())
+
+	// Canceled item must not be queued again.
+	q.push(items[2], now)
+	a.Equal(4, q.len())
+
+	gathered := q.gather(now.Add(time.Minute), nil)
+	a.Len(gathered, 4)
+	for _, s := range gathered {
+		a.NotEqual(items[2], s)
+	}
+	a.False(q.remove(items[0]), "gathered item is not queued")
+
+	q.add(request{}, now)
+	a.Len(q.drain(), 1)
+	a.Zero(q.len())
+}
@@ -2,6 +2,7 @@ package floodwait
 
 import (
 	"context"
+	"time"
 
 	"github.com/gotd/td/bin"
 	"github.com/gotd/td/tg"
@@ -12,14 +13,9 @@ type object interface {
 	TypeID() uint32
 }
 
-type key uint64
-
-func (k *key) fromEncoder(encoder bin.Encoder) {
-	obj, ok := encoder.(object)
-	if !ok {
-		return
-	}
-	*k = key(obj.TypeID())
+// typeNamer is a abstraction for Telegram API object with TypeName.
+type typeNamer interface {
+	TypeName() string
 }
 
 type request struct {
@@ -31,4 +27,15 @@ type request struct {
 
 	retry  int
 	result chan error
+	// waitStart is a time when request was scheduled to wait for sending.
+	waitStart time.Time
+}
+
+// method returns TypeName of request, if available.
+func (r request) method() string {
+	obj, ok := r.input.(typeNamer)
+	if !ok {
+		return ""
+	}
+	return obj.TypeName()
 }
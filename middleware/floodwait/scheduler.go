@@ -5,15 +5,20 @@ import (
 	"sync"
 	"time"
 
+	"go.uber.org/atomic"
+
 	"github.com/gotd/td/bin"
 	"github.com/gotd/td/clock"
 	"github.com/gotd/td/tg"
 )
 
 type scheduler struct {
-	state map[key]time.Duration
-	mux   sync.Mutex
-	queue *queue
+	state  map[key]time.Duration
+	mux    sync.Mutex
+	queue  *queue
+	closed error
+	// totalWait is a total duration of flood waits.
+	totalWait atomic.Int64
 
 	clock clock.Clock
 	dec   time.Duration
@@ -30,9 +35,16 @@ func newScheduler(c clock.Clock, dec time.Duration) *scheduler {
 	}
 }
 
-func (s *scheduler) new(ctx context.Context, input bin.Encoder, output bin.Decoder, next tg.Invoker) <-chan error {
-	var k key
-	k.fromEncoder(input)
+// new schedules new request.
+//
+// Returns error if scheduler is closed.
+func (s *scheduler) new(
+	ctx context.Context,
+	k key,
+	input bin.Encoder,
+	output bin.Decoder,
+	next tg.Invoker,
+) (*scheduled, error) {
 	r := request{
 		ctx:    ctx,
 		input:  input,
@@ -44,25 +56,27 @@ func (s *scheduler) new(ctx context.Context, input bin.Encoder, output bin.Decod
 
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	s.schedule(r)
-	return r.result
+	if s.closed != nil {
+		return nil, s.closed
+	}
+	return s.schedule(r), nil
 }
 
 // schedule adds request to the queue.
 // Assumes the mutex is locked.
-func (s *scheduler) schedule(r request) {
+func (s *scheduler) schedule(r request) *scheduled {
 	k := r.key
 
-	var t time.Time
+	now := s.clock.Now()
+	r.waitStart = now
+	t := now
 	if state, ok := s.state[k]; ok {
-		t = s.clock.Now().Add(state)
-	} else {
-		t = s.clock.Now()
+		t = now.Add(state)
 	}
-	s.queue.add(r, t)
+	return s.queue.add(r, t)
 }
 
-func (s *scheduler) gather(r []scheduled) []scheduled {
+func (s *scheduler) gather(r []*scheduled) []*scheduled {
 	return s.queue.gather(s.clock.Now(), r)
 }
 
@@ -76,23 +90,77 @@ func (s *scheduler) nice(k key) {
 	s.mux.Unlock()
 }
 
-func (s *scheduler) flood(req request, d time.Duration) {
-	k := req.key
+// flood re-schedules request after d and delays future requests of the same
+// type. Returns deadline until which requests of this type are delayed.
+func (s *scheduler) flood(req *scheduled, d time.Duration) time.Time {
+	k := req.request.key
 
 	s.mux.Lock()
 	now := s.clock.Now()
-	if state, ok := s.state[k]; !ok || state < d {
+	state, ok := s.state[k]
+	if !ok || state < d {
+		state = d
 		s.state[k] = d
 	}
-	s.queue.add(req, now.Add(d))
 	s.mux.Unlock()
 
+	// Delay queued requests of the same type before pushing this one, so
+	// it is not delayed twice.
 	s.queue.move(k, now, d)
+	s.queue.push(req, now.Add(d))
+	return now.Add(state)
+}
+
+// restore restores per-type state from saved penalty deadline.
+func (s *scheduler) restore(k key, deadline time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	d := deadline.Sub(s.clock.Now())
+	if d <= 0 {
+		return
+	}
+	if state, ok := s.state[k]; !ok || state < d {
+		s.state[k] = d
+	}
 }
 
 // retry re-schedules a single request after d without updating the per-type
 // state. It is used for chat- or operation-specific waits (e.g. SLOWMODE_WAIT)
 // that must not throttle unrelated requests of the same type.
-func (s *scheduler) retry(req request, d time.Duration) {
-	s.queue.add(req, s.clock.Now().Add(d))
+func (s *scheduler) retry(req *scheduled, d time.Duration) {
+	s.queue.push(req, s.clock.Now().Add(d))
+}
+
+// cancel removes request of canceled caller from the queue.
+func (s *scheduler) cancel(req *scheduled) {
+	s.queue.remove(req)
+}
+
+// open allows scheduling of new requests.
+func (s *scheduler) open() {
+	s.mux.Lock()
+	s.closed = nil
+	s.mux.Unlock()
+}
+
+// close rejects new requests with given error and fails every queued one.
+func (s *scheduler) close(err error) {
+	s.mux.Lock()
+	s.closed = err
+	s.mux.Unlock()
+
+	for _, req := range s.queue.drain() {
+		select {
+		case req.request.result <- err:
+		default:
+		}
+	}
+}
+
+// penalties returns number of keys with active per-type penalty.
+func (s *scheduler) penalties() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.state)
 }
@@ -15,12 +15,14 @@ func TestScheduler(t *testing.T) {
 	sch := newScheduler(n, time.Second)
 
 	r := request{
-		key: 1,
+		key: key{typeID: 1},
 	}
-	// Schedule request.
+	// Schedule and send request.
 	sch.schedule(r)
+	sent := sch.gather(nil)
+	a.Len(sent, 1)
 	// Got flood wait.
-	sch.flood(r, 5*time.Second)
+	sch.flood(sent[0], 5*time.Second)
 	// Ensure that request re-scheduled.
 	a.Empty(sch.gather(nil))
 
@@ -29,12 +31,30 @@ func TestScheduler(t *testing.T) {
 	a.Len(sch.gather(nil), 1)
 
 	// Decrease wait timeout.
-	sch.nice(1)
+	sch.nice(key{typeID: 1})
 	// Schedule yet one
 	sch.schedule(request{
-		key: 1,
+		key: key{typeID: 1},
 	})
 	// Ensure that timer decreased correctly.
 	n.Travel(4*time.Second + time.Millisecond)
 	a.Len(sch.gather(nil), 1)
 }
+
+func TestSchedulerRestore(t *testing.T) {
+	a := require.New(t)
+	n := neo.NewTime(time.Now())
+	sch := newScheduler(n, time.Second)
+
+	// Expired penalty is ignored.
+	sch.restore(key{typeID: 1}, n.Now().Add(-time.Second))
+	sch.schedule(request{key: key{typeID: 1}})
+	a.Len(sch.gather(nil), 1)
+
+	sch.restore(key{typeID: 1}, n.Now().Add(5*time.Second))
+	sch.schedule(request{key: key{typeID: 1}})
+	a.Empty(sch.gather(nil))
+
+	n.Travel(5*time.Second + time.Millisecond)
+	a.Len(sch.gather(nil), 1)
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/gotd/td/clock"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/internal/tracehook"
 )
 
 // SimpleWaiter is a tg.Invoker that handles flood wait errors on underlying invoker.
@@ -95,6 +97,7 @@ func (w *SimpleWaiter) Handle(next tg.Invoker) telegram.InvokeFunc {
 				return errors.Wrapf(err, "flood wait argument is too big (%v > %v)", d, v)
 			}
 
+			start := w.clock.Now()
 			if t == nil {
 				t = w.clock.Timer(d)
 			} else {
@@ -103,9 +106,11 @@ func (w *SimpleWaiter) Handle(next tg.Invoker) telegram.InvokeFunc {
 			}
 			select {
 			case <-t.C():
+				tracehook.Span(ctx, "tg.floodwait", start, w.clock.Now())
 				continue
 			case <-ctx.Done():
 				clock.StopTimer(t)
+				tracehook.Span(ctx, "tg.floodwait", start, w.clock.Now())
 				return ctx.Err()
 			}
 		}
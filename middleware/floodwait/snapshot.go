@@ -0,0 +1,54 @@
+package floodwait
+
+import (
+	"sort"
+	"time"
+)
+
+// Pending is a request waiting to be sent by Waiter.
+type Pending struct {
+	// Method is a TypeName of request, e.g. "messages.sendMessage".
+	Method string
+	// Key identifies requests sharing the same limit.
+	Key string
+	// Attempt is a number of failed attempts.
+	Attempt int
+	// ETA is a time request is scheduled to be sent at.
+	ETA time.Time
+}
+
+// Snapshot returns requests waiting to be sent, ordered by ETA.
+func (w *Waiter) Snapshot() []Pending {
+	var r []Pending
+	w.sch.queue.each(func(s *scheduled) {
+		r = append(r, Pending{
+			Method:  s.request.method(),
+			Key:     s.request.key.String(),
+			Attempt: s.request.retry,
+			ETA:     s.sendTime,
+		})
+	})
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].ETA.Before(r[j].ETA)
+	})
+	return r
+}
+
+// Stats is a snapshot of Waiter statistics.
+type Stats struct {
+	// Queued is a number of requests waiting to be sent.
+	Queued int
+	// Penalties is a number of keys with active per-method penalty.
+	Penalties int
+	// TotalWait is a total duration of waits reported by server.
+	TotalWait time.Duration
+}
+
+// Stats returns current statistics of Waiter.
+func (w *Waiter) Stats() Stats {
+	return Stats{
+		Queued:    w.sch.queue.len(),
+		Penalties: w.sch.penalties(),
+		TotalWait: time.Duration(w.sch.totalWait.Load()),
+	}
+}
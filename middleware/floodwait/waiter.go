@@ -10,13 +10,15 @@ import (
 
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
 
 	"github.com/gotd/td/bin"
 	"github.com/gotd/td/clock"
+
+	"github.com/gotd/contrib/internal/tracehook"
 )
 
 const (
-	defaultTick       = time.Millisecond
 	defaultMaxWait    = time.Minute
 	defaultMaxRetries = 5
 )
@@ -34,15 +36,36 @@ type Waiter struct {
 	sch   *scheduler
 
 	running    atomic.Bool
-	tick       time.Duration
 	maxWait    time.Duration
 	maxRetries int
 	onWait     func(ctx context.Context, wait FloodWait)
+	onError    func(ctx context.Context, err error)
+	penalties  *penalties
+	keyBy      KeyBy
 }
 
+// ErrNotRunning is returned by Waiter if Run is not called or exited.
+//
+// Requests queued when Run exits fail with this error too.
+var ErrNotRunning = errors.New("the Waiter middleware is not running: Run(ctx) method is not called or exited")
+
 // FloodWait event.
 type FloodWait struct {
+	// Duration is a wait duration reported by server.
 	Duration time.Duration
+	// Method is a TypeName of request, e.g. "messages.sendMessage".
+	Method string
+	// Type is a type of wait error, e.g. FLOOD_WAIT, FLOOD_PREMIUM_WAIT or SLOWMODE_WAIT.
+	Type string
+	// Key identifies requests sharing the same limit, like penalty key of
+	// PenaltyStore.
+	Key string
+	// Attempt is a number of the failed attempt, starting from 1.
+	Attempt int
+	// Scheduled is a time request is scheduled to be retried at.
+	//
+	// Zero if request is not retried because of retry limits.
+	Scheduled time.Time
 }
 
 // NewWaiter returns a new invoker that waits on the flood wait errors.
@@ -59,10 +82,10 @@ func NewWaiter() *Waiter {
 	return &Waiter{
 		clock:      clock.System,
 		sch:        newScheduler(clock.System, time.Second),
-		tick:       defaultTick,
 		maxWait:    defaultMaxWait,
 		maxRetries: defaultMaxRetries,
 		onWait:     func(ctx context.Context, wait FloodWait) {},
+		onError:    func(ctx context.Context, err error) {},
 	}
 }
 
@@ -78,17 +101,23 @@ func (w *Waiter) clone() *Waiter {
 	return &Waiter{
 		clock:      w.clock,
 		sch:        w.sch,
-		tick:       w.tick,
 		maxWait:    w.maxWait,
 		maxRetries: w.maxRetries,
 		onWait:     w.onWait,
+		onError:    w.onError,
+		penalties:  w.penalties,
+		keyBy:      w.keyBy,
 	}
 }
 
 // WithClock sets clock to use. Default is to use system clock.
+//
+// Returned waiter uses new scheduler, so it should be set before other
+// options and must be run separately.
 func (w *Waiter) WithClock(c clock.Clock) *Waiter {
 	w = w.clone()
 	w.clock = c
+	w.sch = newScheduler(c, w.sch.dec)
 	return w
 }
 
@@ -109,18 +138,84 @@ func (w *Waiter) WithMaxRetries(m int) *Waiter {
 	return w
 }
 
-// WithTick sets gather tick interval for Waiter. Default is 1ms.
-func (w *Waiter) WithTick(t time.Duration) *Waiter {
+// WithTick does nothing.
+//
+// Deprecated: Waiter sleeps until the earliest request is due, there is no
+// gather tick anymore.
+func (w *Waiter) WithTick(time.Duration) *Waiter {
+	return w.clone()
+}
+
+// WithKeyBy sets request properties to key flood limits by. Default is to
+// key only by request type, so FLOOD_WAIT on a method delays all requests
+// of that method.
+//
+// For example, KeyByPeer makes FLOOD_WAIT on messages.sendMessage to one
+// chat delay only sends to that chat.
+func (w *Waiter) WithKeyBy(k KeyBy) *Waiter {
 	w = w.clone()
-	if t <= 0 {
-		t = time.Nanosecond
-	}
-	w.tick = t
+	w.keyBy = k
 	return w
 }
 
+// WithPenaltyErrorHandler sets handler of penalty store errors, e.g. to log
+// them. Store errors do not fail requests or Run. Default is to ignore them.
+func (w *Waiter) WithPenaltyErrorHandler(f func(ctx context.Context, err error)) *Waiter {
+	w = w.clone()
+	w.onError = f
+	return w
+}
+
+// WithPenaltyStore sets store to persist per-method flood wait penalties.
+//
+// Penalties are saved in background and loaded on Run, so requests are
+// delayed the same way after restart. If store implements SharedPenaltyStore,
+// penalties are looked up before scheduling every request instead, so
+// processes sharing the store respect each other's penalties. Looked up
+// penalties are cached for a second.
+//
+// Store is best-effort: its errors do not fail requests or Run, and after
+// failure store is not used for a few seconds, falling back to local
+// scheduling. Use WithPenaltyErrorHandler to observe store errors.
+// Default is to keep penalties only in memory.
+func (w *Waiter) WithPenaltyStore(s PenaltyStore) *Waiter {
+	w = w.clone()
+	w.penalties = newPenalties(s)
+	return w
+}
+
+// penaltyError reports penalty store error, if any.
+func (w *Waiter) penaltyError(ctx context.Context, err error) {
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+	w.onError(ctx, err)
+}
+
+// loadPenalties restores scheduler state from penalty store.
+//
+// Loading is best-effort: penalties with invalid keys are skipped, and
+// scheduling starts from scratch if store fails.
+func (w *Waiter) loadPenalties(ctx context.Context) {
+	penalties, err := w.penalties.load(ctx, w.clock.Now())
+	if err != nil {
+		w.penaltyError(ctx, errors.Wrap(err, "load penalties"))
+		return
+	}
+	for s, deadline := range penalties {
+		var k key
+		if err := k.parse(s); err != nil {
+			w.penaltyError(ctx, errors.Wrapf(err, "parse penalty key %q", s))
+			continue
+		}
+		w.sch.restore(k, deadline)
+	}
+}
+
 // Run runs send loop.
 //
+// Requests still queued when Run exits fail with ErrNotRunning.
+//
 // Example:
 //
 //	if err := waiter.Run(ctx, func(ctx context.Context) error {
@@ -130,8 +225,15 @@ func (w *Waiter) WithTick(t time.Duration) *Waiter {
 //		return errors.Wrap(err, "run client")
 //	}
 func (w *Waiter) Run(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	w.loadPenalties(ctx)
+
+	w.sch.open()
 	w.running.Store(true)
-	defer w.running.Store(false)
+	defer func() {
+		w.running.Store(false)
+		// Fail requests which will never be sent.
+		w.sch.close(ErrNotRunning)
+	}()
 
 	ctx, cancel := context.WithCancel(ctx)
 	wg, ctx := errgroup.WithContext(ctx)
@@ -139,29 +241,50 @@ func (w *Waiter) Run(ctx context.Context, f func(ctx context.Context) error) (er
 		defer cancel()
 		return f(ctx)
 	})
+	if w.penalties != nil {
+		wg.Go(func() error {
+			w.penalties.run(ctx, w.clock, w.penaltyError)
+			return nil
+		})
+	}
 	wg.Go(func() error {
-		ticker := w.clock.Ticker(w.tick)
-		defer ticker.Stop()
+		timer := w.clock.Timer(0)
+		clock.StopTimer(timer)
 
-		var requests []scheduled
+		var requests []*scheduled
 		for {
-			select {
-			case <-ticker.C():
-				requests = w.sch.gather(requests[:0])
-				if len(requests) < 1 {
-					continue
+			requests = w.sch.gather(requests[:0])
+			for _, s := range requests {
+				ret, err := w.send(s)
+				if ret {
+					select {
+					case s.request.result <- err:
+					default:
+					}
 				}
+			}
 
-				for _, s := range requests {
-					ret, err := w.send(s)
-					if ret {
-						select {
-						case s.request.result <- err:
-						default:
-						}
-					}
+			// Sleep until the earliest request is due or new one is scheduled.
+			var due <-chan time.Time
+			if t, ok := w.sch.queue.next(); ok {
+				d := t.Sub(w.clock.Now())
+				if d <= 0 {
+					// Became due while sending.
+					continue
 				}
+				timer.Reset(d)
+				due = timer.C()
+			}
+			select {
+			case <-due:
+				continue
+			case <-w.sch.queue.wake:
 			case <-ctx.Done():
+			}
+			if due != nil {
+				clock.StopTimer(timer)
+			}
+			if ctx.Err() != nil {
 				return nil
 			}
 		}
@@ -170,7 +293,15 @@ func (w *Waiter) Run(ctx context.Context, f func(ctx context.Context) error) (er
 	return wg.Wait()
 }
 
-func (w *Waiter) send(s scheduled) (bool, error) {
+func (w *Waiter) send(s *scheduled) (bool, error) {
+	if err := s.request.ctx.Err(); err != nil {
+		// Caller is gone.
+		return true, err
+	}
+	if s.sendTime.After(s.request.waitStart) {
+		// Request was delayed by flood wait.
+		tracehook.Span(s.request.ctx, "tg.floodwait", s.request.waitStart, w.clock.Now())
+	}
 	err := s.request.next.Invoke(s.request.ctx, s.request.input, s.request.output)
 
 	// Detect flood wait and similar retriable wait errors, mirroring TDLib.
@@ -180,29 +311,42 @@ func (w *Waiter) send(s scheduled) (bool, error) {
 		return true, err
 	}
 
-	// Notify about flood wait.
-	w.onWait(s.request.ctx, FloodWait{
-		Duration: d,
-	})
-
 	s.request.retry++
 
-	if v := w.maxRetries; v != 0 && s.request.retry > v {
-		return true, errors.Wrapf(err, "flood wait retry limit exceeded (%d > %d)", s.request.retry, v)
+	wait := FloodWait{
+		Duration: d,
+		Method:   s.request.method(),
+		Key:      s.request.key.String(),
+		Attempt:  s.request.retry,
 	}
-
-	if v := w.maxWait; v != 0 && d > v {
-		return true, errors.Wrapf(err, "flood wait argument is too big (%v > %v)", d, v)
+	if rpcErr, ok := tgerr.As(err); ok {
+		wait.Type = rpcErr.Type
 	}
 
-	if perType {
+	switch {
+	case w.maxRetries != 0 && s.request.retry > w.maxRetries:
+		err = errors.Wrapf(err, "flood wait retry limit exceeded (%d > %d)", s.request.retry, w.maxRetries)
+	case w.maxWait != 0 && d > w.maxWait:
+		err = errors.Wrapf(err, "flood wait argument is too big (%v > %v)", d, w.maxWait)
+	case perType:
+		w.sch.totalWait.Add(int64(d))
+		s.request.waitStart = w.clock.Now()
 		// Per-method rate limit: proactively delay future requests of this type.
-		w.sch.flood(s.request, d)
-	} else {
+		deadline := w.sch.flood(s, d)
+		w.penalties.save(w.clock.Now(), s.request.key, deadline)
+		wait.Scheduled, err = s.sendTime, nil
+	default:
+		w.sch.totalWait.Add(int64(d))
+		s.request.waitStart = w.clock.Now()
 		// Chat- or operation-specific wait: retry only this request.
-		w.sch.retry(s.request, d)
+		w.sch.retry(s, d)
+		wait.Scheduled, err = s.sendTime, nil
 	}
-	return false, nil
+
+	// Notify about flood wait.
+	w.onWait(s.request.ctx, wait)
+
+	return err != nil, err
 }
 
 // Handle implements telegram.Middleware.
@@ -210,12 +354,26 @@ func (w *Waiter) Handle(next tg.Invoker) telegram.InvokeFunc {
 	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
 		if !w.running.Load() {
 			// Return explicit error if waiter is not running.
-			return errors.New("the Waiter middleware is not running: Run(ctx) method is not called or exited")
+			return ErrNotRunning
 		}
+		k := newKey(ctx, input, w.keyBy)
+		deadline, ok, err := w.penalties.lookup(ctx, w.clock.Now(), k)
+		w.penaltyError(ctx, err)
+		if ok {
+			// Penalty of another process sharing the store.
+			w.sch.restore(k, deadline)
+		}
+
+		s, err := w.sch.new(ctx, k, input, output, next)
+		if err != nil {
+			return err
+		}
+
 		select {
-		case err := <-w.sch.new(ctx, input, output, next):
+		case err := <-s.request.result:
 			return err
 		case <-ctx.Done():
+			w.sch.cancel(s)
 			return ctx.Err()
 		}
 	}
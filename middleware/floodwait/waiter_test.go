@@ -0,0 +1,510 @@
+package floodwait
+
+import (
+	"context"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+
+	"go.uber.org/atomic"
+
+	"github.com/gotd/neo"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+
+	"github.com/gotd/contrib/internal/tracehook"
+)
+
+type memPenalties struct {
+	data    map[string]time.Time
+	loadErr error
+	mux     sync.Mutex
+}
+
+func (m *memPenalties) SavePenalty(ctx context.Context, key string, deadline time.Time) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.data[key] = deadline
+	return nil
+}
+
+func (m *memPenalties) LoadPenalties(ctx context.Context, now time.Time) (map[string]time.Time, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.loadErr != nil {
+		return nil, m.loadErr
+	}
+	r := map[string]time.Time{}
+	for k, v := range m.data {
+		if v.After(now) {
+			r[k] = v
+		}
+	}
+	return r, nil
+}
+
+func (m *memPenalties) get(k string) (time.Time, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	v, ok := m.data[k]
+	return v, ok
+}
+
+type sharedPenalties struct {
+	memPenalties
+	err     error
+	lookups atomic.Int64
+}
+
+func (m *sharedPenalties) Penalty(ctx context.Context, key string) (time.Time, bool, error) {
+	m.lookups.Inc()
+	if m.err != nil {
+		return time.Time{}, false, m.err
+	}
+	v, ok := m.get(key)
+	return v, ok, nil
+}
+
+type invokeFunc func(ctx context.Context, input bin.Encoder, output bin.Decoder) error
+
+func (f invokeFunc) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	return f(ctx, input, output)
+}
+
+func TestWaiterPenaltyStore(t *testing.T) {
+	var (
+		input = &tg.MessagesSendMessageRequest{}
+		k     = key{typeID: input.TypeID()}.String()
+	)
+
+	run := func(t *testing.T, w *Waiter, f func(ctx context.Context)) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		require.NoError(t, w.Run(ctx, func(ctx context.Context) error {
+			f(ctx)
+			return nil
+		}))
+	}
+
+	t.Run("Save", func(t *testing.T) {
+		a := require.New(t)
+		store := &memPenalties{data: map[string]time.Time{}}
+		w := NewWaiter().WithMaxWait(0).WithPenaltyStore(store)
+		invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			return tgerr.New(420, "FLOOD_WAIT_3600")
+		}))
+
+		start := time.Now()
+		run(t, w, func(ctx context.Context) {
+			ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+
+			a.ErrorIs(invoker.Invoke(ctx, input, nil), context.DeadlineExceeded)
+		})
+
+		deadline, ok := store.get(k)
+		a.True(ok)
+		a.WithinDuration(start.Add(time.Hour), deadline, time.Minute)
+	})
+	t.Run("Load", func(t *testing.T) {
+		a := require.New(t)
+		store := &memPenalties{data: map[string]time.Time{
+			k: time.Now().Add(time.Hour),
+		}}
+		w := NewWaiter().WithPenaltyStore(store)
+
+		var calls int
+		invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			calls++
+			return nil
+		}))
+
+		run(t, w, func(ctx context.Context) {
+			ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+
+			// Request must be delayed by restored penalty.
+			a.ErrorIs(invoker.Invoke(ctx, input, nil), context.DeadlineExceeded)
+		})
+		a.Zero(calls)
+	})
+	t.Run("LoadInvalid", func(t *testing.T) {
+		a := require.New(t)
+		store := &memPenalties{data: map[string]time.Time{
+			k:     time.Now().Add(time.Hour),
+			"bad": time.Now().Add(time.Hour),
+		}}
+		var errs []error
+		w := NewWaiter().WithPenaltyStore(store).WithPenaltyErrorHandler(func(ctx context.Context, err error) {
+			errs = append(errs, err)
+		})
+		invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			return nil
+		}))
+
+		run(t, w, func(ctx context.Context) {
+			ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+
+			// Valid penalties are restored.
+			a.ErrorIs(invoker.Invoke(ctx, input, nil), context.DeadlineExceeded)
+		})
+		a.Len(errs, 1)
+	})
+	t.Run("LoadFailed", func(t *testing.T) {
+		a := require.New(t)
+		loadErr := errors.New("unavailable")
+		store := &memPenalties{data: map[string]time.Time{}, loadErr: loadErr}
+		var errs []error
+		w := NewWaiter().WithPenaltyStore(store).WithPenaltyErrorHandler(func(ctx context.Context, err error) {
+			errs = append(errs, err)
+		})
+		invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			return nil
+		}))
+
+		run(t, w, func(ctx context.Context) {
+			a.NoError(invoker.Invoke(ctx, input, nil))
+		})
+		a.Len(errs, 1)
+		a.ErrorIs(errs[0], loadErr)
+	})
+	t.Run("Shared", func(t *testing.T) {
+		a := require.New(t)
+		store := &sharedPenalties{memPenalties: memPenalties{data: map[string]time.Time{}}}
+		n := neo.NewTime(time.Now())
+		w := NewWaiter().WithClock(n).WithPenaltyStore(store)
+
+		var calls atomic.Int64
+		invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			calls.Inc()
+			return nil
+		}))
+
+		run(t, w, func(ctx context.Context) {
+			// No penalty yet.
+			a.NoError(invoker.Invoke(ctx, input, nil))
+			// Lookup is cached.
+			a.NoError(invoker.Invoke(ctx, input, nil))
+			a.Equal(int64(1), store.lookups.Load())
+
+			// Penalty saved by another process.
+			a.NoError(store.SavePenalty(ctx, k, n.Now().Add(time.Hour)))
+			n.Travel(penaltyCacheTTL)
+			timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+			a.ErrorIs(invoker.Invoke(timeoutCtx, input, nil), context.DeadlineExceeded)
+		})
+		a.Equal(int64(2), calls.Load())
+	})
+	t.Run("Unavailable", func(t *testing.T) {
+		a := require.New(t)
+		store := &sharedPenalties{
+			memPenalties: memPenalties{data: map[string]time.Time{}},
+			err:          errors.New("unavailable"),
+		}
+		w := NewWaiter().WithPenaltyStore(store)
+		invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			return nil
+		}))
+
+		run(t, w, func(ctx context.Context) {
+			// Local scheduling must work without store.
+			a.NoError(invoker.Invoke(ctx, input, nil))
+			a.NoError(invoker.Invoke(ctx, input, nil))
+		})
+	})
+}
+
+func TestWaiterCancel(t *testing.T) {
+	a := require.New(t)
+	w := NewWaiter()
+	input := &tg.MessagesSendMessageRequest{}
+	// Delay all requests.
+	w.sch.restore(key{typeID: input.TypeID()}, time.Now().Add(time.Hour))
+
+	var calls atomic.Int64
+	invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		calls.Inc()
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	queued := make(chan struct{})
+	result := make(chan error, 1)
+	a.NoError(w.Run(ctx, func(ctx context.Context) error {
+		// Canceled request must be removed from queue.
+		reqCtx, reqCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer reqCancel()
+		a.ErrorIs(invoker.Invoke(reqCtx, input, nil), context.DeadlineExceeded)
+		a.Zero(w.sch.queue.len())
+
+		// Pending request must fail on shutdown.
+		go func() {
+			result <- invoker.Invoke(context.Background(), input, nil)
+		}()
+		go func() {
+			for w.sch.queue.len() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			close(queued)
+		}()
+		<-queued
+		return nil
+	}))
+
+	select {
+	case err := <-result:
+		a.ErrorIs(err, ErrNotRunning)
+	case <-ctx.Done():
+		t.Fatal("pending request is not failed on shutdown")
+	}
+	a.Zero(calls.Load())
+
+	// Requests are rejected after shutdown.
+	a.ErrorIs(invoker.Invoke(ctx, input, nil), ErrNotRunning)
+}
+
+func TestWaiterObservability(t *testing.T) {
+	a := require.New(t)
+	input := &tg.MessagesSendMessageRequest{}
+
+	n := neo.NewTime(time.Now())
+	waits := make(chan FloodWait, 1)
+	w := NewWaiter().WithClock(n).WithMaxWait(0).WithCallback(func(ctx context.Context, wait FloodWait) {
+		waits <- wait
+	})
+	invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		return tgerr.New(420, "FLOOD_WAIT_3600")
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := n.Now()
+	a.NoError(w.Run(ctx, func(ctx context.Context) error {
+		go func() {
+			_ = invoker.Invoke(ctx, input, nil)
+		}()
+
+		var wait FloodWait
+		select {
+		case wait = <-waits:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		a.Equal(time.Hour, wait.Duration)
+		a.Equal("messages.sendMessage", wait.Method)
+		a.Equal("FLOOD_WAIT", wait.Type)
+		a.Equal(key{typeID: input.TypeID()}.String(), wait.Key)
+		a.Equal(1, wait.Attempt)
+		a.Equal(start.Add(time.Hour), wait.Scheduled)
+
+		// Wait for request to be re-scheduled.
+		for w.Stats().Queued == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		a.Equal(Stats{
+			Queued:    1,
+			Penalties: 1,
+			TotalWait: time.Hour,
+		}, w.Stats())
+
+		pending := w.Snapshot()
+		a.Len(pending, 1)
+		a.Equal("messages.sendMessage", pending[0].Method)
+		a.Equal(wait.Key, pending[0].Key)
+		a.Equal(1, pending[0].Attempt)
+		a.Equal(wait.Scheduled, pending[0].ETA)
+		return nil
+	}))
+}
+
+func TestWaiterTotalWait(t *testing.T) {
+	a := require.New(t)
+	input := &tg.MessagesSendMessageRequest{}
+
+	w := NewWaiter().WithMaxWait(time.Minute)
+	invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		return tgerr.New(420, "FLOOD_WAIT_3600")
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.NoError(w.Run(ctx, func(ctx context.Context) error {
+		a.True(tgerr.Is(invoker.Invoke(ctx, input, nil), "FLOOD_WAIT"))
+		return nil
+	}))
+	// Request is not retried, so nothing is waited.
+	a.Zero(w.Stats().TotalWait)
+}
+
+func TestWaiterTrace(t *testing.T) {
+	a := require.New(t)
+	w := NewWaiter()
+	input := &tg.MessagesSendMessageRequest{}
+	// Delay requests by penalty.
+	w.sch.restore(key{typeID: input.TypeID()}, time.Now().Add(20*time.Millisecond))
+
+	invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var spans []string
+	a.NoError(w.Run(ctx, func(ctx context.Context) error {
+		ctx = tracehook.With(ctx, func(ctx context.Context, name string, start, end time.Time) {
+			a.True(end.After(start))
+			spans = append(spans, name)
+		})
+		a.NoError(invoker.Invoke(ctx, input, nil))
+		// Not delayed.
+		a.NoError(invoker.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil))
+		return nil
+	}))
+	a.Equal([]string{"tg.floodwait"}, spans)
+}
+
+func TestWaiterTimer(t *testing.T) {
+	a := require.New(t)
+	n := neo.NewTime(time.Now())
+	w := NewWaiter().WithClock(n)
+	input := &tg.MessagesSendMessageRequest{}
+	w.sch.restore(key{typeID: input.TypeID()}, n.Now().Add(5*time.Second))
+
+	var calls atomic.Int64
+	invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		calls.Inc()
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.NoError(w.Run(ctx, func(ctx context.Context) error {
+		result := make(chan error, 1)
+		go func() {
+			result <- invoker.Invoke(ctx, input, nil)
+		}()
+		for w.Stats().Queued == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		n.Travel(4 * time.Second)
+		time.Sleep(10 * time.Millisecond)
+		a.Zero(calls.Load(), "request sent before it is due")
+
+		n.Travel(time.Second)
+		select {
+		case err := <-result:
+			a.NoError(err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		a.Equal(int64(1), calls.Load())
+		return nil
+	}))
+}
+
+// userCPU returns user CPU time of the process, estimated by runtime.
+func userCPU() time.Duration {
+	// CPU metrics are updated by GC.
+	runtime.GC()
+	sample := []metrics.Sample{{Name: "/cpu/classes/user:cpu-seconds"}}
+	metrics.Read(sample)
+	return time.Duration(sample[0].Value.Float64() * float64(time.Second))
+}
+
+func BenchmarkWaiter(b *testing.B) {
+	b.Run("Idle", func(b *testing.B) {
+		// Many idle waiters should not consume CPU.
+		const waiters = 100
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		for range [waiters]struct{}{} {
+			w := NewWaiter()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = w.Run(ctx, func(ctx context.Context) error {
+					<-ctx.Done()
+					return nil
+				})
+			}()
+		}
+
+		start := userCPU()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		b.StopTimer()
+		b.ReportMetric(float64(userCPU()-start)/float64(b.N), "cpu-ns/op")
+
+		cancel()
+		wg.Wait()
+	})
+	b.Run("Loaded", func(b *testing.B) {
+		w := NewWaiter()
+		invoker := w.Handle(invokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			return nil
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan error, 1)
+		go func() {
+			done <- w.Run(ctx, func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			})
+		}()
+		for !w.running.Load() {
+			time.Sleep(time.Millisecond)
+		}
+
+		input := &tg.MessagesSendMessageRequest{}
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if err := invoker.Invoke(ctx, input, nil); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+		b.StopTimer()
+
+		cancel()
+		if err := <-done; err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+func TestWaiterWithClock(t *testing.T) {
+	a := require.New(t)
+	w := NewWaiter()
+	n := neo.NewTime(time.Now())
+	w.WithClock(n)
+	a.Equal(clock.System, w.clock)
+	a.Equal(clock.System, w.sch.clock)
+}
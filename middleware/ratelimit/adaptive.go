@@ -0,0 +1,220 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	defaultDecrease = 0.5
+	// defaultIncreaseSteps is a number of successful requests to raise
+	// rate from zero to ceiling by default.
+	defaultIncreaseSteps = 100
+)
+
+// isFloodWait reports whether err is a per-method flood wait, i.e. every
+// request of the same type is throttled.
+func isFloodWait(err error) bool {
+	rpcErr, ok := tgerr.As(err)
+	if !ok || rpcErr.Code != 420 {
+		return false
+	}
+	return rpcErr.IsOneOf(tgerr.ErrFloodWait, tgerr.ErrPremiumFloodWait)
+}
+
+// adaptiveLimit is a per-method state of AdaptiveLimiter.
+type adaptiveLimit struct {
+	lim *rate.Limiter
+	// cut is the time of the last decrease.
+	cut time.Time
+}
+
+// adaptiveState is a state shared by AdaptiveLimiter copies.
+type adaptiveState struct {
+	mux     sync.Mutex
+	methods map[string]*adaptiveLimit
+}
+
+// AdaptiveLimiter is a tg.Invoker that throttles RPC calls on underlying
+// invoker, adapting rate of every method to flood wait errors.
+//
+// Rate of a method starts at ceiling. FLOOD_WAIT or FLOOD_PREMIUM_WAIT
+// multiplies it by decrease factor, and every successful request raises it
+// by increase step, like AIMD congestion control. Rate is kept between
+// floor and ceiling.
+//
+// AdaptiveLimiter does not retry requests, use floodwait middleware for it.
+type AdaptiveLimiter struct {
+	clock    clock.Clock
+	floor    rate.Limit
+	ceiling  rate.Limit
+	burst    int
+	decrease float64
+	increase rate.Limit
+
+	state *adaptiveState
+}
+
+// NewAdaptiveLimiter returns a new invoker rate limiter which keeps rate of
+// every method between floor and ceiling.
+func NewAdaptiveLimiter(floor, ceiling rate.Limit, burst int) *AdaptiveLimiter {
+	return &AdaptiveLimiter{
+		clock:    clock.System,
+		floor:    floor,
+		ceiling:  ceiling,
+		burst:    burst,
+		decrease: defaultDecrease,
+		increase: ceiling / defaultIncreaseSteps,
+		state: &adaptiveState{
+			methods: map[string]*adaptiveLimit{},
+		},
+	}
+}
+
+// clone returns a copy of the AdaptiveLimiter.
+func (l *AdaptiveLimiter) clone() *AdaptiveLimiter {
+	return &AdaptiveLimiter{
+		clock:    l.clock,
+		floor:    l.floor,
+		ceiling:  l.ceiling,
+		burst:    l.burst,
+		decrease: l.decrease,
+		increase: l.increase,
+		state:    l.state,
+	}
+}
+
+// WithClock sets clock to use. Default is to use system clock.
+func (l *AdaptiveLimiter) WithClock(c clock.Clock) *AdaptiveLimiter {
+	l = l.clone()
+	l.clock = c
+	return l
+}
+
+// WithDecrease sets factor to multiply rate by on flood wait. Default is 0.5.
+func (l *AdaptiveLimiter) WithDecrease(f float64) *AdaptiveLimiter {
+	l = l.clone()
+	l.decrease = f
+	return l
+}
+
+// WithIncrease sets step to raise rate by on successful request. Default is
+// a hundredth of ceiling.
+func (l *AdaptiveLimiter) WithIncrease(step rate.Limit) *AdaptiveLimiter {
+	l = l.clone()
+	l.increase = step
+	return l
+}
+
+// Limit returns current rate of given method, e.g. "messages.sendMessage".
+func (l *AdaptiveLimiter) Limit(method string) rate.Limit {
+	l.state.mux.Lock()
+	defer l.state.mux.Unlock()
+
+	m, ok := l.state.methods[method]
+	if !ok {
+		return l.ceiling
+	}
+	return m.lim.Limit()
+}
+
+// Limits returns current rate of every used method.
+func (l *AdaptiveLimiter) Limits() map[string]rate.Limit {
+	l.state.mux.Lock()
+	defer l.state.mux.Unlock()
+
+	r := make(map[string]rate.Limit, len(l.state.methods))
+	for method, m := range l.state.methods {
+		r[method] = m.lim.Limit()
+	}
+	return r
+}
+
+// limiter returns bucket of given method.
+func (l *AdaptiveLimiter) limiter(method string) *rate.Limiter {
+	l.state.mux.Lock()
+	defer l.state.mux.Unlock()
+
+	m, ok := l.state.methods[method]
+	if !ok {
+		m = &adaptiveLimit{lim: rate.NewLimiter(l.ceiling, l.burst)}
+		l.state.methods[method] = m
+	}
+	return m.lim
+}
+
+// feedback adapts rate of method to result of request sent at given time.
+func (l *AdaptiveLimiter) feedback(method string, sent time.Time, err error) {
+	flood := isFloodWait(err)
+	if err != nil && !flood {
+		// Unrelated to rate.
+		return
+	}
+
+	l.state.mux.Lock()
+	defer l.state.mux.Unlock()
+
+	m, ok := l.state.methods[method]
+	if !ok {
+		return
+	}
+	now := l.clock.Now()
+	r := m.lim.Limit()
+	if flood {
+		if sent.Before(m.cut) {
+			// Request was sent before the last decrease, so its flood wait
+			// is already accounted.
+			return
+		}
+		m.cut = now
+		r = rate.Limit(float64(r) * l.decrease)
+	} else {
+		r += l.increase
+	}
+
+	if r < l.floor {
+		r = l.floor
+	}
+	if r > l.ceiling {
+		r = l.ceiling
+	}
+	m.lim.SetLimitAt(now, r)
+}
+
+// Handle implements telegram.Middleware.
+func (l *AdaptiveLimiter) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		// Check if ctx is already canceled.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		method := methodOf(input)
+		now := l.clock.Now()
+		r := l.limiter(method).ReserveN(now, 1)
+		if !r.OK() {
+			// Limiter requires n <= lim.burst for each reservation.
+			return errors.New("limiter's burst size must be greater than zero")
+		}
+		if err := delay(ctx, l.clock, now, r); err != nil {
+			return err
+		}
+
+		sent := l.clock.Now()
+		err := next.Invoke(ctx, input, output)
+		l.feedback(method, sent, err)
+		return err
+	}
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+type errInvoker struct {
+	err error
+}
+
+func (i *errInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	return i.err
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	const method = "help.getConfig"
+
+	ctx := context.Background()
+	l := NewAdaptiveLimiter(10, 100, 100).WithIncrease(5)
+	next := &errInvoker{}
+	h := l.Handle(next)
+	invoke := func() error {
+		return h.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil)
+	}
+
+	a := require.New(t)
+	a.NoError(invoke())
+	a.Equal(rate.Limit(100), l.Limit(method))
+
+	next.err = tgerr.New(420, "FLOOD_WAIT_5")
+	a.Error(invoke())
+	a.Equal(rate.Limit(50), l.Limit(method))
+	a.Error(invoke())
+	a.Equal(rate.Limit(25), l.Limit(method))
+	a.Error(invoke())
+	a.Error(invoke())
+	a.Equal(rate.Limit(10), l.Limit(method), "floor")
+
+	// Other errors do not affect rate.
+	next.err = tgerr.New(400, "PEER_ID_INVALID")
+	a.Error(invoke())
+	next.err = errors.New("connection reset")
+	a.Error(invoke())
+	a.Equal(rate.Limit(10), l.Limit(method))
+
+	next.err = nil
+	a.NoError(invoke())
+	a.Equal(rate.Limit(15), l.Limit(method))
+	for i := 0; i < 100; i++ {
+		a.NoError(invoke())
+	}
+	a.Equal(rate.Limit(100), l.Limit(method), "ceiling")
+
+	// Unused methods are at ceiling.
+	a.Equal(rate.Limit(100), l.Limit("messages.sendMessage"))
+	a.Equal(map[string]rate.Limit{method: 100}, l.Limits())
+}
+
+func TestAdaptiveLimiterConcurrentFlood(t *testing.T) {
+	const method = "messages.sendMessage"
+
+	l := NewAdaptiveLimiter(1, 100, 100)
+	l.limiter(method)
+
+	sent := time.Now()
+	flood := tgerr.New(420, "FLOOD_PREMIUM_WAIT_3")
+	l.feedback(method, sent, flood)
+	// Requests sent along with the first one are already accounted.
+	l.feedback(method, sent, flood)
+	require.Equal(t, rate.Limit(50), l.Limit(method))
+
+	l.feedback(method, time.Now(), flood)
+	require.Equal(t, rate.Limit(25), l.Limit(method))
+}
@@ -1,2 +1,23 @@
 // Package ratelimit implements a tg.Invoker that limits request rate.
+//
+// RateLimiter is a single token bucket for all requests. RuleLimiter applies
+// set of rules, every with its own bucket, either for all matching requests
+// or for every target peer:
+//
+//	limiter := ratelimit.NewRuleLimiter(ratelimit.BotRules()...)
+//	client := telegram.NewClient(appID, appHash, telegram.Options{
+//		Middlewares: []telegram.Middleware{limiter},
+//	})
+//
+// AdaptiveLimiter finds rate of every method itself, lowering it on
+// FLOOD_WAIT errors and raising it back after successful requests.
+//
+// SharedLimiter keeps buckets in a Store shared by multiple processes using
+// the same account, like redis.RateLimit, so they together do not exceed
+// the rate.
+//
+// PriorityLimiter admits requests with higher priority first, so
+// interactive requests do not wait behind bulk jobs:
+//
+//	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityBackground)
 package ratelimit
@@ -0,0 +1,360 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/internal/tracehook"
+)
+
+// Priority of request.
+type Priority int
+
+// Request priorities.
+const (
+	// PriorityBackground is for bulk jobs, like history crawls.
+	PriorityBackground Priority = -1
+	// PriorityNormal is a default priority.
+	PriorityNormal Priority = 0
+	// PriorityInteractive is for requests someone is waiting for, like
+	// replies to users.
+	PriorityInteractive Priority = 1
+)
+
+// lane returns index of lane of priority, zero is the highest one.
+func (p Priority) lane() int {
+	switch {
+	case p >= PriorityInteractive:
+		return 0
+	case p <= PriorityBackground:
+		return 2
+	default:
+		return 1
+	}
+}
+
+const lanes = 3
+
+type priorityKey struct{}
+
+// WithPriority returns context with given request priority. Requests
+// without priority are PriorityNormal.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+func priorityOf(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// waiter is a request waiting for admission.
+type waiter struct {
+	admit chan struct{}
+}
+
+// priorityState is a state shared by PriorityLimiter copies.
+type priorityState struct {
+	mux     sync.Mutex
+	lanes   [lanes][]*waiter
+	credit  [lanes]float64
+	running bool
+	// spare is a number of tokens taken from limiter for requests canceled
+	// after admission, to be used by next requests.
+	spare int
+	// removed wakes up dispatcher when waiting request is canceled.
+	removed chan struct{}
+}
+
+// empty reports whether no request is waiting.
+// Assumes the mutex is locked.
+func (s *priorityState) empty() bool {
+	for _, l := range s.lanes {
+		if len(l) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// next selects lane to admit request from.
+//
+// The highest lane with waiting requests is selected, unless a lower lane
+// has earned its guaranteed share: every backlogged lane earns its share
+// per admission. Returns -1 if no request is waiting.
+// Assumes the mutex is locked.
+func (s *priorityState) next(shares [lanes]float64) int {
+	selected := -1
+	for i := lanes - 1; i >= 0; i-- {
+		if len(s.lanes[i]) == 0 {
+			continue
+		}
+		s.credit[i] += shares[i]
+		// Tolerate rounding errors of accumulated shares.
+		if s.credit[i] >= 1-1e-9 && (selected < 0 || s.credit[i] > s.credit[selected]) {
+			selected = i
+		}
+	}
+	if selected >= 0 {
+		s.credit[selected]--
+		return selected
+	}
+	for i := 0; i < lanes; i++ {
+		if len(s.lanes[i]) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// pop admits the next waiting request. Returns false if no request is waiting.
+// Assumes the mutex is locked.
+func (s *priorityState) pop(shares [lanes]float64) bool {
+	i := s.next(shares)
+	if i < 0 {
+		return false
+	}
+	w := s.lanes[i][0]
+	s.lanes[i][0] = nil
+	s.lanes[i] = s.lanes[i][1:]
+	if len(s.lanes[i]) == 0 {
+		// Credit is earned only while backlogged.
+		s.credit[i] = 0
+	}
+	close(w.admit)
+	return true
+}
+
+// release keeps token of request canceled after admission for next
+// requests, up to burst tokens.
+// Assumes the mutex is locked.
+func (s *priorityState) release(burst int) {
+	if s.spare < burst {
+		s.spare++
+	}
+}
+
+// remove removes canceled request. Returns false if request is already
+// admitted.
+// Assumes the mutex is locked.
+func (s *priorityState) remove(lane int, w *waiter) bool {
+	for i, v := range s.lanes[lane] {
+		if v == w {
+			s.lanes[lane] = append(s.lanes[lane][:i], s.lanes[lane][i+1:]...)
+			select {
+			case s.removed <- struct{}{}:
+			default:
+			}
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	defaultNormalShare     = 0.1
+	defaultBackgroundShare = 0.05
+)
+
+// PriorityLimiter is a tg.Invoker that throttles RPC calls on underlying
+// invoker, admitting requests with higher priority first.
+//
+// Priority of request is set by WithPriority. To prevent starvation, lower
+// priorities are guaranteed a minimum share of admissions while they have
+// waiting requests, see WithMinShare.
+type PriorityLimiter struct {
+	clock  clock.Clock
+	lim    *rate.Limiter
+	shares [lanes]float64
+	state  *priorityState
+}
+
+// NewPriorityLimiter returns a new invoker rate limiter with priorities.
+func NewPriorityLimiter(r rate.Limit, b int) *PriorityLimiter {
+	l := &PriorityLimiter{
+		clock: clock.System,
+		lim:   rate.NewLimiter(r, b),
+		state: &priorityState{removed: make(chan struct{}, 1)},
+	}
+	l.shares[PriorityNormal.lane()] = defaultNormalShare
+	l.shares[PriorityBackground.lane()] = defaultBackgroundShare
+	return l
+}
+
+// clone returns a copy of the PriorityLimiter.
+func (l *PriorityLimiter) clone() *PriorityLimiter {
+	return &PriorityLimiter{
+		clock:  l.clock,
+		lim:    l.lim,
+		shares: l.shares,
+		state:  l.state,
+	}
+}
+
+// WithClock sets clock to use. Default is to use system clock.
+func (l *PriorityLimiter) WithClock(c clock.Clock) *PriorityLimiter {
+	l = l.clone()
+	l.clock = c
+	return l
+}
+
+// WithMinShare sets minimum share of admissions, from 0 to 1, guaranteed to
+// requests of given priority while they are waiting. Default is 0.1 for
+// PriorityNormal and 0.05 for PriorityBackground.
+//
+// PriorityInteractive requests are admitted first anyway, so share of
+// PriorityInteractive is ignored.
+func (l *PriorityLimiter) WithMinShare(p Priority, share float64) *PriorityLimiter {
+	l = l.clone()
+	if p.lane() == PriorityInteractive.lane() {
+		return l
+	}
+	l.shares[p.lane()] = share
+	return l
+}
+
+// dispatch admits waiting requests as limiter permits until no request is
+// waiting.
+func (l *PriorityLimiter) dispatch() {
+	s := l.state
+	for {
+		s.mux.Lock()
+		if s.empty() {
+			s.running = false
+			s.mux.Unlock()
+			return
+		}
+		if s.spare > 0 {
+			s.spare--
+			s.pop(l.shares)
+			s.mux.Unlock()
+			continue
+		}
+		now := l.clock.Now()
+		r := l.lim.ReserveN(now, 1)
+		s.mux.Unlock()
+
+		if !l.refill(r, now) {
+			return
+		}
+
+		s.mux.Lock()
+		// Request is selected only when token is available, so requests
+		// arrived meanwhile are considered too.
+		if !s.pop(l.shares) {
+			s.release(l.lim.Burst())
+		}
+		s.mux.Unlock()
+	}
+}
+
+// refill waits until token of reservation r made at now is available.
+//
+// Returns false if all waiting requests are canceled meanwhile, canceling
+// the reservation and stopping dispatch.
+func (l *PriorityLimiter) refill(r *rate.Reservation, now time.Time) bool {
+	s := l.state
+	d := r.DelayFrom(now)
+	if d <= 0 {
+		return true
+	}
+	t := l.clock.Timer(d)
+	defer clock.StopTimer(t)
+
+	for {
+		select {
+		case <-t.C():
+			return true
+		case <-s.removed:
+			s.mux.Lock()
+			if s.empty() {
+				r.CancelAt(l.clock.Now())
+				s.running = false
+				s.mux.Unlock()
+				return false
+			}
+			s.mux.Unlock()
+		}
+	}
+}
+
+func (l *PriorityLimiter) wait(ctx context.Context) error {
+	// Check if ctx is already canceled.
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	if l.lim.Burst() <= 0 && l.lim.Limit() != rate.Inf {
+		return errors.New("limiter's burst size must be greater than zero")
+	}
+
+	s := l.state
+	lane := priorityOf(ctx).lane()
+	w := &waiter{admit: make(chan struct{})}
+
+	s.mux.Lock()
+	if s.empty() {
+		if s.spare > 0 {
+			s.spare--
+			s.mux.Unlock()
+			return nil
+		}
+		if l.lim.AllowN(l.clock.Now(), 1) {
+			s.mux.Unlock()
+			return nil
+		}
+	}
+	start := l.clock.Now()
+	defer func() {
+		tracehook.Span(ctx, "tg.ratelimit", start, l.clock.Now())
+	}()
+	s.lanes[lane] = append(s.lanes[lane], w)
+	if !s.running {
+		s.running = true
+		go l.dispatch()
+	}
+	s.mux.Unlock()
+
+	select {
+	case <-w.admit:
+		return nil
+	case <-ctx.Done():
+		l.cancel(lane, w)
+		return ctx.Err()
+	}
+}
+
+// cancel removes canceled request. If request is admitted concurrently, its
+// token is passed to the next request or kept for next requests.
+func (l *PriorityLimiter) cancel(lane int, w *waiter) {
+	s := l.state
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.remove(lane, w) {
+		return
+	}
+	if !s.pop(l.shares) {
+		s.release(l.lim.Burst())
+	}
+}
+
+// Handle implements telegram.Middleware.
+func (l *PriorityLimiter) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if err := l.wait(ctx); err != nil {
+			return err
+		}
+		return next.Invoke(ctx, input, output)
+	}
+}
@@ -0,0 +1,185 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/neo"
+)
+
+func (s *priorityState) queued() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var n int
+	for _, l := range s.lanes {
+		n += len(l)
+	}
+	return n
+}
+
+func TestPriorityLimiter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clk := neo.NewTime(time.Now())
+	l := NewPriorityLimiter(1, 1).WithClock(clk)
+
+	a := require.New(t)
+	// Burst.
+	a.NoError(l.wait(ctx))
+
+	type result struct {
+		p   Priority
+		err error
+	}
+	results := make(chan result, 10)
+	enqueue := func(p Priority) {
+		n := l.state.queued()
+		go func() {
+			err := l.wait(WithPriority(ctx, p))
+			results <- result{p: p, err: err}
+		}()
+		for l.state.queued() == n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	observe := clk.Observe()
+	enqueue(PriorityBackground)
+	enqueue(PriorityBackground)
+	// Dispatcher is waiting for token.
+	<-observe
+	enqueue(PriorityNormal)
+	enqueue(PriorityInteractive)
+
+	// Canceled requests are removed.
+	canceled, cancelRequest := context.WithCancel(ctx)
+	go func() {
+		err := l.wait(WithPriority(canceled, PriorityInteractive))
+		results <- result{p: PriorityInteractive, err: err}
+	}()
+	for l.state.queued() != 5 {
+		time.Sleep(time.Millisecond)
+	}
+	cancelRequest()
+	r := <-results
+	a.ErrorIs(r.err, context.Canceled)
+	a.Equal(4, l.state.queued())
+
+	for _, expected := range []Priority{
+		PriorityInteractive,
+		PriorityNormal,
+		PriorityBackground,
+		PriorityBackground,
+	} {
+		observe = clk.Observe()
+		clk.Travel(time.Second)
+		r := <-results
+		a.NoError(r.err)
+		a.Equal(expected, r.p)
+		if l.state.queued() > 0 {
+			// Wait for the next token.
+			<-observe
+		}
+	}
+}
+
+func TestPriorityStateShare(t *testing.T) {
+	l := NewPriorityLimiter(1, 1)
+	s := l.state
+
+	var admitted [lanes]int
+	for i := 0; i < 1000; i++ {
+		// Every lane is backlogged.
+		for lane := range s.lanes {
+			if len(s.lanes[lane]) == 0 {
+				s.lanes[lane] = append(s.lanes[lane], &waiter{admit: make(chan struct{})})
+			}
+		}
+		lane := s.next(l.shares)
+		admitted[lane]++
+		s.lanes[lane] = s.lanes[lane][1:]
+	}
+
+	a := require.New(t)
+	a.InDelta(100, admitted[PriorityNormal.lane()], 1)
+	a.InDelta(50, admitted[PriorityBackground.lane()], 1)
+}
+
+func TestPriorityLimiterCancel(t *testing.T) {
+	a := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clk := neo.NewTime(time.Now())
+	l := NewPriorityLimiter(1, 1).WithClock(clk)
+	// Burst.
+	a.NoError(l.wait(ctx))
+
+	observe := clk.Observe()
+	canceled, cancelRequest := context.WithCancel(ctx)
+	result := make(chan error, 1)
+	go func() {
+		result <- l.wait(canceled)
+	}()
+	// Dispatcher is waiting for token.
+	<-observe
+	cancelRequest()
+	a.ErrorIs(<-result, context.Canceled)
+
+	// Dispatcher stops and returns reserved token.
+	for {
+		l.state.mux.Lock()
+		running := l.state.running
+		l.state.mux.Unlock()
+		if !running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clk.Travel(time.Second)
+	a.True(l.lim.AllowN(clk.Now(), 1))
+}
+
+func TestPriorityLimiterCancelAdmitted(t *testing.T) {
+	a := require.New(t)
+	l := NewPriorityLimiter(1, 1)
+	s := l.state
+	lane := PriorityNormal.lane()
+
+	first := &waiter{admit: make(chan struct{})}
+	second := &waiter{admit: make(chan struct{})}
+	s.lanes[lane] = append(s.lanes[lane], first, second)
+	a.True(s.pop(l.shares))
+
+	// Token of admitted request is passed to the next one.
+	l.cancel(lane, first)
+	a.Equal(0, s.queued())
+	a.Zero(s.spare)
+	select {
+	case <-second.admit:
+	default:
+		t.Fatal("next request is not admitted")
+	}
+
+	// Or kept for next requests.
+	l.cancel(lane, second)
+	a.Equal(1, s.spare)
+	a.True(l.lim.AllowN(time.Now(), 1))
+	a.NoError(l.wait(context.Background()))
+	a.Zero(s.spare)
+}
+
+func TestPriorityLimiterMinShare(t *testing.T) {
+	l := NewPriorityLimiter(1, 1).
+		WithMinShare(PriorityInteractive, 0.5).
+		WithMinShare(PriorityBackground, 0.2)
+
+	a := require.New(t)
+	a.Zero(l.shares[PriorityInteractive.lane()])
+	a.Equal(0.2, l.shares[PriorityBackground.lane()])
+}
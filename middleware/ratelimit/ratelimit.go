@@ -11,6 +11,8 @@ import (
 	"github.com/gotd/td/clock"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/internal/tracehook"
 )
 
 // RateLimiter is a tg.Invoker that throttles RPC calls on underlying invoker.
@@ -61,29 +63,60 @@ func (l *RateLimiter) wait(ctx context.Context) error {
 		return errors.New("limiter's burst size must be greater than zero")
 	}
 
-	delay := r.DelayFrom(now)
-	if delay == 0 {
+	return delay(ctx, l.clock, now, r)
+}
+
+// delay blocks until all reservations made at now are due. Reservations are
+// canceled if the Context is canceled or the expected wait time exceeds the
+// Context's Deadline.
+func delay(ctx context.Context, c clock.Clock, now time.Time, rs ...*rate.Reservation) error {
+	var d time.Duration
+	for _, r := range rs {
+		if rd := r.DelayFrom(now); rd > d {
+			d = rd
+		}
+	}
+	if d == 0 {
 		return nil
 	}
 
+	cancel := func() {
+		now := c.Now()
+		for _, r := range rs {
+			r.CancelAt(now)
+		}
+	}
+
 	// Bail out earlier if we exceed context deadline. Note that
 	// contexts use system time instead of mockable clock.
 	deadline, ok := ctx.Deadline()
-	if ok && delay > time.Until(deadline) {
+	if ok && d > time.Until(deadline) {
+		cancel()
 		return context.DeadlineExceeded
 	}
 
-	t := l.clock.Timer(delay)
+	defer func() {
+		tracehook.Span(ctx, "tg.ratelimit", now, c.Now())
+	}()
+	t := c.Timer(d)
 	defer clock.StopTimer(t)
 	select {
 	case <-t.C():
 		return nil
 	case <-ctx.Done():
-		r.CancelAt(l.clock.Now())
+		cancel()
 		return ctx.Err()
 	}
 }
 
+// methodOf returns TypeName of request, e.g. "messages.sendMessage".
+func methodOf(input bin.Encoder) string {
+	if t, ok := input.(interface{ TypeName() string }); ok {
+		return t.TypeName()
+	}
+	return ""
+}
+
 // Handle implements telegram.Middleware.
 func (l *RateLimiter) Handle(next tg.Invoker) telegram.InvokeFunc {
 	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
@@ -0,0 +1,42 @@
+// Package ratelimittest contains conformance test suite for ratelimit.Store
+// implementations.
+//
+// Suite expects a fresh (empty) store, because it checks behavior of missing
+// keys.
+package ratelimittest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/contrib/middleware/ratelimit"
+)
+
+// TestStore runs conformance tests for given ratelimit.Store implementation.
+func TestStore(t *testing.T, store ratelimit.Store) {
+	ctx := t.Context()
+
+	t.Run("RateLimitStore", func(t *testing.T) {
+		a := require.New(t)
+		now := time.Now()
+
+		reserve := func(key string, now time.Time) time.Duration {
+			d, err := store.Reserve(ctx, key, now, 10, 3)
+			a.NoError(err)
+			return d
+		}
+
+		// Burst.
+		for i := 0; i < 3; i++ {
+			a.Zero(reserve("1", now), i)
+		}
+		a.Equal(100*time.Millisecond, reserve("1", now))
+		a.Equal(200*time.Millisecond, reserve("1", now))
+		// Other keys are limited separately.
+		a.Zero(reserve("2", now))
+		// Refill.
+		a.Zero(reserve("1", now.Add(time.Second)))
+	})
+}
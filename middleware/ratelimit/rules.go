@@ -0,0 +1,332 @@
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/internal/target"
+)
+
+// PeerKind is a set of target peer kinds.
+type PeerKind uint8
+
+// Peer kinds.
+const (
+	// PeerUser is a private chat, including chat with self.
+	PeerUser PeerKind = 1 << iota
+	// PeerChat is a basic group.
+	PeerChat
+	// PeerChannel is a supergroup or a broadcast channel.
+	PeerChannel
+
+	// PeerGroup is any group or channel.
+	PeerGroup = PeerChat | PeerChannel
+)
+
+func peerKind(p target.Peer) PeerKind {
+	switch p.Kind {
+	case target.Self, target.User:
+		return PeerUser
+	case target.Chat:
+		return PeerChat
+	case target.Channel:
+		return PeerChannel
+	default:
+		return 0
+	}
+}
+
+// Rule is a rate limit of requests.
+type Rule struct {
+	// Methods limits rule to requests with given TypeName, e.g.
+	// "messages.sendMessage". Empty means any method.
+	Methods []string
+	// Peers limits rule to requests to given kinds of peers, taken from
+	// request peer, to_peer or channel field. Zero means any request,
+	// including requests without target peer.
+	Peers PeerKind
+	// PerPeer makes rule limit every target peer separately instead of all
+	// matching requests together. Requests without target peer are not
+	// limited by such rule.
+	PerPeer bool
+
+	// Limit is a rate of requests.
+	Limit rate.Limit
+	// Burst is a maximum burst size.
+	Burst int
+}
+
+// BotRules returns rules following Telegram limits for bots: at most 30
+// messages per second overall, one message per second in a single chat and
+// 20 messages per minute in a group.
+//
+// See https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this.
+func BotRules() []Rule {
+	return []Rule{
+		{Methods: sendMethods(), Limit: 30, Burst: 30},
+		{Methods: sendMethods(), PerPeer: true, Limit: 1, Burst: 1},
+		{Methods: sendMethods(), Peers: PeerGroup, PerPeer: true, Limit: rate.Every(time.Minute / 20), Burst: 20},
+	}
+}
+
+// UserRules returns conservative rules for user accounts. Telegram does not
+// publish limits for user accounts, so these are estimates: at most 10
+// requests per second overall, one message per second in a single chat and
+// 20 messages per minute in a group.
+func UserRules() []Rule {
+	return []Rule{
+		{Limit: 10, Burst: 20},
+		{Methods: sendMethods(), PerPeer: true, Limit: 1, Burst: 3},
+		{Methods: sendMethods(), Peers: PeerGroup, PerPeer: true, Limit: rate.Every(time.Minute / 20), Burst: 10},
+	}
+}
+
+// sendMethods returns methods which send messages.
+func sendMethods() []string {
+	return []string{
+		"messages.sendMessage",
+		"messages.sendMedia",
+		"messages.sendMultiMedia",
+		"messages.sendInlineBotResult",
+		"messages.forwardMessages",
+	}
+}
+
+// minSweep is a minimum number of per-peer buckets of rule to start
+// eviction of idle ones.
+const minSweep = 64
+
+// limit is a state of Rule.
+type limit struct {
+	rule    Rule
+	methods map[string]struct{}
+
+	global *rate.Limiter
+
+	mux     sync.Mutex
+	peers   map[target.Peer]*peerLimiter
+	sweepAt int
+}
+
+type peerLimiter struct {
+	lim  *rate.Limiter
+	used time.Time
+}
+
+func newLimit(r Rule) *limit {
+	l := &limit{rule: r}
+	if len(r.Methods) > 0 {
+		l.methods = make(map[string]struct{}, len(r.Methods))
+		for _, m := range r.Methods {
+			l.methods[m] = struct{}{}
+		}
+	}
+	if r.PerPeer {
+		l.peers = map[target.Peer]*peerLimiter{}
+		l.sweepAt = minSweep
+	} else {
+		l.global = rate.NewLimiter(r.Limit, r.Burst)
+	}
+	return l
+}
+
+// match reports whether rule applies to request.
+func (l *limit) match(method string, peer target.Peer) bool {
+	if l.methods != nil {
+		if _, ok := l.methods[method]; !ok {
+			return false
+		}
+	}
+	if l.rule.Peers != 0 && l.rule.Peers&peerKind(peer) == 0 {
+		return false
+	}
+	if l.rule.PerPeer && peer == (target.Peer{}) {
+		return false
+	}
+	return true
+}
+
+// limiter returns bucket for request to given peer.
+func (l *limit) limiter(now time.Time, peer target.Peer, maxPeers int) *rate.Limiter {
+	if l.global != nil {
+		return l.global
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if p, ok := l.peers[peer]; ok {
+		p.used = now
+		return p.lim
+	}
+	if full := maxPeers > 0 && len(l.peers) >= maxPeers; full || len(l.peers) >= l.sweepAt {
+		keep := len(l.peers)
+		if full {
+			keep = maxPeers - 1
+		}
+		l.sweep(now, keep)
+	}
+
+	p := &peerLimiter{
+		lim:  rate.NewLimiter(l.rule.Limit, l.rule.Burst),
+		used: now,
+	}
+	l.peers[peer] = p
+	return p.lim
+}
+
+// sweep evicts idle per-peer buckets, leaving at most keep buckets.
+// Assumes the mutex is locked.
+func (l *limit) sweep(now time.Time, keep int) {
+	// Full bucket is the same as a new one, so it can be dropped without
+	// loosening the limit.
+	burst := float64(l.rule.Burst)
+	for peer, p := range l.peers {
+		if p.lim.TokensAt(now) >= burst {
+			delete(l.peers, peer)
+		}
+	}
+
+	if n := len(l.peers) - keep; n > 0 {
+		// Too many active peers, evict least recently used ones.
+		type entry struct {
+			peer target.Peer
+			used time.Time
+		}
+		entries := make([]entry, 0, len(l.peers))
+		for peer, p := range l.peers {
+			entries = append(entries, entry{peer: peer, used: p.used})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].used.Before(entries[j].used)
+		})
+		for _, e := range entries[:n] {
+			delete(l.peers, e.peer)
+		}
+	}
+
+	l.sweepAt = 2 * len(l.peers)
+	if l.sweepAt < minSweep {
+		l.sweepAt = minSweep
+	}
+}
+
+// len returns number of per-peer buckets.
+func (l *limit) len() int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return len(l.peers)
+}
+
+const defaultMaxPeers = 10000
+
+// RuleLimiter is a tg.Invoker that throttles RPC calls on underlying invoker
+// using set of rules.
+//
+// Every rule matching a request is applied, so request waits for the
+// slowest of them.
+type RuleLimiter struct {
+	clock    clock.Clock
+	limits   []*limit
+	maxPeers int
+}
+
+// NewRuleLimiter returns a new invoker rate limiter using given rules.
+func NewRuleLimiter(rules ...Rule) *RuleLimiter {
+	limits := make([]*limit, 0, len(rules))
+	for _, r := range rules {
+		limits = append(limits, newLimit(r))
+	}
+	return &RuleLimiter{
+		clock:    clock.System,
+		limits:   limits,
+		maxPeers: defaultMaxPeers,
+	}
+}
+
+// clone returns a copy of the RuleLimiter.
+func (l *RuleLimiter) clone() *RuleLimiter {
+	return &RuleLimiter{
+		clock:    l.clock,
+		limits:   l.limits,
+		maxPeers: l.maxPeers,
+	}
+}
+
+// WithClock sets clock to use. Default is to use system clock.
+func (l *RuleLimiter) WithClock(c clock.Clock) *RuleLimiter {
+	l = l.clone()
+	l.clock = c
+	return l
+}
+
+// WithMaxPeers limits number of per-peer buckets kept by every rule.
+//
+// Idle buckets are evicted without changing the limit. If there are still
+// too many buckets, least recently used ones are evicted, so their peers
+// get the full burst again. Zero means no limit. Default is 10000.
+func (l *RuleLimiter) WithMaxPeers(n int) *RuleLimiter {
+	l = l.clone()
+	l.maxPeers = n
+	return l
+}
+
+// reserve reserves a token of every rule matching request at now.
+func (l *RuleLimiter) reserve(now time.Time, input bin.Encoder) ([]*rate.Reservation, error) {
+	method := methodOf(input)
+	peer := target.FromRequest(input)
+
+	var rs []*rate.Reservation
+	for i, lim := range l.limits {
+		if !lim.match(method, peer) {
+			continue
+		}
+
+		r := lim.limiter(now, peer, l.maxPeers).ReserveN(now, 1)
+		if !r.OK() {
+			for _, r := range rs {
+				r.CancelAt(now)
+			}
+			// Limiter requires n <= lim.burst for each reservation.
+			return nil, errors.Errorf("rule %d: limiter's burst size must be greater than zero", i)
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+func (l *RuleLimiter) wait(ctx context.Context, input bin.Encoder) error {
+	// Check if ctx is already canceled.
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	now := l.clock.Now()
+	rs, err := l.reserve(now, input)
+	if err != nil {
+		return err
+	}
+	return delay(ctx, l.clock, now, rs...)
+}
+
+// Handle implements telegram.Middleware.
+func (l *RuleLimiter) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if err := l.wait(ctx, input); err != nil {
+			return err
+		}
+		return next.Invoke(ctx, input, output)
+	}
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+func sendTo(peer tg.InputPeerClass) bin.Encoder {
+	return &tg.MessagesSendMessageRequest{Peer: peer, Message: "hello"}
+}
+
+func reserveDelay(t *testing.T, l *RuleLimiter, now time.Time, input bin.Encoder) time.Duration {
+	t.Helper()
+
+	rs, err := l.reserve(now, input)
+	require.NoError(t, err)
+
+	var d time.Duration
+	for _, r := range rs {
+		if rd := r.DelayFrom(now); rd > d {
+			d = rd
+		}
+	}
+	return d
+}
+
+func TestRuleLimiter(t *testing.T) {
+	l := NewRuleLimiter(BotRules()...)
+	now := time.Now()
+
+	user1 := &tg.InputPeerUser{UserID: 1}
+	user2 := &tg.InputPeerUser{UserID: 2}
+	group := &tg.InputPeerChat{ChatID: 10}
+
+	a := require.New(t)
+	// One message per second in a chat.
+	a.Zero(reserveDelay(t, l, now, sendTo(user1)))
+	a.Equal(time.Second, reserveDelay(t, l, now, sendTo(user1)))
+	// Other chats are not affected.
+	a.Zero(reserveDelay(t, l, now, sendTo(user2)))
+	// Other methods are not limited.
+	a.Zero(reserveDelay(t, l, now, &tg.MessagesGetHistoryRequest{Peer: user1}))
+	a.Zero(reserveDelay(t, l, now, &tg.HelpGetConfigRequest{}))
+	a.Zero(reserveDelay(t, l, now, sendTo(group)))
+	a.Equal(time.Second, reserveDelay(t, l, now, sendTo(group)))
+}
+
+func TestBotRulesGroup(t *testing.T) {
+	// Per-group rule only, per-chat rule would delay every message.
+	l := NewRuleLimiter(BotRules()[2])
+	now := time.Now()
+
+	a := require.New(t)
+	for i := 0; i < 20; i++ {
+		a.Zero(reserveDelay(t, l, now, sendTo(&tg.InputPeerChat{ChatID: 10})), i)
+	}
+	a.Equal(3*time.Second, reserveDelay(t, l, now, sendTo(&tg.InputPeerChat{ChatID: 10})))
+	// Private chats are not affected.
+	a.Zero(reserveDelay(t, l, now, sendTo(&tg.InputPeerUser{UserID: 10})))
+}
+
+func TestRuleLimiterGlobal(t *testing.T) {
+	l := NewRuleLimiter(Rule{Limit: 1, Burst: 2})
+	now := time.Now()
+
+	a := require.New(t)
+	a.Zero(reserveDelay(t, l, now, sendTo(&tg.InputPeerUser{UserID: 1})))
+	a.Zero(reserveDelay(t, l, now, &tg.HelpGetConfigRequest{}))
+	a.Equal(time.Second, reserveDelay(t, l, now, sendTo(&tg.InputPeerChannel{ChannelID: 1})))
+}
+
+func TestRuleLimiterBurst(t *testing.T) {
+	l := NewRuleLimiter(
+		Rule{Limit: rate.Inf, Burst: 1},
+		Rule{Limit: 1, Burst: 0},
+	)
+
+	_, err := l.reserve(time.Now(), &tg.HelpGetConfigRequest{})
+	require.Error(t, err)
+}
+
+func TestRuleLimiterEviction(t *testing.T) {
+	l := NewRuleLimiter(Rule{PerPeer: true, Limit: 1, Burst: 1}).WithMaxPeers(100)
+	lim := l.limits[0]
+	now := time.Now()
+
+	a := require.New(t)
+	for i := 0; i < 1000; i++ {
+		reserveDelay(t, l, now, sendTo(&tg.InputPeerUser{UserID: int64(i)}))
+		a.LessOrEqual(lim.len(), 100)
+	}
+	// Last peers are kept.
+	a.Equal(time.Second, reserveDelay(t, l, now, sendTo(&tg.InputPeerUser{UserID: 999})))
+
+	// Idle buckets are evicted.
+	now = now.Add(time.Minute)
+	for i := 0; i < minSweep; i++ {
+		reserveDelay(t, l, now, sendTo(&tg.InputPeerChat{ChatID: int64(i)}))
+	}
+	a.LessOrEqual(lim.len(), minSweep+1)
+}
+
+func TestRuleLimiterHandle(t *testing.T) {
+	var calls int
+	next := invokeFunc(func() { calls++ })
+	h := NewRuleLimiter(Rule{PerPeer: true, Limit: rate.Every(time.Hour), Burst: 1}).Handle(next)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	a := require.New(t)
+	input := sendTo(&tg.InputPeerUser{UserID: 1})
+	a.NoError(h.Invoke(ctx, input, nil))
+	a.ErrorIs(h.Invoke(ctx, input, nil), context.DeadlineExceeded)
+	a.Equal(1, calls)
+}
+
+type invokeFunc func()
+
+func (f invokeFunc) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	f()
+	return nil
+}
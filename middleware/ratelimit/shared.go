@@ -0,0 +1,209 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/atomic"
+	"golang.org/x/time/rate"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/internal/tracehook"
+)
+
+// Store is a token bucket state shared by multiple processes, like Redis.
+type Store interface {
+	// Reserve reserves a token of bucket with given key at now and returns
+	// delay after which request can be sent. Bucket is refilled at limit
+	// tokens per second and holds at most burst tokens.
+	//
+	// Reserved token is not returned, even if request is not sent.
+	Reserve(ctx context.Context, key string, now time.Time, limit rate.Limit, burst int) (time.Duration, error)
+}
+
+const (
+	// storeTimeout limits a single store call.
+	storeTimeout = time.Second
+	// storeBackoff is a time to skip store calls after failure.
+	storeBackoff = 5 * time.Second
+
+	defaultSharedKey = "global"
+)
+
+// SharedLimiter is a tg.Invoker that throttles RPC calls on underlying invoker
+// using token buckets in Store, so processes sharing the store together do
+// not exceed the rate.
+//
+// If store is unreachable, SharedLimiter falls back to in-process buckets
+// for a few seconds. Note that processes are limited separately meanwhile.
+type SharedLimiter struct {
+	clock clock.Clock
+	store Store
+	limit rate.Limit
+	burst int
+	key   func(input bin.Encoder) string
+
+	retryAt *atomic.Int64
+	local   *localBuckets
+}
+
+// localBuckets are fallback in-process buckets.
+type localBuckets struct {
+	mux     sync.Mutex
+	buckets map[string]*rate.Limiter
+}
+
+func (b *localBuckets) get(key string, limit rate.Limit, burst int) *rate.Limiter {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	lim, ok := b.buckets[key]
+	if !ok {
+		lim = rate.NewLimiter(limit, burst)
+		b.buckets[key] = lim
+	}
+	return lim
+}
+
+// NewSharedLimiter returns a new invoker rate limiter using token buckets
+// in given store.
+//
+// All requests share a single bucket by default, see WithKey.
+func NewSharedLimiter(store Store, r rate.Limit, b int) *SharedLimiter {
+	return &SharedLimiter{
+		clock: clock.System,
+		store: store,
+		limit: r,
+		burst: b,
+		key: func(input bin.Encoder) string {
+			return defaultSharedKey
+		},
+		retryAt: atomic.NewInt64(0),
+		local: &localBuckets{
+			buckets: map[string]*rate.Limiter{},
+		},
+	}
+}
+
+// clone returns a copy of the SharedLimiter.
+func (l *SharedLimiter) clone() *SharedLimiter {
+	return &SharedLimiter{
+		clock:   l.clock,
+		store:   l.store,
+		limit:   l.limit,
+		burst:   l.burst,
+		key:     l.key,
+		retryAt: l.retryAt,
+		local:   l.local,
+	}
+}
+
+// WithClock sets clock to use. Default is to use system clock.
+func (l *SharedLimiter) WithClock(c clock.Clock) *SharedLimiter {
+	l = l.clone()
+	l.clock = c
+	return l
+}
+
+// WithKey sets function returning key of bucket to limit request by, so
+// every key is limited separately, e.g. by method:
+//
+//	limiter.WithKey(func(input bin.Encoder) string {
+//		if t, ok := input.(interface{ TypeName() string }); ok {
+//			return t.TypeName()
+//		}
+//		return ""
+//	})
+//
+// Requests with empty key are not limited.
+func (l *SharedLimiter) WithKey(f func(input bin.Encoder) string) *SharedLimiter {
+	l = l.clone()
+	l.key = f
+	return l
+}
+
+// reserve returns delay of request with given key at now.
+func (l *SharedLimiter) reserve(ctx context.Context, now time.Time, key string) (time.Duration, error) {
+	if now.UnixNano() >= l.retryAt.Load() {
+		storeCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+		defer cancel()
+
+		d, err := l.store.Reserve(storeCtx, key, now, l.limit, l.burst)
+		if err == nil {
+			return d, nil
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		// Fall back to local bucket for a while.
+		l.retryAt.Store(now.Add(storeBackoff).UnixNano())
+	}
+
+	r := l.local.get(key, l.limit, l.burst).ReserveN(now, 1)
+	if !r.OK() {
+		// Limiter requires n <= lim.burst for each reservation.
+		return 0, errors.New("limiter's burst size must be greater than zero")
+	}
+	return r.DelayFrom(now), nil
+}
+
+func (l *SharedLimiter) wait(ctx context.Context, input bin.Encoder) error {
+	// Check if ctx is already canceled.
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	key := l.key(input)
+	if key == "" {
+		return nil
+	}
+	if l.burst <= 0 {
+		return errors.New("limiter's burst size must be greater than zero")
+	}
+
+	d, err := l.reserve(ctx, l.clock.Now(), key)
+	if err != nil {
+		return err
+	}
+	if d == 0 {
+		return nil
+	}
+
+	// Bail out earlier if we exceed context deadline. Note that
+	// contexts use system time instead of mockable clock.
+	deadline, ok := ctx.Deadline()
+	if ok && d > time.Until(deadline) {
+		return context.DeadlineExceeded
+	}
+
+	start := l.clock.Now()
+	defer func() {
+		tracehook.Span(ctx, "tg.ratelimit", start, l.clock.Now())
+	}()
+	t := l.clock.Timer(d)
+	defer clock.StopTimer(t)
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Handle implements telegram.Middleware.
+func (l *SharedLimiter) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if err := l.wait(ctx, input); err != nil {
+			return err
+		}
+		return next.Invoke(ctx, input, output)
+	}
+}
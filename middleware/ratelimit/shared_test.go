@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+type memStore struct {
+	buckets map[string]*rate.Limiter
+	calls   int
+	err     error
+}
+
+func (s *memStore) Reserve(ctx context.Context, key string, now time.Time, limit rate.Limit, burst int) (time.Duration, error) {
+	s.calls++
+	if s.err != nil {
+		return 0, s.err
+	}
+	lim, ok := s.buckets[key]
+	if !ok {
+		lim = rate.NewLimiter(limit, burst)
+		s.buckets[key] = lim
+	}
+	return lim.ReserveN(now, 1).DelayFrom(now), nil
+}
+
+func TestSharedLimiter(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{buckets: map[string]*rate.Limiter{}}
+	l := NewSharedLimiter(store, 1, 1)
+	now := time.Now()
+
+	a := require.New(t)
+	reserve := func(key string) time.Duration {
+		d, err := l.reserve(ctx, now, key)
+		a.NoError(err)
+		return d
+	}
+	a.Zero(reserve(defaultSharedKey))
+	a.Equal(time.Second, reserve(defaultSharedKey))
+	a.Zero(reserve("messages.sendMessage"))
+	a.Equal(3, store.calls)
+
+	// Requests with empty key are not limited.
+	h := l.WithKey(func(input bin.Encoder) string { return "" }).Handle(invokeFunc(func() {}))
+	a.NoError(h.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil))
+	a.Equal(3, store.calls)
+}
+
+func TestSharedLimiterFallback(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{
+		buckets: map[string]*rate.Limiter{},
+		err:     errors.New("unavailable"),
+	}
+	l := NewSharedLimiter(store, 1, 1)
+	now := time.Now()
+
+	a := require.New(t)
+	d, err := l.reserve(ctx, now, "key")
+	a.NoError(err)
+	a.Zero(d)
+	// Store is not used for a while, local bucket limits requests.
+	d, err = l.reserve(ctx, now, "key")
+	a.NoError(err)
+	a.Equal(time.Second, d)
+	a.Equal(1, store.calls)
+
+	store.err = nil
+	now = now.Add(storeBackoff)
+	d, err = l.reserve(ctx, now, "key")
+	a.NoError(err)
+	a.Zero(d)
+	a.Equal(2, store.calls)
+}
@@ -0,0 +1,94 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// IsTransient reports whether err is a transient failure worth retrying.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if rpcErr, ok := tgerr.As(err); ok {
+		switch rpcErr.Code {
+		case 500, -503:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// Caller is gone, context.DeadlineExceeded is a net.Error too.
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// readPrefixes are prefixes of read method names.
+var readPrefixes = []string{ // nolint:gochecknoglobals
+	"get",
+	"search",
+	"check",
+	"resolve",
+}
+
+// IsSafe reports whether request can be safely sent again if result of
+// previous attempt is unknown.
+//
+// Reads, like messages.getHistory, and sends with random_id set are safe.
+// Reads with side effects, like messages.getBotCallbackAnswer or
+// auth.checkPassword with single-use SRP parameters, are not.
+func IsSafe(input bin.Encoder) bool {
+	switch v := input.(type) {
+	case *tg.MessagesGetBotCallbackAnswerRequest,
+		*tg.AuthCheckPasswordRequest,
+		*tg.AccountGetPasswordSettingsRequest,
+		*tg.AccountGetTmpPasswordRequest:
+		return false
+	case *tg.MessagesGetMessagesViewsRequest:
+		return !v.Increment
+	case interface{ GetRandomID() int64 }:
+		return v.GetRandomID() != 0
+	case interface{ GetRandomID() []int64 }:
+		return len(v.GetRandomID()) > 0
+	case interface {
+		GetMultiMedia() []tg.InputSingleMedia
+	}:
+		media := v.GetMultiMedia()
+		for _, m := range media {
+			if m.RandomID == 0 {
+				return false
+			}
+		}
+		return len(media) > 0
+	}
+
+	t, ok := input.(interface{ TypeName() string })
+	if !ok {
+		return false
+	}
+	name := t.TypeName()
+	if idx := strings.LastIndexByte(name, '.'); idx >= 0 {
+		name = name[idx+1:]
+	}
+	for _, prefix := range readPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,11 @@
+// Package retry implements a tg.Invoker that retries transient failures.
+//
+// Transient failures are internal server errors (code 500, like INTERNAL or
+// RPC_CALL_FAIL), timeouts (code -503) and transport errors. Flood waits are
+// not retried, use floodwait middleware for them.
+//
+// Such failures do not tell whether request was executed, so only requests
+// safe to repeat are retried: reads, like messages.getHistory, and sends
+// with random_id set, which server deduplicates. Use WithSafe to change
+// this classification.
+package retry
@@ -0,0 +1,184 @@
+package retry
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultMaxElapsed = 30 * time.Second
+	defaultMaxBackOff = 10 * time.Second
+)
+
+// Retry event.
+type Retry struct {
+	// Method is a TypeName of request, e.g. "messages.getHistory".
+	Method string
+	// Attempt is a number of the failed attempt, starting from 1.
+	Attempt int
+	// Delay is a time to wait before the next attempt.
+	Delay time.Duration
+	// Err is an error of the failed attempt.
+	Err error
+}
+
+// Retrier is a tg.Invoker that retries transient failures on underlying
+// invoker with exponential backoff.
+type Retrier struct {
+	clock      clock.Clock
+	newBackOff func() backoff.BackOff
+	maxRetries int
+	maxElapsed time.Duration
+	safe       func(input bin.Encoder) bool
+	onRetry    func(ctx context.Context, r Retry)
+}
+
+// New returns a new invoker that retries transient failures.
+func New() *Retrier {
+	return &Retrier{
+		clock:      clock.System,
+		maxRetries: defaultMaxRetries,
+		maxElapsed: defaultMaxElapsed,
+		safe:       IsSafe,
+		onRetry:    func(ctx context.Context, r Retry) {},
+	}
+}
+
+// backOff returns backoff policy for request.
+func (r *Retrier) backOff() backoff.BackOff {
+	if r.newBackOff != nil {
+		return r.newBackOff()
+	}
+
+	// Exponential backoff with jitter.
+	b := backoff.NewExponentialBackOff()
+	b.MaxInterval = defaultMaxBackOff
+	// Budget is checked by Retrier.
+	b.MaxElapsedTime = 0
+	b.Clock = r.clock
+	b.Reset()
+	return b
+}
+
+// clone returns a copy of the Retrier.
+func (r *Retrier) clone() *Retrier {
+	return &Retrier{
+		clock:      r.clock,
+		newBackOff: r.newBackOff,
+		maxRetries: r.maxRetries,
+		maxElapsed: r.maxElapsed,
+		safe:       r.safe,
+		onRetry:    r.onRetry,
+	}
+}
+
+// WithClock sets clock to use. Default is to use system clock.
+func (r *Retrier) WithClock(c clock.Clock) *Retrier {
+	r = r.clone()
+	r.clock = c
+	return r
+}
+
+// WithBackOff sets function creating backoff policy for every request.
+// Default is exponential backoff with jitter, starting from 500ms and
+// growing up to 10s.
+func (r *Retrier) WithBackOff(f func() backoff.BackOff) *Retrier {
+	r = r.clone()
+	r.newBackOff = f
+	return r
+}
+
+// WithMaxRetries sets max number of retries before giving up. Default is to
+// retry at most 5 times. Zero means no limit.
+func (r *Retrier) WithMaxRetries(m int) *Retrier {
+	r = r.clone()
+	r.maxRetries = m
+	return r
+}
+
+// WithMaxElapsed limits total time of retrying request: Retrier gives up if
+// the next attempt would start after that. Default is 30 seconds. Zero means
+// no limit.
+//
+// To limit total time including the last attempt use a context.Context with
+// timeout or deadline set.
+func (r *Retrier) WithMaxElapsed(d time.Duration) *Retrier {
+	r = r.clone()
+	r.maxElapsed = d
+	return r
+}
+
+// WithSafe sets function reporting whether request is safe to retry.
+// Default is IsSafe.
+func (r *Retrier) WithSafe(f func(input bin.Encoder) bool) *Retrier {
+	r = r.clone()
+	r.safe = f
+	return r
+}
+
+// WithCallback sets callback for retry event.
+func (r *Retrier) WithCallback(f func(ctx context.Context, r Retry)) *Retrier {
+	r = r.clone()
+	r.onRetry = f
+	return r
+}
+
+// Handle implements telegram.Middleware.
+func (r *Retrier) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		err := next.Invoke(ctx, input, output)
+		if !IsTransient(err) || !r.safe(input) {
+			return err
+		}
+
+		var method string
+		if t, ok := input.(interface{ TypeName() string }); ok {
+			method = t.TypeName()
+		}
+
+		start := r.clock.Now()
+		b := r.backOff()
+		for attempt := 1; ; attempt++ {
+			if r.maxRetries != 0 && attempt > r.maxRetries {
+				return errors.Wrapf(err, "retry limit exceeded (%d > %d)", attempt, r.maxRetries)
+			}
+			d := b.NextBackOff()
+			if d == backoff.Stop {
+				return errors.Wrap(err, "backoff stopped")
+			}
+			if elapsed := r.clock.Now().Sub(start) + d; r.maxElapsed != 0 && elapsed > r.maxElapsed {
+				return errors.Wrapf(err, "retry time limit exceeded (%v > %v)", elapsed, r.maxElapsed)
+			}
+
+			r.onRetry(ctx, Retry{
+				Method:  method,
+				Attempt: attempt,
+				Delay:   d,
+				Err:     err,
+			})
+			if d > 0 {
+				t := r.clock.Timer(d)
+				select {
+				case <-t.C():
+				case <-ctx.Done():
+					clock.StopTimer(t)
+					return ctx.Err()
+				}
+			}
+
+			err = next.Invoke(ctx, input, output)
+			if !IsTransient(err) {
+				return err
+			}
+		}
+	}
+}
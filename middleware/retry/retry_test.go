@@ -0,0 +1,168 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+func TestIsTransient(t *testing.T) {
+	for _, tt := range []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{tgerr.New(500, "INTERNAL"), true},
+		{tgerr.New(500, "RPC_CALL_FAIL"), true},
+		{tgerr.New(-503, "Timeout"), true},
+		{errors.Wrap(tgerr.New(500, "INTERNAL"), "invoke"), true},
+		{io.ErrUnexpectedEOF, true},
+		{tgerr.New(420, "FLOOD_WAIT_10"), false},
+		{tgerr.New(400, "PEER_ID_INVALID"), false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{errors.Wrap(context.DeadlineExceeded, "invoke"), false},
+		{&net.OpError{Op: "read", Err: io.ErrUnexpectedEOF}, true},
+	} {
+		require.Equal(t, tt.transient, IsTransient(tt.err), "%v", tt.err)
+	}
+}
+
+func TestIsSafe(t *testing.T) {
+	peer := &tg.InputPeerSelf{}
+	for _, tt := range []struct {
+		input bin.Encoder
+		safe  bool
+	}{
+		{&tg.MessagesGetHistoryRequest{Peer: peer}, true},
+		{&tg.ContactsResolveUsernameRequest{Username: "gotd"}, true},
+		{&tg.MessagesSearchRequest{Peer: peer}, true},
+		{&tg.MessagesSendMessageRequest{Peer: peer, RandomID: 1}, true},
+		{&tg.MessagesSendMessageRequest{Peer: peer}, false},
+		{&tg.MessagesForwardMessagesRequest{ToPeer: peer, RandomID: []int64{1}}, true},
+		{&tg.MessagesForwardMessagesRequest{ToPeer: peer}, false},
+		{&tg.MessagesSendMultiMediaRequest{Peer: peer, MultiMedia: []tg.InputSingleMedia{{RandomID: 1}}}, true},
+		{&tg.MessagesSendMultiMediaRequest{Peer: peer, MultiMedia: []tg.InputSingleMedia{{RandomID: 1}, {}}}, false},
+		{&tg.MessagesDeleteMessagesRequest{ID: []int{1}}, false},
+		// Reads with side effects.
+		{&tg.MessagesGetBotCallbackAnswerRequest{Peer: peer}, false},
+		{&tg.MessagesGetMessagesViewsRequest{Peer: peer, ID: []int{1}, Increment: true}, false},
+		{&tg.MessagesGetMessagesViewsRequest{Peer: peer, ID: []int{1}}, true},
+		{&tg.AuthCheckPasswordRequest{Password: &tg.InputCheckPasswordEmpty{}}, false},
+	} {
+		require.Equal(t, tt.safe, IsSafe(tt.input), "%T", tt.input)
+	}
+}
+
+type invokeFunc func() error
+
+func (f invokeFunc) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	return f()
+}
+
+// failing returns invoker failing with given errors, then succeeding.
+func failing(calls *int, errs ...error) invokeFunc {
+	return func() error {
+		*calls++
+		if *calls <= len(errs) {
+			return errs[*calls-1]
+		}
+		return nil
+	}
+}
+
+func TestRetrier(t *testing.T) {
+	ctx := context.Background()
+	internal := tgerr.New(500, "INTERNAL")
+	zero := func() backoff.BackOff { return &backoff.ZeroBackOff{} }
+	safe := &tg.MessagesGetHistoryRequest{Peer: &tg.InputPeerSelf{}}
+
+	t.Run("Retry", func(t *testing.T) {
+		a := require.New(t)
+		var (
+			calls  int
+			events []Retry
+		)
+		h := New().WithBackOff(zero).WithCallback(func(ctx context.Context, r Retry) {
+			events = append(events, r)
+		}).Handle(failing(&calls, internal, io.EOF))
+
+		a.NoError(h.Invoke(ctx, safe, nil))
+		a.Equal(3, calls)
+		a.Equal([]Retry{
+			{Method: "messages.getHistory", Attempt: 1, Err: internal},
+			{Method: "messages.getHistory", Attempt: 2, Err: io.EOF},
+		}, events)
+	})
+	t.Run("Unsafe", func(t *testing.T) {
+		a := require.New(t)
+		var calls int
+		h := New().WithBackOff(zero).Handle(failing(&calls, internal))
+
+		a.ErrorIs(h.Invoke(ctx, &tg.MessagesSendMessageRequest{Peer: &tg.InputPeerSelf{}}, nil), internal)
+		a.Equal(1, calls)
+	})
+	t.Run("Permanent", func(t *testing.T) {
+		a := require.New(t)
+		var calls int
+		h := New().WithBackOff(zero).Handle(failing(&calls, internal, tgerr.New(400, "PEER_ID_INVALID")))
+
+		a.True(tgerr.Is(h.Invoke(ctx, safe, nil), "PEER_ID_INVALID"))
+		a.Equal(2, calls)
+	})
+	t.Run("MaxRetries", func(t *testing.T) {
+		a := require.New(t)
+		var calls int
+		h := New().WithBackOff(zero).WithMaxRetries(2).Handle(failing(&calls, internal, internal, internal, internal))
+
+		a.ErrorIs(h.Invoke(ctx, safe, nil), internal)
+		a.Equal(3, calls)
+	})
+	t.Run("MaxElapsed", func(t *testing.T) {
+		a := require.New(t)
+		var calls int
+		h := New().WithBackOff(func() backoff.BackOff {
+			return backoff.NewConstantBackOff(time.Hour)
+		}).Handle(failing(&calls, internal))
+
+		a.ErrorIs(h.Invoke(ctx, safe, nil), internal)
+		a.Equal(1, calls)
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		a := require.New(t)
+		var calls int
+		ctx, cancel := context.WithCancel(ctx)
+		h := New().WithCallback(func(ctx context.Context, r Retry) {
+			cancel()
+		}).Handle(failing(&calls, internal))
+
+		a.ErrorIs(h.Invoke(ctx, safe, nil), context.Canceled)
+		a.Equal(1, calls)
+	})
+	for _, err := range []error{context.Canceled, context.DeadlineExceeded} {
+		t.Run("Caller/"+err.Error(), func(t *testing.T) {
+			a := require.New(t)
+			var (
+				calls   int
+				retried bool
+			)
+			h := New().WithBackOff(zero).WithCallback(func(ctx context.Context, r Retry) {
+				retried = true
+			}).Handle(failing(&calls, errors.Wrap(err, "invoke")))
+
+			a.ErrorIs(h.Invoke(ctx, safe, nil), err)
+			a.Equal(1, calls)
+			a.False(retried)
+		})
+	}
+}
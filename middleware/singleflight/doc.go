@@ -0,0 +1,10 @@
+// Package singleflight implements a tg.Invoker that merges identical
+// in-flight requests.
+//
+// If a request is already being sent, identical requests wait for its
+// result instead of being sent again. Requests are identical if their
+// TL-encoded bytes, which start with type ID, are equal. Every caller gets
+// its own decoded copy of the result.
+//
+// Only read requests from the allowlist, see DefaultMethods, are merged.
+package singleflight
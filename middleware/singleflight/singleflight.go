@@ -0,0 +1,182 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// DefaultMethods returns default allowlist of methods to merge.
+func DefaultMethods() []string {
+	return []string{
+		"users.getFullUser",
+		"users.getUsers",
+		"channels.getFullChannel",
+		"channels.getChannels",
+		"messages.getFullChat",
+		"messages.getChats",
+		"contacts.resolveUsername",
+		"help.getConfig",
+		"help.getNearestDc",
+		"help.getAppConfig",
+	}
+}
+
+// rawResult is a bin.Decoder copying raw result.
+type rawResult struct {
+	data []byte
+}
+
+// Decode implements bin.Decoder.
+func (r *rawResult) Decode(b *bin.Buffer) error {
+	r.data = append(r.data[:0], b.Buf...)
+	b.Skip(len(b.Buf))
+	return nil
+}
+
+// call is an in-flight request.
+type call struct {
+	done    chan struct{}
+	result  []byte
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// calls is a state shared by Group copies.
+type calls struct {
+	mux   sync.Mutex
+	calls map[string]*call
+}
+
+// Group is a tg.Invoker that merges identical in-flight requests.
+//
+// Merged request is sent with context of the first caller, but it is
+// canceled only when every caller is gone.
+//
+// Middlewares called after Group get raw result decoder instead of typed
+// result, so middlewares inspecting results should be called before it.
+type Group struct {
+	methods map[string]struct{}
+	state   *calls
+}
+
+// New returns a new invoker merging identical in-flight requests of
+// DefaultMethods.
+func New() *Group {
+	return (&Group{
+		state: &calls{calls: map[string]*call{}},
+	}).WithMethods(DefaultMethods()...)
+}
+
+// clone returns a copy of the Group.
+func (g *Group) clone() *Group {
+	return &Group{
+		methods: g.methods,
+		state:   g.state,
+	}
+}
+
+// WithMethods sets allowlist of methods to merge, e.g. "users.getFullUser".
+// Only read methods should be merged. Default is DefaultMethods.
+func (g *Group) WithMethods(methods ...string) *Group {
+	g = g.clone()
+	g.methods = make(map[string]struct{}, len(methods))
+	for _, m := range methods {
+		g.methods[m] = struct{}{}
+	}
+	return g
+}
+
+// allowed reports whether request can be merged.
+func (g *Group) allowed(input bin.Encoder) bool {
+	t, ok := input.(interface{ TypeName() string })
+	if !ok {
+		return false
+	}
+	_, ok = g.methods[t.TypeName()]
+	return ok
+}
+
+// join returns call of request with given key, starting it if necessary.
+func (g *Group) join(ctx context.Context, key string, input bin.Encoder, next tg.Invoker) *call {
+	g.state.mux.Lock()
+	defer g.state.mux.Unlock()
+
+	if c, ok := g.state.calls[key]; ok {
+		c.waiters++
+		return c
+	}
+
+	// Request is shared, so it is not canceled along with the first caller.
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &call{
+		done:    make(chan struct{}),
+		waiters: 1,
+		cancel:  cancel,
+	}
+	g.state.calls[key] = c
+
+	go func() {
+		defer cancel()
+
+		var r rawResult
+		err := next.Invoke(callCtx, input, &r)
+
+		g.state.mux.Lock()
+		if g.state.calls[key] == c {
+			delete(g.state.calls, key)
+		}
+		g.state.mux.Unlock()
+
+		c.result, c.err = r.data, err
+		close(c.done)
+	}()
+	return c
+}
+
+// leave removes waiter of call, canceling it if there are no waiters left.
+func (g *Group) leave(key string, c *call) {
+	g.state.mux.Lock()
+	defer g.state.mux.Unlock()
+
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	if g.state.calls[key] == c {
+		// Following identical requests start a new call.
+		delete(g.state.calls, key)
+	}
+	c.cancel()
+}
+
+// Handle implements telegram.Middleware.
+func (g *Group) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if !g.allowed(input) {
+			return next.Invoke(ctx, input, output)
+		}
+		var b bin.Buffer
+		if err := input.Encode(&b); err != nil {
+			// Let invoker report error.
+			return next.Invoke(ctx, input, output)
+		}
+		key := string(b.Buf)
+
+		c := g.join(ctx, key, input, next)
+		select {
+		case <-c.done:
+			if c.err != nil {
+				return c.err
+			}
+			return output.Decode(&bin.Buffer{Buf: append([]byte(nil), c.result...)})
+		case <-ctx.Done():
+			g.leave(key, c)
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package singleflight
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// blockingInvoker returns result of request after release is closed.
+type blockingInvoker struct {
+	calls   atomic.Int64
+	release chan struct{}
+	err     error
+	// ctx is a context of the last call.
+	ctx chan context.Context
+}
+
+func newBlockingInvoker() *blockingInvoker {
+	return &blockingInvoker{
+		release: make(chan struct{}),
+		ctx:     make(chan context.Context, 10),
+	}
+}
+
+func (i *blockingInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	i.calls.Inc()
+	i.ctx <- ctx
+	<-i.release
+	if i.err != nil {
+		return i.err
+	}
+
+	var b bin.Buffer
+	if err := (&tg.Config{ThisDC: 2, DCTxtDomainName: "example.org"}).Encode(&b); err != nil {
+		return err
+	}
+	return output.Decode(&b)
+}
+
+// waiters returns number of callers waiting for identical requests.
+func (g *Group) waiters() int {
+	g.state.mux.Lock()
+	defer g.state.mux.Unlock()
+
+	var n int
+	for _, c := range g.state.calls {
+		n += c.waiters
+	}
+	return n
+}
+
+func waitFor(t *testing.T, f func() bool) {
+	t.Helper()
+	require.Eventually(t, f, 5*time.Second, time.Millisecond)
+}
+
+func TestGroup(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Merge", func(t *testing.T) {
+		a := require.New(t)
+		next := newBlockingInvoker()
+		g := New()
+		h := g.Handle(next)
+
+		results := make(chan *tg.Config, 3)
+		for i := 0; i < 3; i++ {
+			go func() {
+				var cfg tg.Config
+				if err := h.Invoke(ctx, &tg.HelpGetConfigRequest{}, &cfg); err != nil {
+					t.Error(err)
+				}
+				results <- &cfg
+			}()
+		}
+		waitFor(t, func() bool { return g.waiters() == 3 })
+		close(next.release)
+
+		first := <-results
+		for i := 0; i < 2; i++ {
+			cfg := <-results
+			a.NotSame(first, cfg)
+			a.Equal(first, cfg)
+		}
+		a.Equal(2, first.ThisDC)
+		a.Equal(int64(1), next.calls.Load())
+		a.Zero(g.waiters())
+	})
+	t.Run("DifferentArguments", func(t *testing.T) {
+		a := require.New(t)
+		next := newBlockingInvoker()
+		close(next.release)
+		next.err = errors.New("failed")
+		h := New().Handle(next)
+
+		for _, id := range []int64{1, 2} {
+			err := h.Invoke(ctx, &tg.UsersGetFullUserRequest{
+				ID: &tg.InputUser{UserID: id},
+			}, &tg.UsersUserFull{})
+			a.ErrorIs(err, next.err)
+		}
+		a.Equal(int64(2), next.calls.Load())
+	})
+	t.Run("NotAllowed", func(t *testing.T) {
+		a := require.New(t)
+		next := newBlockingInvoker()
+		g := New().WithMethods("users.getUsers")
+		h := g.Handle(next)
+
+		done := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				done <- h.Invoke(ctx, &tg.HelpGetConfigRequest{}, &tg.Config{})
+			}()
+		}
+		waitFor(t, func() bool { return next.calls.Load() == 2 })
+		close(next.release)
+		for i := 0; i < 2; i++ {
+			a.NoError(<-done)
+		}
+	})
+	t.Run("Cancel", func(t *testing.T) {
+		a := require.New(t)
+		next := newBlockingInvoker()
+		g := New()
+		h := g.Handle(next)
+
+		first, cancelFirst := context.WithCancel(ctx)
+		firstDone := make(chan error, 1)
+		go func() {
+			firstDone <- h.Invoke(first, &tg.HelpGetConfigRequest{}, &tg.Config{})
+		}()
+		callCtx := <-next.ctx
+
+		second, cancelSecond := context.WithCancel(ctx)
+		secondDone := make(chan error, 1)
+		go func() {
+			secondDone <- h.Invoke(second, &tg.HelpGetConfigRequest{}, &tg.Config{})
+		}()
+		waitFor(t, func() bool { return g.waiters() == 2 })
+
+		// Request is not canceled while someone is waiting.
+		cancelFirst()
+		a.ErrorIs(<-firstDone, context.Canceled)
+		a.NoError(callCtx.Err())
+
+		cancelSecond()
+		a.ErrorIs(<-secondDone, context.Canceled)
+		a.ErrorIs(callCtx.Err(), context.Canceled)
+		close(next.release)
+		a.Equal(int64(1), next.calls.Load())
+	})
+}
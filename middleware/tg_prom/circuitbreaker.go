@@ -0,0 +1,71 @@
+package tg_prom
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/gotd/contrib/middleware/circuitbreaker"
+)
+
+const (
+	labelCircuit = "tg_circuit"
+	labelFrom    = "from"
+	labelTo      = "to"
+)
+
+// CircuitBreaker is prometheus metrics for circuitbreaker.Breaker.
+//
+// Use Callback as circuitbreaker.Breaker callback to record state changes:
+//
+//	metrics, err := tg_prom.NewCircuitBreaker(tg_prom.Options{
+//		Registerer: prometheus.DefaultRegisterer,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	breaker = breaker.WithCallback(metrics.Callback)
+type CircuitBreaker struct {
+	state   *prometheus.GaugeVec
+	changes *prometheus.CounterVec
+}
+
+// NewCircuitBreaker initializes and returns new prometheus metrics for
+// circuit breaker, registering them with Options.Registerer, if any.
+//
+// Options.DurationBuckets and Options.SizeBuckets are not used.
+func NewCircuitBreaker(opts Options) (*CircuitBreaker, error) {
+	m := &CircuitBreaker{
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_circuitbreaker_state",
+			Help:        "Telegram circuit breaker state: 0 is closed, 1 is open, 2 is half-open.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{labelCircuit}),
+		changes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_circuitbreaker_state_changes_total",
+			Help:        "Telegram circuit breaker state changes total count.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{labelCircuit, labelFrom, labelTo}),
+	}
+
+	if err := register(opts.Registerer, m.Metrics()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Callback is a circuitbreaker.Breaker callback, see circuitbreaker.Breaker.WithCallback.
+func (m *CircuitBreaker) Callback(ctx context.Context, c circuitbreaker.StateChange) {
+	m.state.WithLabelValues(c.Key).Set(float64(c.To))
+	m.changes.WithLabelValues(c.Key, c.From.String(), c.To.String()).Inc()
+}
+
+// Metrics returns slice of provided prometheus metrics.
+func (m *CircuitBreaker) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.state,
+		m.changes,
+	}
+}
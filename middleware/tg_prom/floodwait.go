@@ -0,0 +1,92 @@
+package tg_prom
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/gotd/contrib/middleware/floodwait"
+)
+
+// FloodWait is prometheus metrics for floodwait.Waiter.
+//
+// Use Callback as floodwait.Waiter callback to count waits:
+//
+//	metrics, err := tg_prom.NewFloodWait(waiter, tg_prom.Options{
+//		Registerer: prometheus.DefaultRegisterer,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	waiter = waiter.WithCallback(metrics.Callback)
+type FloodWait struct {
+	waits     *prometheus.CounterVec
+	waitTime  *prometheus.CounterVec
+	queued    prometheus.GaugeFunc
+	penalties prometheus.GaugeFunc
+}
+
+// NewFloodWait initializes and returns new prometheus metrics for given
+// waiter, registering them with Options.Registerer, if any.
+//
+// Options.DurationBuckets and Options.SizeBuckets are not used.
+func NewFloodWait(w *floodwait.Waiter, opts Options) (*FloodWait, error) {
+	m := &FloodWait{
+		waits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_floodwait_waits_total",
+			Help:        "Telegram flood waits total count.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{labelMethod, labelErrType}),
+		waitTime: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_floodwait_wait_seconds_total",
+			Help:        "Telegram flood waits total duration of retried requests.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{labelMethod, labelErrType}),
+		queued: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_floodwait_queue_length",
+			Help:        "Telegram requests waiting to be sent.",
+			ConstLabels: opts.ConstLabels,
+		}, func() float64 {
+			return float64(w.Stats().Queued)
+		}),
+		penalties: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_floodwait_active_penalties",
+			Help:        "Telegram flood wait penalties currently delaying requests.",
+			ConstLabels: opts.ConstLabels,
+		}, func() float64 {
+			return float64(w.Stats().Penalties)
+		}),
+	}
+
+	if err := register(opts.Registerer, m.Metrics()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Callback is a floodwait.Waiter callback, see floodwait.Waiter.WithCallback.
+func (m *FloodWait) Callback(ctx context.Context, wait floodwait.FloodWait) {
+	labels := prometheus.Labels{
+		labelMethod:  wait.Method,
+		labelErrType: wait.Type,
+	}
+	m.waits.With(labels).Inc()
+	if !wait.Scheduled.IsZero() {
+		// Request is not retried, so it does not wait.
+		m.waitTime.With(labels).Add(wait.Duration.Seconds())
+	}
+}
+
+// Metrics returns slice of provided prometheus metrics.
+func (m *FloodWait) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.waits,
+		m.waitTime,
+		m.queued,
+		m.penalties,
+	}
+}
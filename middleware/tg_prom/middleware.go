@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/go-faster/errors"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/gotd/td/bin"
@@ -14,11 +15,41 @@ import (
 	"github.com/gotd/td/tgerr"
 )
 
+// Options of Middleware.
+type Options struct {
+	// Namespace of metrics, e.g. "bot" for "bot_tg_rpc_count_total".
+	Namespace string
+	// ConstLabels are labels added to all metrics, e.g. account.
+	ConstLabels prometheus.Labels
+	// DurationBuckets are buckets of RPC calls duration histogram, in
+	// seconds. Default is prometheus.DefBuckets.
+	DurationBuckets []float64
+	// SizeBuckets are buckets of request and response payload size
+	// histograms, in bytes. Default is exponential buckets from 64 bytes to
+	// 1 MiB.
+	SizeBuckets []float64
+	// Registerer to register metrics with. If nil, metrics are not
+	// registered, see Middleware.Metrics.
+	Registerer prometheus.Registerer
+}
+
+func (o *Options) setDefaults() {
+	if o.DurationBuckets == nil {
+		o.DurationBuckets = prometheus.DefBuckets
+	}
+	if o.SizeBuckets == nil {
+		o.SizeBuckets = prometheus.ExponentialBuckets(64, 4, 8)
+	}
+}
+
 // Middleware is prometheus metrics middleware for Telegram.
 type Middleware struct {
-	count    *prometheus.CounterVec
-	failures *prometheus.CounterVec
-	duration prometheus.ObserverVec
+	count        *prometheus.CounterVec
+	failures     *prometheus.CounterVec
+	duration     prometheus.ObserverVec
+	inFlight     *prometheus.GaugeVec
+	requestSize  prometheus.ObserverVec
+	responseSize prometheus.ObserverVec
 }
 
 // Metrics returns slice of provided prometheus metrics.
@@ -27,6 +58,9 @@ func (m Middleware) Metrics() []prometheus.Collector {
 		m.count,
 		m.failures,
 		m.duration,
+		m.inFlight,
+		m.requestSize,
+		m.responseSize,
 	}
 }
 
@@ -36,16 +70,73 @@ const (
 	labelMethod  = "tg_method"
 )
 
+// size returns size of TL-encoded value, or false if it can't be encoded.
+func size(v interface{}) (int, bool) {
+	e, ok := v.(bin.Encoder)
+	if !ok {
+		return 0, false
+	}
+	var b bin.Buffer
+	if err := e.Encode(&b); err != nil {
+		return 0, false
+	}
+	return b.Len(), true
+}
+
+// sizeDecoder is a bin.Decoder recording size of decoded TL-encoded value.
+type sizeDecoder struct {
+	next bin.Decoder
+	size int
+	ok   bool
+}
+
+// Decode implements bin.Decoder.
+func (d *sizeDecoder) Decode(b *bin.Buffer) error {
+	d.size, d.ok = b.Len(), true
+	return d.next.Decode(b)
+}
+
+// sizeCodec is a sizeDecoder of result which can be encoded, so middlewares
+// requiring encodable result, like cache, keep working.
+type sizeCodec struct {
+	*sizeDecoder
+	enc bin.Encoder
+}
+
+// Encode implements bin.Encoder.
+func (c sizeCodec) Encode(b *bin.Buffer) error {
+	return c.enc.Encode(b)
+}
+
+// wrapOutput returns output recording size of decoded result to d.
+func wrapOutput(output bin.Decoder, d *sizeDecoder) bin.Decoder {
+	if e, ok := output.(bin.Encoder); ok {
+		return sizeCodec{sizeDecoder: d, enc: e}
+	}
+	return d
+}
+
 // Handle implements telegram.Middleware.
+//
+// Result is passed to next invoker wrapped to measure its size without
+// re-encoding, so middlewares checking concrete result type, like
+// invoker.UpdateHook, should be placed before this one.
 func (m Middleware) Handle(next tg.Invoker) telegram.InvokeFunc {
 	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
 		// Prepare.
 		labels := m.labels(input)
 		m.count.With(labels).Inc()
+		if n, ok := size(input); ok {
+			m.requestSize.With(labels).Observe(float64(n))
+		}
+		inFlight := m.inFlight.With(labels)
+		inFlight.Inc()
+		defer inFlight.Dec()
 		start := time.Now()
 
 		// Call actual method.
-		err := next.Invoke(ctx, input, output)
+		result := &sizeDecoder{next: output}
+		err := next.Invoke(ctx, input, wrapOutput(output, result))
 
 		// Observe.
 		m.duration.With(labels).Observe(time.Since(start).Seconds())
@@ -59,8 +150,11 @@ func (m Middleware) Handle(next tg.Invoker) telegram.InvokeFunc {
 				failureLabels[labelErrCode] = strconv.Itoa(rpcErr.Code)
 			} else {
 				failureLabels[labelErrType] = "CLIENT"
+				failureLabels[labelErrCode] = ""
 			}
-			m.failures.With(failureLabels)
+			m.failures.With(failureLabels).Inc()
+		} else if result.ok {
+			m.responseSize.With(labels).Observe(float64(result.size))
 		}
 
 		return err
@@ -73,29 +167,88 @@ type object interface {
 }
 
 func (m Middleware) labels(input bin.Encoder) prometheus.Labels {
-	obj, ok := input.(object)
-	if !ok {
-		return prometheus.Labels{}
+	var method string
+	if obj, ok := input.(object); ok {
+		method = obj.TypeName()
 	}
 	return prometheus.Labels{
-		labelMethod: obj.TypeName(),
+		labelMethod: method,
 	}
 }
 
-// New initializes and returns new prometheus middleware.
+// New initializes and returns new prometheus middleware with default
+// options.
 func New() *Middleware {
-	return &Middleware{
+	// Never fails without registerer.
+	m, _ := NewWithOptions(Options{})
+	return m
+}
+
+// NewWithOptions initializes and returns new prometheus middleware,
+// registering its metrics with Options.Registerer, if any.
+func NewWithOptions(opts Options) (*Middleware, error) {
+	opts.setDefaults()
+	m := &Middleware{
 		count: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "tg_rpc_count_total",
-			Help: "Telegram RPC calls total count.",
+			Namespace:   opts.Namespace,
+			Name:        "tg_rpc_count_total",
+			Help:        "Telegram RPC calls total count.",
+			ConstLabels: opts.ConstLabels,
 		}, []string{labelMethod}),
 		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
-			Name: "tg_rpc_duration_seconds",
-			Help: "Telegram RPC calls duration histogram.",
+			Namespace:   opts.Namespace,
+			Name:        "tg_rpc_duration_seconds",
+			Help:        "Telegram RPC calls duration histogram.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.DurationBuckets,
 		}, []string{labelMethod}),
 		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "tg_rpc_failures_total",
-			Help: "Telegram failed RPC calls total count.",
+			Namespace:   opts.Namespace,
+			Name:        "tg_rpc_failures_total",
+			Help:        "Telegram failed RPC calls total count.",
+			ConstLabels: opts.ConstLabels,
 		}, []string{labelMethod, labelErrCode, labelErrType}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_rpc_in_flight",
+			Help:        "Telegram RPC calls in flight.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{labelMethod}),
+		requestSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_rpc_request_size_bytes",
+			Help:        "Telegram RPC requests TL payload size histogram.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.SizeBuckets,
+		}, []string{labelMethod}),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_rpc_response_size_bytes",
+			Help:        "Telegram RPC responses TL payload size histogram.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.SizeBuckets,
+		}, []string{labelMethod}),
+	}
+
+	if err := register(opts.Registerer, m.Metrics()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// register registers collectors with given registerer, if any. Already
+// registered collectors are unregistered on failure.
+func register(r prometheus.Registerer, collectors []prometheus.Collector) error {
+	if r == nil {
+		return nil
+	}
+	for i, c := range collectors {
+		if err := r.Register(c); err != nil {
+			for _, registered := range collectors[:i] {
+				r.Unregister(registered)
+			}
+			return errors.Wrap(err, "register")
+		}
 	}
+	return nil
 }
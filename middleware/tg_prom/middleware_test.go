@@ -1,10 +1,23 @@
 package tg_prom
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+
+	"github.com/gotd/contrib/middleware/circuitbreaker"
+	"github.com/gotd/contrib/middleware/floodwait"
 )
 
 func TestPrometheus(t *testing.T) {
@@ -15,3 +28,158 @@ func TestPrometheus(t *testing.T) {
 		require.NoError(t, r.Register(m))
 	}
 }
+
+func TestMiddleware(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	r := prometheus.NewPedanticRegistry()
+	m, err := NewWithOptions(Options{
+		Namespace:   "bot",
+		ConstLabels: prometheus.Labels{"account": "1"},
+		Registerer:  r,
+	})
+	a.NoError(err)
+
+	var inFlight float64
+	raw := tg.NewClient(m.Handle(telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if _, ok := input.(*tg.HelpGetConfigRequest); ok {
+			return tgerr.New(500, "INTERNAL")
+		}
+		inFlight = testutil.ToFloat64(m.inFlight.WithLabelValues("messages.sendMessage"))
+		var b bin.Buffer
+		if err := (&tg.Updates{}).Encode(&b); err != nil {
+			return err
+		}
+		return output.Decode(&b)
+	})))
+
+	_, err = raw.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:    &tg.InputPeerSelf{},
+		Message: "hello",
+	})
+	a.NoError(err)
+	a.Equal(1.0, inFlight)
+	a.Equal(0.0, testutil.ToFloat64(m.inFlight.WithLabelValues("messages.sendMessage")))
+
+	_, err = raw.HelpGetConfig(ctx)
+	a.Error(err)
+	a.Equal(1.0, testutil.ToFloat64(m.failures))
+
+	a.Equal(2, testutil.CollectAndCount(m.requestSize))
+	a.Equal(1, testutil.CollectAndCount(m.responseSize))
+	a.NoError(testutil.GatherAndCompare(r, strings.NewReader(`
+# HELP bot_tg_rpc_failures_total Telegram failed RPC calls total count.
+# TYPE bot_tg_rpc_failures_total counter
+bot_tg_rpc_failures_total{account="1",tg_err_code="500",tg_err_type="INTERNAL",tg_method="help.getConfig"} 1
+`), "bot_tg_rpc_failures_total"))
+
+	// Response size is a size of decoded result.
+	var updates bin.Buffer
+	a.NoError((&tg.Updates{}).Encode(&updates))
+	families, err := r.Gather()
+	a.NoError(err)
+	var responseSize float64
+	for _, f := range families {
+		if f.GetName() == "bot_tg_rpc_response_size_bytes" {
+			responseSize = f.GetMetric()[0].GetHistogram().GetSampleSum()
+		}
+	}
+	a.Equal(float64(updates.Len()), responseSize)
+
+	// Already registered.
+	_, err = NewWithOptions(Options{Namespace: "bot", Registerer: r})
+	a.Error(err)
+}
+
+func TestRegisterFailure(t *testing.T) {
+	a := require.New(t)
+	r := prometheus.NewPedanticRegistry()
+	a.NoError(r.Register(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tg_rpc_response_size_bytes",
+		Help: "Conflicting metric.",
+	})))
+
+	_, err := NewWithOptions(Options{Registerer: r})
+	a.Error(err)
+
+	// Metrics registered before failure are unregistered.
+	m := New()
+	for _, c := range m.Metrics()[:5] {
+		a.NoError(r.Register(c))
+	}
+}
+
+func TestFloodWait(t *testing.T) {
+	r := prometheus.NewPedanticRegistry()
+	m, err := NewFloodWait(floodwait.NewWaiter(), Options{
+		Namespace:   "bot",
+		ConstLabels: prometheus.Labels{"account": "test"},
+		Registerer:  r,
+	})
+	require.NoError(t, err)
+
+	wait := floodwait.FloodWait{
+		Duration:  5 * time.Second,
+		Method:    "messages.sendMessage",
+		Type:      "FLOOD_WAIT",
+		Scheduled: time.Now().Add(5 * time.Second),
+	}
+	m.Callback(context.Background(), wait)
+	// Not retried because of retry limits.
+	wait.Scheduled = time.Time{}
+	m.Callback(context.Background(), wait)
+	require.Equal(t, 5.0, testutil.ToFloat64(m.waitTime))
+	require.Equal(t, 2.0, testutil.ToFloat64(m.waits))
+	require.Equal(t, 0.0, testutil.ToFloat64(m.queued))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	r := prometheus.NewPedanticRegistry()
+	m, err := NewCircuitBreaker(Options{
+		Namespace:   "bot",
+		ConstLabels: prometheus.Labels{"account": "test"},
+		Registerer:  r,
+	})
+	require.NoError(t, err)
+
+	m.Callback(context.Background(), circuitbreaker.StateChange{
+		Key:  "upload.getFile",
+		From: circuitbreaker.Closed,
+		To:   circuitbreaker.Open,
+	})
+	require.Equal(t, 1.0, testutil.ToFloat64(m.state))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.changes))
+}
+
+func TestUpdateHandler(t *testing.T) {
+	a := require.New(t)
+	r := prometheus.NewPedanticRegistry()
+	m, err := NewUpdateHandler(Options{
+		Namespace:   "bot",
+		ConstLabels: prometheus.Labels{"account": "test"},
+		Registerer:  r,
+	})
+	a.NoError(err)
+
+	failure := errors.New("failure")
+	h := m.Wrap(telegram.UpdateHandlerFunc(func(ctx context.Context, u tg.UpdatesClass) error {
+		if _, ok := u.(*tg.UpdatesTooLong); ok {
+			return failure
+		}
+		return nil
+	}))
+	ctx := context.Background()
+	a.NoError(h.Handle(ctx, &tg.Updates{
+		Updates: []tg.UpdateClass{
+			&tg.UpdateNewMessage{Message: &tg.MessageEmpty{}},
+			&tg.UpdateNewMessage{Message: &tg.MessageEmpty{}},
+		},
+	}))
+	a.ErrorIs(h.Handle(ctx, &tg.UpdatesTooLong{}), failure)
+
+	a.Equal(2.0, testutil.ToFloat64(m.updates.WithLabelValues("updateNewMessage")))
+	a.Equal(1.0, testutil.ToFloat64(m.updates.WithLabelValues("updatesTooLong")))
+	a.Equal(1.0, testutil.ToFloat64(m.failures))
+	a.Equal(1, testutil.CollectAndCount(m.duration))
+	a.Equal(2, testutil.CollectAndCount(r, "bot_tg_updates_total"))
+}
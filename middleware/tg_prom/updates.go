@@ -0,0 +1,96 @@
+package tg_prom
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/internal/updates"
+)
+
+const labelUpdate = "tg_update"
+
+// UpdateHandler is prometheus metrics for telegram.UpdateHandler.
+//
+// Use Wrap to instrument update handler:
+//
+//	metrics, err := tg_prom.NewUpdateHandler(tg_prom.Options{
+//		Registerer: prometheus.DefaultRegisterer,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	client := telegram.NewClient(appID, appHash, telegram.Options{
+//		UpdateHandler: metrics.Wrap(handler),
+//	})
+type UpdateHandler struct {
+	updates  *prometheus.CounterVec
+	duration prometheus.Histogram
+	failures prometheus.Counter
+}
+
+// NewUpdateHandler initializes and returns new prometheus metrics for update
+// handler, registering them with Options.Registerer, if any.
+//
+// Options.DurationBuckets are used for handling duration histogram,
+// Options.SizeBuckets are not used.
+func NewUpdateHandler(opts Options) (*UpdateHandler, error) {
+	opts.setDefaults()
+	m := &UpdateHandler{
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_updates_total",
+			Help:        "Telegram updates total count.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{labelUpdate}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_updates_handler_duration_seconds",
+			Help:        "Telegram update batches handling duration histogram.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.DurationBuckets,
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "tg_updates_handler_failures_total",
+			Help:        "Telegram update batches handling failures total count.",
+			ConstLabels: opts.ConstLabels,
+		}),
+	}
+
+	if err := register(opts.Registerer, m.Metrics()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Wrap returns update handler recording metrics of given one.
+func (m *UpdateHandler) Wrap(next telegram.UpdateHandler) telegram.UpdateHandler {
+	return telegram.UpdateHandlerFunc(func(ctx context.Context, u tg.UpdatesClass) error {
+		for _, name := range updates.Names(u) {
+			m.updates.WithLabelValues(name).Inc()
+		}
+		start := time.Now()
+
+		err := next.Handle(ctx, u)
+
+		m.duration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.failures.Inc()
+		}
+		return err
+	})
+}
+
+// Metrics returns slice of provided prometheus metrics.
+func (m *UpdateHandler) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.updates,
+		m.duration,
+		m.failures,
+	}
+}
@@ -0,0 +1,60 @@
+package oteltg
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/gotd/contrib/middleware/circuitbreaker"
+)
+
+// CircuitBreaker is OpenTelemetry instrumentation for circuitbreaker.Breaker.
+//
+// Use Callback as circuitbreaker.Breaker callback to record state changes:
+//
+//	metrics, err := oteltg.NewCircuitBreaker(meterProvider, breaker)
+//	if err != nil {
+//		return err
+//	}
+//	breaker = breaker.WithCallback(metrics.Callback)
+type CircuitBreaker struct {
+	changes metric.Int64Counter
+}
+
+// NewCircuitBreaker initializes and returns new OpenTelemetry instrumentation for given breaker.
+func NewCircuitBreaker(meterProvider metric.MeterProvider, b *circuitbreaker.Breaker) (*CircuitBreaker, error) {
+	const name = "github.com/gotd/contrib/oteltg"
+	meter := meterProvider.Meter(name)
+	m := &CircuitBreaker{}
+
+	var err error
+	if m.changes, err = meter.Int64Counter("tg.circuitbreaker.state_changes"); err != nil {
+		return nil, err
+	}
+	state, err := meter.Int64ObservableGauge("tg.circuitbreaker.state",
+		metric.WithDescription("Circuit state: 1 is open, 2 is half-open. Closed circuits are not reported."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for key, s := range b.States() {
+			o.ObserveInt64(state, int64(s), metric.WithAttributes(attribute.String("tg.circuit", key)))
+		}
+		return nil
+	}, state); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Callback is a circuitbreaker.Breaker callback, see circuitbreaker.Breaker.WithCallback.
+func (m *CircuitBreaker) Callback(ctx context.Context, c circuitbreaker.StateChange) {
+	m.changes.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("tg.circuit", c.Key),
+		attribute.String("tg.circuit.from", c.From.String()),
+		attribute.String("tg.circuit.to", c.To.String()),
+	))
+}
@@ -0,0 +1,79 @@
+package oteltg
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/gotd/contrib/middleware/floodwait"
+)
+
+// FloodWait is OpenTelemetry instrumentation for floodwait.Waiter.
+//
+// Use Callback as floodwait.Waiter callback to count waits:
+//
+//	metrics, err := oteltg.NewFloodWait(meterProvider, waiter)
+//	if err != nil {
+//		return err
+//	}
+//	waiter = waiter.WithCallback(metrics.Callback)
+type FloodWait struct {
+	waits    metric.Int64Counter
+	waitTime metric.Float64Counter
+}
+
+// NewFloodWait initializes and returns new OpenTelemetry instrumentation for given waiter.
+func NewFloodWait(meterProvider metric.MeterProvider, w *floodwait.Waiter) (*FloodWait, error) {
+	const name = "github.com/gotd/contrib/oteltg"
+	meter := meterProvider.Meter(name)
+	m := &FloodWait{}
+
+	var err error
+	if m.waits, err = meter.Int64Counter("tg.floodwait.waits"); err != nil {
+		return nil, err
+	}
+	if m.waitTime, err = meter.Float64Counter("tg.floodwait.wait_time", metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	queued, err := meter.Int64ObservableGauge("tg.floodwait.queue_length")
+	if err != nil {
+		return nil, err
+	}
+	penalties, err := meter.Int64ObservableGauge("tg.floodwait.active_penalties")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stats := w.Stats()
+		o.ObserveInt64(queued, int64(stats.Queued))
+		o.ObserveInt64(penalties, int64(stats.Penalties))
+		return nil
+	}, queued, penalties); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Callback is a floodwait.Waiter callback, see floodwait.Waiter.WithCallback.
+//
+// Flood wait is also added as "tg.floodwait" event to span of request, if
+// request is traced by Middleware.
+func (m *FloodWait) Callback(ctx context.Context, wait floodwait.FloodWait) {
+	attrs := []attribute.KeyValue{
+		attribute.String("tg.method", wait.Method),
+		attribute.String("tg.rpc.err", wait.Type),
+	}
+	m.waits.Add(ctx, 1, metric.WithAttributes(attrs...))
+	if !wait.Scheduled.IsZero() {
+		// Request is not retried, so it does not wait.
+		m.waitTime.Add(ctx, wait.Duration.Seconds(), metric.WithAttributes(attrs...))
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("tg.floodwait", trace.WithAttributes(append(attrs,
+		attribute.Float64("tg.floodwait.duration", wait.Duration.Seconds()),
+		attribute.Int("tg.floodwait.attempt", wait.Attempt),
+	)...))
+}
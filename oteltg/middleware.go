@@ -3,7 +3,6 @@ package oteltg
 
 import (
 	"context"
-	"fmt"
 	"strconv"
 	"time"
 
@@ -16,14 +15,37 @@ import (
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
 	"github.com/gotd/td/tgerr"
+
+	"github.com/gotd/contrib/internal/target"
+	"github.com/gotd/contrib/internal/tracehook"
 )
 
-// Middleware is prometheus metrics middleware for Telegram.
+// Middleware is OpenTelemetry instrumentation middleware for Telegram.
+//
+// Every RPC call is traced as a client span named after method, like
+// "messages.sendMessage", with attributes of target peer of request, if any.
+// Time spent waiting in floodwait and ratelimit middlewares called after
+// Middleware is traced as "tg.floodwait" and "tg.ratelimit" child spans, so
+// Middleware should be added before them.
 type Middleware struct {
 	count    metric.Int64Counter
 	failures metric.Int64Counter
 	duration metric.Float64Histogram
 	tracer   trace.Tracer
+	dc       int
+}
+
+// WithDC returns copy of middleware adding ID of DC to spans, for use with
+// invokers of connections to a specific DC.
+func (m Middleware) WithDC(dc int) *Middleware {
+	m.dc = dc
+	return &m
+}
+
+// span records span reported by middleware called after Middleware.
+func (m Middleware) span(ctx context.Context, name string, start, end time.Time) {
+	_, span := m.tracer.Start(ctx, name, trace.WithTimestamp(start))
+	span.End(trace.WithTimestamp(end))
 }
 
 // Handle implements telegram.Middleware.
@@ -33,14 +55,16 @@ func (m Middleware) Handle(next tg.Invoker) telegram.InvokeFunc {
 		attrs := m.attributes(input)
 
 		spanName := "tg.rpc"
-		for _, attr := range attrs {
-			if attr.Key == "tg.method" {
-				spanName = fmt.Sprintf("%s: %s", spanName, attr.Value.AsString())
-			}
+		if obj, ok := input.(object); ok {
+			spanName = obj.TypeName()
 		}
 
-		ctx, span := m.tracer.Start(ctx, spanName, trace.WithAttributes(attrs...))
+		ctx, span := m.tracer.Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(m.spanAttributes(input)...),
+		)
 		defer span.End()
+		ctx = tracehook.With(ctx, m.span)
 		m.count.Add(ctx, 1, metric.WithAttributes(attrs...))
 		start := time.Now()
 
@@ -89,7 +113,31 @@ func (m Middleware) attributes(input bin.Encoder) []attribute.KeyValue {
 	}
 }
 
-// New initializes and returns new prometheus middleware.
+// spanAttributes returns span attributes of request, following semantic
+// conventions for RPC spans.
+func (m Middleware) spanAttributes(input bin.Encoder) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("rpc.system", "telegram"),
+	}
+	if obj, ok := input.(object); ok {
+		attrs = append(attrs,
+			attribute.String("rpc.method", obj.TypeName()),
+			attribute.String("tg.method", obj.TypeName()),
+		)
+	}
+	if m.dc != 0 {
+		attrs = append(attrs, attribute.Int("tg.dc", m.dc))
+	}
+	if p := target.FromRequest(input); p.Kind != target.None {
+		attrs = append(attrs, attribute.String("tg.peer.type", p.Kind.String()))
+		if p.ID != 0 {
+			attrs = append(attrs, attribute.Int64("tg.peer.id", p.ID))
+		}
+	}
+	return attrs
+}
+
+// New initializes and returns new OpenTelemetry middleware.
 func New(meterProvider metric.MeterProvider, tracerProvider trace.TracerProvider) (*Middleware, error) {
 	const name = "github.com/gotd/contrib/oteltg"
 	meter := meterProvider.Meter(name)
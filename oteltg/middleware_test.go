@@ -2,15 +2,28 @@ package oteltg
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
 	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/time/rate"
 
 	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
 	"github.com/gotd/td/tgerr"
+
+	"github.com/gotd/contrib/middleware/circuitbreaker"
+	"github.com/gotd/contrib/middleware/floodwait"
+	"github.com/gotd/contrib/middleware/ratelimit"
+	"github.com/gotd/contrib/middleware/retry"
 )
 
 type invoker func(ctx context.Context, input bin.Encoder, output bin.Decoder) error
@@ -36,3 +49,164 @@ func TestMiddleware_Handle(t *testing.T) {
 	require.NoError(t, m.Handle(okInvoker).Invoke(ctx, nil, nil))
 	require.True(t, tgerr.Is(m.Handle(errInvoker).Invoke(ctx, input, nil), tgerr.ErrFloodWait))
 }
+
+// recordingMeterProvider is a metric.MeterProvider recording sums of float64
+// counters.
+type recordingMeterProvider struct {
+	metricnoop.MeterProvider
+	meter *recordingMeter
+}
+
+func (p recordingMeterProvider) Meter(name string, opts ...metric.MeterOption) metric.Meter {
+	return p.meter
+}
+
+type recordingMeter struct {
+	metricnoop.Meter
+
+	mux  sync.Mutex
+	sums map[string]float64
+}
+
+func (m *recordingMeter) Float64Counter(name string, opts ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	return recordingCounter{name: name, meter: m}, nil
+}
+
+func (m *recordingMeter) sum(name string) float64 {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.sums[name]
+}
+
+type recordingCounter struct {
+	metricnoop.Float64Counter
+	name  string
+	meter *recordingMeter
+}
+
+func (c recordingCounter) Add(ctx context.Context, incr float64, opts ...metric.AddOption) {
+	c.meter.mux.Lock()
+	defer c.meter.mux.Unlock()
+	c.meter.sums[c.name] += incr
+}
+
+func TestFloodWait(t *testing.T) {
+	meter := &recordingMeter{sums: map[string]float64{}}
+	m, err := NewFloodWait(recordingMeterProvider{meter: meter}, floodwait.NewWaiter())
+	require.NoError(t, err)
+
+	wait := floodwait.FloodWait{
+		Duration:  time.Second,
+		Method:    "messages.sendMessage",
+		Type:      "FLOOD_WAIT",
+		Scheduled: time.Now().Add(time.Second),
+	}
+	m.Callback(context.Background(), wait)
+	// Not retried because of retry limits.
+	wait.Scheduled = time.Time{}
+	m.Callback(context.Background(), wait)
+	require.Equal(t, 1.0, meter.sum("tg.floodwait.wait_time"))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	m, err := NewCircuitBreaker(metricnoop.NewMeterProvider(), circuitbreaker.New())
+	require.NoError(t, err)
+
+	m.Callback(context.Background(), circuitbreaker.StateChange{
+		Key:  "upload.getFile",
+		From: circuitbreaker.Closed,
+		To:   circuitbreaker.Open,
+	})
+}
+
+func TestUpdateHandler(t *testing.T) {
+	a := require.New(t)
+	tracer := &recordingTracer{}
+	m, err := NewUpdateHandler(metricnoop.NewMeterProvider(), recordingProvider{tracer: tracer})
+	a.NoError(err)
+
+	failure := errors.New("failure")
+	var handled int
+	h := m.Wrap(telegram.UpdateHandlerFunc(func(ctx context.Context, u tg.UpdatesClass) error {
+		handled++
+		a.Equal("tg.updates", trace.SpanFromContext(ctx).(*recordedSpan).name)
+		return failure
+	}))
+
+	a.ErrorIs(h.Handle(context.Background(), &tg.Updates{
+		Updates: []tg.UpdateClass{
+			&tg.UpdateNewMessage{Message: &tg.MessageEmpty{}},
+			&tg.UpdateDeleteMessages{},
+		},
+	}), failure)
+	a.Equal(1, handled)
+
+	a.Len(tracer.spans, 1)
+	batch := tracer.spans[0]
+	a.Equal("tg.updates", batch.name)
+	a.Equal(int64(2), batch.attr("tg.updates.count").AsInt64())
+	a.Equal(codes.Error, batch.status)
+	a.Equal([]error{failure}, batch.errs)
+	a.Equal([]string{"tg.update", "tg.update"}, batch.events)
+	a.True(batch.ended)
+}
+
+func TestMiddlewareSpans(t *testing.T) {
+	a := require.New(t)
+	tracer := &recordingTracer{}
+	m, err := New(metricnoop.NewMeterProvider(), recordingProvider{tracer: tracer})
+	a.NoError(err)
+	fw, err := NewFloodWait(metricnoop.NewMeterProvider(), floodwait.NewWaiter())
+	a.NoError(err)
+	r, err := NewRetry(metricnoop.NewMeterProvider())
+	a.NoError(err)
+
+	internal := tgerr.New(500, "INTERNAL")
+	var calls int
+	next := invoker(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		calls++
+		if calls == 1 {
+			fw.Callback(ctx, floodwait.FloodWait{
+				Duration: time.Second,
+				Method:   "messages.sendMessage",
+				Type:     "FLOOD_WAIT",
+				Attempt:  1,
+			})
+			r.Callback(ctx, retry.Retry{
+				Method:  "messages.sendMessage",
+				Attempt: 1,
+				Delay:   time.Second,
+				Err:     internal,
+			})
+		}
+		return nil
+	})
+	// Second request waits for token.
+	h := m.WithDC(2).Handle(ratelimit.New(rate.Every(10*time.Millisecond), 1).Handle(next))
+
+	ctx := context.Background()
+	input := &tg.MessagesSendMessageRequest{
+		Peer:     &tg.InputPeerUser{UserID: 10},
+		RandomID: 1,
+	}
+	a.NoError(h.Invoke(ctx, input, nil))
+	a.NoError(h.Invoke(ctx, input, nil))
+
+	a.Len(tracer.spans, 3)
+	first, second, wait := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+	for _, s := range []*recordedSpan{first, second} {
+		a.Equal("messages.sendMessage", s.name)
+		a.Equal("telegram", s.attr("rpc.system").AsString())
+		a.Equal("messages.sendMessage", s.attr("rpc.method").AsString())
+		a.Equal(int64(2), s.attr("tg.dc").AsInt64())
+		a.Equal("user", s.attr("tg.peer.type").AsString())
+		a.Equal(int64(10), s.attr("tg.peer.id").AsInt64())
+		a.Equal(codes.Ok, s.status)
+	}
+	a.Equal([]string{"tg.floodwait", "tg.retry"}, first.events)
+	a.Empty(second.events)
+
+	a.Equal("tg.ratelimit", wait.name)
+	a.Equal(second, wait.parent)
+	a.True(wait.ended)
+}
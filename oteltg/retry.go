@@ -0,0 +1,60 @@
+package oteltg
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/gotd/td/tgerr"
+
+	"github.com/gotd/contrib/middleware/retry"
+)
+
+// Retry is OpenTelemetry instrumentation for retry.Retrier.
+//
+// Use Callback as retry.Retrier callback to count retries:
+//
+//	metrics, err := oteltg.NewRetry(meterProvider)
+//	if err != nil {
+//		return err
+//	}
+//	retrier = retrier.WithCallback(metrics.Callback)
+type Retry struct {
+	retries metric.Int64Counter
+}
+
+// NewRetry initializes and returns new OpenTelemetry instrumentation for retrier.
+func NewRetry(meterProvider metric.MeterProvider) (*Retry, error) {
+	const name = "github.com/gotd/contrib/oteltg"
+	meter := meterProvider.Meter(name)
+	m := &Retry{}
+
+	var err error
+	if m.retries, err = meter.Int64Counter("tg.retry.retries"); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Callback is a retry.Retrier callback, see retry.Retrier.WithCallback.
+//
+// Retry is also added as "tg.retry" event to span of request, if request is
+// traced by Middleware.
+func (m *Retry) Callback(ctx context.Context, r retry.Retry) {
+	errType := "CLIENT"
+	if rpcErr, ok := tgerr.As(r.Err); ok {
+		errType = rpcErr.Type
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("tg.method", r.Method),
+		attribute.String("tg.rpc.err", errType),
+	}
+	m.retries.Add(ctx, 1, metric.WithAttributes(attrs...))
+
+	trace.SpanFromContext(ctx).AddEvent("tg.retry", trace.WithAttributes(append(attrs,
+		attribute.Int("tg.retry.attempt", r.Attempt),
+		attribute.Float64("tg.retry.delay", r.Delay.Seconds()),
+	)...))
+}
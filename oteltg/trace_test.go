@@ -0,0 +1,87 @@
+package oteltg
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordedSpan is a span recorded by recordingTracer.
+type recordedSpan struct {
+	tracenoop.Span
+
+	name   string
+	parent *recordedSpan
+	attrs  []attribute.KeyValue
+	events []string
+	status codes.Code
+	errs   []error
+	ended  bool
+}
+
+func (s *recordedSpan) End(options ...trace.SpanEndOption) { s.ended = true }
+
+func (s *recordedSpan) IsRecording() bool { return true }
+
+func (s *recordedSpan) SetStatus(code codes.Code, description string) { s.status = code }
+
+func (s *recordedSpan) RecordError(err error, options ...trace.EventOption) {
+	s.errs = append(s.errs, err)
+}
+
+func (s *recordedSpan) AddEvent(name string, options ...trace.EventOption) {
+	s.events = append(s.events, name)
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.attrs = append(s.attrs, kv...)
+}
+
+// attr returns value of attribute with given key.
+func (s *recordedSpan) attr(key attribute.Key) attribute.Value {
+	for _, kv := range s.attrs {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// recordingProvider is a trace.TracerProvider of recordingTracer.
+type recordingProvider struct {
+	embedded.TracerProvider
+	tracer *recordingTracer
+}
+
+func (p recordingProvider) Tracer(name string, options ...trace.TracerOption) trace.Tracer {
+	return p.tracer
+}
+
+// recordingTracer is a trace.Tracer recording spans.
+type recordingTracer struct {
+	embedded.Tracer
+
+	mux   sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	s := &recordedSpan{
+		name:  name,
+		attrs: cfg.Attributes(),
+	}
+	if parent, ok := trace.SpanFromContext(ctx).(*recordedSpan); ok {
+		s.parent = parent
+	}
+
+	t.mux.Lock()
+	t.spans = append(t.spans, s)
+	t.mux.Unlock()
+	return trace.ContextWithSpan(ctx, s), s
+}
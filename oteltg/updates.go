@@ -0,0 +1,95 @@
+package oteltg
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/internal/updates"
+)
+
+// UpdateHandler is OpenTelemetry instrumentation for telegram.UpdateHandler.
+//
+// Every batch of updates is traced as a "tg.updates" span with "tg.update"
+// event per update. Updates of batch are handled together, so they are not
+// traced separately.
+//
+// Use Wrap to instrument update handler:
+//
+//	h, err := oteltg.NewUpdateHandler(meterProvider, tracerProvider)
+//	if err != nil {
+//		return err
+//	}
+//	client := telegram.NewClient(appID, appHash, telegram.Options{
+//		UpdateHandler: h.Wrap(handler),
+//	})
+type UpdateHandler struct {
+	updates  metric.Int64Counter
+	failures metric.Int64Counter
+	duration metric.Float64Histogram
+	tracer   trace.Tracer
+}
+
+// NewUpdateHandler initializes and returns new OpenTelemetry instrumentation for update handler.
+func NewUpdateHandler(meterProvider metric.MeterProvider, tracerProvider trace.TracerProvider) (*UpdateHandler, error) {
+	const name = "github.com/gotd/contrib/oteltg"
+	meter := meterProvider.Meter(name)
+	m := &UpdateHandler{
+		tracer: tracerProvider.Tracer(name),
+	}
+
+	var err error
+	if m.updates, err = meter.Int64Counter("tg.updates.count"); err != nil {
+		return nil, err
+	}
+	if m.failures, err = meter.Int64Counter("tg.updates.failures"); err != nil {
+		return nil, err
+	}
+	if m.duration, err = meter.Float64Histogram("tg.updates.duration", metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Wrap returns update handler instrumenting given one.
+func (m *UpdateHandler) Wrap(next telegram.UpdateHandler) telegram.UpdateHandler {
+	return telegram.UpdateHandlerFunc(func(ctx context.Context, u tg.UpdatesClass) error {
+		names := updates.Names(u)
+		var batch string
+		if u != nil {
+			batch = u.TypeName()
+		}
+
+		ctx, span := m.tracer.Start(ctx, "tg.updates", trace.WithAttributes(
+			attribute.String("tg.updates.type", batch),
+			attribute.Int("tg.updates.count", len(names)),
+		))
+		defer span.End()
+
+		for _, name := range names {
+			attrs := []attribute.KeyValue{attribute.String("tg.update", name)}
+			m.updates.Add(ctx, 1, metric.WithAttributes(attrs...))
+			span.AddEvent("tg.update", trace.WithAttributes(attrs...))
+		}
+		start := time.Now()
+
+		err := next.Handle(ctx, u)
+
+		m.duration.Record(ctx, time.Since(start).Seconds())
+		if err != nil {
+			span.SetStatus(codes.Error, "Handler error")
+			span.RecordError(err)
+			m.failures.Add(ctx, 1)
+		} else {
+			span.SetStatus(codes.Ok, "")
+		}
+		return err
+	})
+}
@@ -0,0 +1,59 @@
+package pebble
+
+import (
+	"context"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+var _ updates.ChannelAccessHasher = (*AccessHasher)(nil)
+
+var accessHashKeyPrefix = []byte("updates_access_hash") // nolint:gochecknoglobals
+
+// AccessHasher is updates.ChannelAccessHasher implementation using Pebble.
+type AccessHasher struct {
+	pebble    *pebble.DB
+	writeOpts *pebble.WriteOptions
+}
+
+// NewAccessHasher creates new channel access hash storage over Pebble.
+//
+// Caller is responsible for db.Close() invocation.
+func NewAccessHasher(db *pebble.DB) *AccessHasher {
+	return &AccessHasher{pebble: db}
+}
+
+// WithWriteOptions sets pebble's write options for write operations.
+func (h *AccessHasher) WithWriteOptions(writeOpts *pebble.WriteOptions) *AccessHasher {
+	h.writeOpts = writeOpts
+	return h
+}
+
+func accessHashKey(userID, channelID int64) []byte {
+	return append(userKey(accessHashKeyPrefix, userID), i2b(channelID)...)
+}
+
+// SetChannelAccessHash implements updates.ChannelAccessHasher.
+func (h *AccessHasher) SetChannelAccessHash(_ context.Context, userID, channelID, accessHash int64) error {
+	if err := h.pebble.Set(accessHashKey(userID, channelID), i2b(accessHash), h.writeOpts); err != nil {
+		return errors.Wrap(err, "set")
+	}
+	return nil
+}
+
+// GetChannelAccessHash implements updates.ChannelAccessHasher.
+func (h *AccessHasher) GetChannelAccessHash(_ context.Context, userID, channelID int64) (accessHash int64, found bool, err error) {
+	v, closer, err := h.pebble.Get(accessHashKey(userID, channelID))
+	if err != nil {
+		if errors.Is(err, pebble.ErrNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, errors.Wrap(err, "get")
+	}
+	accessHash = b2i(v)
+
+	return accessHash, true, closer.Close()
+}
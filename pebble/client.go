@@ -41,3 +41,24 @@ func (p pebbleStorage) Get(ctx context.Context, k string) (string, error) {
 
 	return v, closer.Close()
 }
+
+func (p pebbleStorage) Delete(ctx context.Context, k string) error {
+	return p.db.Delete([]byte(k), p.opts)
+}
+
+func (p pebbleStorage) Iterate(ctx context.Context, prefix string, f func(k, v string) error) (rerr error) {
+	iter, err := p.db.NewIter(prefixIterOptions([]byte(prefix)))
+	if err != nil {
+		return errors.Wrap(err, "new iter")
+	}
+	defer func() {
+		multierr.AppendInto(&rerr, iter.Close())
+	}()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		if err := f(string(iter.Key()), string(iter.Value())); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
@@ -1,13 +1,17 @@
 package pebble_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	pebbledb "github.com/cockroachdb/pebble"
 	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
 
-	"github.com/gotd/contrib/internal/tests"
+	"github.com/gotd/contrib/middleware/cache/cachetest"
 	"github.com/gotd/contrib/pebble"
+	"github.com/gotd/contrib/storage/storagetest"
 )
 
 func TestE2E(t *testing.T) {
@@ -18,7 +22,37 @@ func TestE2E(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	tests.TestSessionStorage(t, pebble.NewSessionStorage(db, "testsession"))
-	tests.TestCredentials(t, pebble.NewCredentials(db))
-	tests.TestPeerStorage(t, pebble.NewPeerStorage(db))
+	storagetest.TestSessionStorage(t, pebble.NewSessionStorage(db, "testsession"))
+	storagetest.TestCredentials(t, pebble.NewCredentials(db))
+	storagetest.TestPeerStorage(t, pebble.NewPeerStorage(db))
+	storagetest.TestStateStorage(t, pebble.NewStateStorage(db))
+	storagetest.TestAccessHasher(t, pebble.NewAccessHasher(db))
+	cachetest.TestStore(t, pebble.NewResponseCache(db))
+}
+
+func TestResponseCacheSweep(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	db, err := pebbledb.Open("pebble.db", &pebbledb.Options{
+		FS: vfs.NewMem(),
+	})
+	a.NoError(err)
+	defer func() { a.NoError(db.Close()) }()
+
+	c := pebble.NewResponseCache(db)
+	a.NoError(c.Set(ctx, "expired", []byte{1}, time.Nanosecond))
+	a.NoError(c.Set(ctx, "fresh", []byte{2}, time.Hour))
+	time.Sleep(time.Millisecond)
+
+	a.NoError(c.Sweep(ctx))
+	_, closer, err := db.Get([]byte("cache_expired"))
+	if err == nil {
+		_ = closer.Close()
+	}
+	a.ErrorIs(err, pebbledb.ErrNotFound)
+
+	data, found, err := c.Get(ctx, "fresh")
+	a.NoError(err)
+	a.True(found)
+	a.Equal([]byte{2}, data)
 }
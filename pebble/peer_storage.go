@@ -47,19 +47,28 @@ func (p *pebbleIterator) Next(ctx context.Context) bool {
 		return false
 	}
 
-	for !bytes.HasPrefix(p.iter.Key(), storage.PeerKeyPrefix) {
-		if !p.iter.Next() {
+	for {
+		for !bytes.HasPrefix(p.iter.Key(), storage.PeerKeyPrefix) {
+			if !p.iter.Next() {
+				return false
+			}
+		}
+
+		err := json.Unmarshal(p.iter.Value(), &p.value)
+		p.iter.Next()
+		if err != nil {
+			if errors.Is(err, storage.ErrPeerUnmarshalMustInvalidate) {
+				if !p.iter.Valid() {
+					return false
+				}
+				continue // skip
+			}
+			p.lastErr = errors.Wrap(err, "unmarshal")
 			return false
 		}
-	}
 
-	if err := json.Unmarshal(p.iter.Value(), &p.value); err != nil {
-		p.lastErr = errors.Wrap(err, "unmarshal")
-		return false
+		return true
 	}
-
-	p.iter.Next()
-	return true
 }
 
 func (p *pebbleIterator) Err() error {
@@ -0,0 +1,52 @@
+package pebble_test
+
+import (
+	"context"
+	"testing"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/pebble"
+	"github.com/gotd/contrib/storage"
+)
+
+func TestPeerStorageOutdated(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	db, err := pebbledb.Open("pebble.db", &pebbledb.Options{
+		FS: vfs.NewMem(),
+	})
+	a.NoError(err)
+	st := pebble.NewPeerStorage(db)
+
+	var outdated, valid storage.Peer
+	a.True(outdated.FromUser(&tg.User{ID: 10, AccessHash: 10}))
+	outdated.Version = storage.LatestVersion - 1
+	a.True(valid.FromUser(&tg.User{ID: 11, AccessHash: 11}))
+	// Outdated peers are placed before and after valid one.
+	a.NoError(st.Add(ctx, outdated))
+	a.NoError(st.Add(ctx, valid))
+	outdated.Key.ID = 12
+	a.NoError(st.Add(ctx, outdated))
+
+	_, err = st.Find(ctx, storage.KeyFromPeer(outdated))
+	a.ErrorIs(err, storage.ErrPeerNotFound)
+
+	iter, err := st.Iterate(ctx)
+	a.NoError(err)
+	defer func() {
+		a.NoError(iter.Close())
+	}()
+
+	var got []storage.PeerKey
+	a.NoError(storage.ForEach(ctx, iter, func(p storage.Peer) error {
+		got = append(got, storage.KeyFromPeer(p))
+		return nil
+	}))
+	a.Equal([]storage.PeerKey{storage.KeyFromPeer(valid)}, got)
+}
@@ -0,0 +1,24 @@
+package pebble
+
+import (
+	"github.com/cockroachdb/pebble"
+
+	"github.com/gotd/contrib/auth/kv"
+)
+
+// ResponseCache stores cached responses to Pebble.
+//
+// Expired responses are deleted on access, use Sweep to delete the rest
+// periodically.
+type ResponseCache struct {
+	kv.ResponseCache
+}
+
+// NewResponseCache creates new ResponseCache.
+func NewResponseCache(db *pebble.DB) ResponseCache {
+	// Cache can be lost, so writes are not synced.
+	s := pebbleStorage{db: db, opts: pebble.NoSync}
+	return ResponseCache{
+		ResponseCache: kv.NewResponseCache(s),
+	}
+}
@@ -0,0 +1,270 @@
+package pebble
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+var _ updates.StateStorage = (*State)(nil)
+
+var (
+	stateKeyPrefix    = []byte("updates_state")    // nolint:gochecknoglobals
+	channelsKeyPrefix = []byte("updates_channels") // nolint:gochecknoglobals
+)
+
+const (
+	fieldPts byte = iota
+	fieldQts
+	fieldDate
+	fieldSeq
+)
+
+// State is updates.StateStorage implementation using Pebble.
+//
+// Every state field is stored as a separate key, so updates of a single field
+// are written without reading the whole state.
+type State struct {
+	pebble    *pebble.DB
+	writeOpts *pebble.WriteOptions
+
+	// locks serialize state writes of the same user, so fields are not
+	// updated between existence check and write.
+	locksMux sync.Mutex
+	locks    map[int64]*userLock
+}
+
+// userLock is a reference-counted lock of user state.
+type userLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewStateStorage creates new state storage over Pebble.
+//
+// Caller is responsible for db.Close() invocation.
+func NewStateStorage(db *pebble.DB) *State {
+	return &State{pebble: db, locks: map[int64]*userLock{}}
+}
+
+// WithWriteOptions sets pebble's write options for write operations.
+func (s *State) WithWriteOptions(writeOpts *pebble.WriteOptions) *State {
+	s.writeOpts = writeOpts
+	return s
+}
+
+func i2b(v int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+func b2i(b []byte) int64 { return int64(binary.BigEndian.Uint64(b)) }
+
+func userKey(prefix []byte, userID int64) []byte {
+	r := make([]byte, 0, len(prefix)+8+8)
+	r = append(r, prefix...)
+	return binary.BigEndian.AppendUint64(r, uint64(userID))
+}
+
+func stateKey(userID int64, field byte) []byte {
+	return append(userKey(stateKeyPrefix, userID), field)
+}
+
+func channelKey(userID, channelID int64) []byte {
+	return binary.BigEndian.AppendUint64(userKey(channelsKeyPrefix, userID), uint64(channelID))
+}
+
+// GetState implements updates.StateStorage.
+func (s *State) GetState(_ context.Context, userID int64) (_ updates.State, _ bool, rerr error) {
+	snap := s.pebble.NewSnapshot()
+	defer func() {
+		multierr.AppendInto(&rerr, snap.Close())
+	}()
+
+	var fields [4]int
+	for i, field := range []byte{fieldPts, fieldQts, fieldDate, fieldSeq} {
+		v, closer, err := snap.Get(stateKey(userID, field))
+		if err != nil {
+			if errors.Is(err, pebble.ErrNotFound) {
+				return updates.State{}, false, nil
+			}
+			return updates.State{}, false, errors.Wrap(err, "get")
+		}
+		fields[i] = int(b2i(v))
+		if err := closer.Close(); err != nil {
+			return updates.State{}, false, errors.Wrap(err, "close")
+		}
+	}
+
+	return updates.State{
+		Pts:  fields[0],
+		Qts:  fields[1],
+		Date: fields[2],
+		Seq:  fields[3],
+	}, true, nil
+}
+
+// lock locks state of given user, returning unlock function.
+func (s *State) lock(userID int64) func() {
+	s.locksMux.Lock()
+	l, ok := s.locks[userID]
+	if !ok {
+		l = &userLock{}
+		s.locks[userID] = l
+	}
+	l.refs++
+	s.locksMux.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		s.locksMux.Lock()
+		defer s.locksMux.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, userID)
+		}
+	}
+}
+
+// SetState implements updates.StateStorage.
+func (s *State) SetState(_ context.Context, userID int64, state updates.State) error {
+	defer s.lock(userID)()
+
+	return s.write(userID,
+		stateField{fieldPts, state.Pts},
+		stateField{fieldQts, state.Qts},
+		stateField{fieldDate, state.Date},
+		stateField{fieldSeq, state.Seq},
+	)
+}
+
+type stateField struct {
+	field byte
+	value int
+}
+
+// write writes given state fields in a single batch.
+func (s *State) write(userID int64, fields ...stateField) (rerr error) {
+	b := s.pebble.NewBatch()
+	defer func() {
+		multierr.AppendInto(&rerr, b.Close())
+	}()
+
+	for _, f := range fields {
+		if err := b.Set(stateKey(userID, f.field), i2b(int64(f.value)), nil); err != nil {
+			return errors.Wrap(err, "set")
+		}
+	}
+
+	if err := b.Commit(s.writeOpts); err != nil {
+		return errors.Wrap(err, "commit")
+	}
+	return nil
+}
+
+// set updates given fields of existing state.
+func (s *State) set(userID int64, fields ...stateField) error {
+	defer s.lock(userID)()
+
+	// Use pts key as existence marker, SetState always writes all fields.
+	_, closer, err := s.pebble.Get(stateKey(userID, fieldPts))
+	if err != nil {
+		if errors.Is(err, pebble.ErrNotFound) {
+			return errors.New("state not found")
+		}
+		return errors.Wrap(err, "get")
+	}
+	if err := closer.Close(); err != nil {
+		return errors.Wrap(err, "close")
+	}
+
+	return s.write(userID, fields...)
+}
+
+// SetPts implements updates.StateStorage.
+func (s *State) SetPts(_ context.Context, userID int64, pts int) error {
+	return s.set(userID, stateField{fieldPts, pts})
+}
+
+// SetQts implements updates.StateStorage.
+func (s *State) SetQts(_ context.Context, userID int64, qts int) error {
+	return s.set(userID, stateField{fieldQts, qts})
+}
+
+// SetDate implements updates.StateStorage.
+func (s *State) SetDate(_ context.Context, userID int64, date int) error {
+	return s.set(userID, stateField{fieldDate, date})
+}
+
+// SetSeq implements updates.StateStorage.
+func (s *State) SetSeq(_ context.Context, userID int64, seq int) error {
+	return s.set(userID, stateField{fieldSeq, seq})
+}
+
+// SetDateSeq implements updates.StateStorage.
+func (s *State) SetDateSeq(_ context.Context, userID int64, date, seq int) error {
+	return s.set(userID, stateField{fieldDate, date}, stateField{fieldSeq, seq})
+}
+
+// GetChannelPts implements updates.StateStorage.
+func (s *State) GetChannelPts(_ context.Context, userID, channelID int64) (pts int, found bool, err error) {
+	v, closer, err := s.pebble.Get(channelKey(userID, channelID))
+	if err != nil {
+		if errors.Is(err, pebble.ErrNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, errors.Wrap(err, "get")
+	}
+	pts = int(b2i(v))
+
+	return pts, true, closer.Close()
+}
+
+// SetChannelPts implements updates.StateStorage.
+func (s *State) SetChannelPts(_ context.Context, userID, channelID int64, pts int) error {
+	if err := s.pebble.Set(channelKey(userID, channelID), i2b(int64(pts)), s.writeOpts); err != nil {
+		return errors.Wrap(err, "set")
+	}
+	return nil
+}
+
+// ForEachChannels implements updates.StateStorage.
+func (s *State) ForEachChannels(
+	ctx context.Context,
+	userID int64,
+	f func(ctx context.Context, channelID int64, pts int) error,
+) (rerr error) {
+	prefix := userKey(channelsKeyPrefix, userID)
+
+	snap := s.pebble.NewSnapshot()
+	defer func() {
+		multierr.AppendInto(&rerr, snap.Close())
+	}()
+
+	iter, err := snap.NewIter(prefixIterOptions(prefix))
+	if err != nil {
+		return errors.Wrap(err, "new iter")
+	}
+	defer func() {
+		multierr.AppendInto(&rerr, iter.Close())
+	}()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		channelID := b2i(iter.Key()[len(prefix):])
+		pts := int(b2i(iter.Value()))
+		if err := f(ctx, channelID, pts); err != nil {
+			return err
+		}
+	}
+
+	return iter.Error()
+}
@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-faster/errors"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+var _ updates.ChannelAccessHasher = (*AccessHasher)(nil)
+
+// AccessHasher is updates.ChannelAccessHasher implementation using Redis.
+//
+// Access hashes of every user are stored as a hash keyed by channel ID.
+type AccessHasher struct {
+	redis  *redis.Client
+	prefix string
+}
+
+// NewAccessHasher creates new channel access hash storage over Redis.
+func NewAccessHasher(client *redis.Client) *AccessHasher {
+	return &AccessHasher{redis: client, prefix: "access_hash"}
+}
+
+// WithPrefix sets key prefix to use. Default is "access_hash".
+func (h *AccessHasher) WithPrefix(prefix string) *AccessHasher {
+	h.prefix = prefix
+	return h
+}
+
+func (h *AccessHasher) key(userID int64) string {
+	return h.prefix + ":" + strconv.FormatInt(userID, 10)
+}
+
+// SetChannelAccessHash implements updates.ChannelAccessHasher.
+func (h *AccessHasher) SetChannelAccessHash(ctx context.Context, userID, channelID, accessHash int64) error {
+	key := h.key(userID)
+	if err := h.redis.HSet(ctx, key, strconv.FormatInt(channelID, 10), accessHash).Err(); err != nil {
+		return errors.Wrapf(err, "set %q", key)
+	}
+	return nil
+}
+
+// GetChannelAccessHash implements updates.ChannelAccessHasher.
+func (h *AccessHasher) GetChannelAccessHash(ctx context.Context, userID, channelID int64) (accessHash int64, found bool, err error) {
+	key := h.key(userID)
+	accessHash, err = h.redis.HGet(ctx, key, strconv.FormatInt(channelID, 10)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, false, nil
+		}
+		return 0, false, errors.Wrapf(err, "get %q", key)
+	}
+	return accessHash, true, nil
+}
@@ -8,7 +8,11 @@ import (
 	redisclient "github.com/go-redis/redis/v8"
 
 	"github.com/gotd/contrib/internal/tests"
+	"github.com/gotd/contrib/middleware/cache/cachetest"
+	"github.com/gotd/contrib/middleware/floodwait/floodwaittest"
+	"github.com/gotd/contrib/middleware/ratelimit/ratelimittest"
 	"github.com/gotd/contrib/redis"
+	"github.com/gotd/contrib/storage/storagetest"
 )
 
 func TestE2E(t *testing.T) {
@@ -24,7 +28,13 @@ func TestE2E(t *testing.T) {
 		return client.Ping(ctx).Err()
 	})
 
-	tests.TestSessionStorage(t, redis.NewSessionStorage(client, "session"))
-	tests.TestCredentials(t, redis.NewCredentials(client))
-	tests.TestPeerStorage(t, redis.NewPeerStorage(client))
+	storagetest.TestSessionStorage(t, redis.NewSessionStorage(client, "session"))
+	storagetest.TestCredentials(t, redis.NewCredentials(client))
+	storagetest.TestPeerStorage(t, redis.NewPeerStorage(client))
+	storagetest.TestStateStorage(t, redis.NewStateStorage(client))
+	storagetest.TestAccessHasher(t, redis.NewAccessHasher(client))
+	floodwaittest.TestPenaltyStore(t, redis.NewFloodPenalties(client))
+	floodwaittest.TestPenaltyStore(t, redis.NewFloodState(client))
+	ratelimittest.TestStore(t, redis.NewRateLimit(client))
+	cachetest.TestStore(t, redis.NewResponseCache(client))
 }
@@ -0,0 +1,20 @@
+package redis
+
+import (
+	"github.com/go-redis/redis/v8"
+
+	"github.com/gotd/contrib/auth/kv"
+)
+
+// FloodPenalties stores floodwait penalties to Redis.
+type FloodPenalties struct {
+	kv.FloodPenalties
+}
+
+// NewFloodPenalties creates new FloodPenalties.
+func NewFloodPenalties(client *redis.Client) FloodPenalties {
+	s := redisClient{
+		client: client,
+	}
+	return FloodPenalties{kv.NewFloodPenalties(s)}
+}
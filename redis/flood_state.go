@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/gotd/contrib/middleware/floodwait"
+)
+
+var _ floodwait.SharedPenaltyStore = (*FloodState)(nil)
+
+// extendPenalty atomically sets penalty deadline if it is later than existing one.
+//
+// Key expires at deadline.
+var extendPenalty = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]))
+if current and current >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1])
+redis.call("PEXPIREAT", KEYS[1], ARGV[1])
+return 1
+`) // nolint:gochecknoglobals
+
+// FloodState is floodwait.SharedPenaltyStore implementation using Redis.
+//
+// It allows multiple processes using the same account to share flood wait
+// penalties. Every penalty is stored as a separate <prefix>:<key> key with
+// deadline in Unix milliseconds, expiring at that deadline.
+type FloodState struct {
+	redis  *redis.Client
+	prefix string
+}
+
+// NewFloodState creates new shared flood wait state over Redis.
+func NewFloodState(client *redis.Client) *FloodState {
+	return &FloodState{redis: client, prefix: "floodwait"}
+}
+
+// WithPrefix sets key prefix to use. Default is "floodwait".
+func (s *FloodState) WithPrefix(prefix string) *FloodState {
+	s.prefix = prefix
+	return s
+}
+
+func (s *FloodState) key(k string) string {
+	return s.prefix + ":" + k
+}
+
+// SavePenalty implements floodwait.PenaltyStore.
+func (s *FloodState) SavePenalty(ctx context.Context, key string, deadline time.Time) error {
+	k := s.key(key)
+	if err := extendPenalty.Run(ctx, s.redis, []string{k}, deadline.UnixMilli()).Err(); err != nil {
+		return errors.Wrapf(err, "set %q", k)
+	}
+	return nil
+}
+
+// Penalty implements floodwait.SharedPenaltyStore.
+func (s *FloodState) Penalty(ctx context.Context, key string) (deadline time.Time, found bool, err error) {
+	k := s.key(key)
+	v, err := s.redis.Get(ctx, k).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, errors.Wrapf(err, "get %q", k)
+	}
+	return time.UnixMilli(v), true, nil
+}
+
+// LoadPenalties implements floodwait.PenaltyStore.
+func (s *FloodState) LoadPenalties(ctx context.Context, now time.Time) (map[string]time.Time, error) {
+	prefix := s.prefix + ":"
+	r := map[string]time.Time{}
+
+	iter := s.redis.Scan(ctx, 0, prefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		k := iter.Val()
+		v, err := s.redis.Get(ctx, k).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				// Expired.
+				continue
+			}
+			return nil, errors.Wrapf(err, "get %q", k)
+		}
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %q", k)
+		}
+		if deadline := time.UnixMilli(ms); deadline.After(now) {
+			r[strings.TrimPrefix(k, prefix)] = deadline
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, errors.Wrap(err, "scan")
+	}
+
+	return r, nil
+}
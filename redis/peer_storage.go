@@ -36,24 +36,29 @@ func (p *redisIterator) Close() error {
 }
 
 func (p *redisIterator) Next(ctx context.Context) bool {
-	if !p.iter.Next(ctx) {
-		return false
-	}
+	for p.iter.Next(ctx) {
+		key := p.iter.Val()
+		value, err := p.client.Get(ctx, key).Bytes()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue // deleted after scan
+			}
+			p.lastErr = errors.Wrapf(err, "get %q", key)
+			return false
+		}
 
-	key := p.iter.Val()
-	value, err := p.client.Get(ctx, key).Result()
-	if err != nil {
-		p.lastErr = errors.Wrapf(err, "get %q", key)
-		return false
-	}
+		if err := json.Unmarshal(value, &p.value); err != nil {
+			if errors.Is(err, storage.ErrPeerUnmarshalMustInvalidate) {
+				continue // skip
+			}
+			p.lastErr = errors.Wrap(err, "unmarshal")
+			return false
+		}
 
-	r := strings.NewReader(value)
-	if err := json.NewDecoder(r).Decode(&p.value); err != nil {
-		p.lastErr = errors.Wrap(err, "unmarshal")
-		return false
+		return true
 	}
 
-	return true
+	return false
 }
 
 func (p *redisIterator) Err() error {
@@ -134,6 +139,9 @@ func (s PeerStorage) Find(ctx context.Context, key storage.PeerKey) (storage.Pee
 
 	var b storage.Peer
 	if err := json.Unmarshal(data, &b); err != nil {
+		if errors.Is(err, storage.ErrPeerUnmarshalMustInvalidate) {
+			return storage.Peer{}, storage.ErrPeerNotFound
+		}
 		return storage.Peer{}, errors.Wrap(err, "unmarshal")
 	}
 
@@ -167,6 +175,9 @@ func (s PeerStorage) Resolve(ctx context.Context, key string) (storage.Peer, err
 
 	var b storage.Peer
 	if err := json.Unmarshal(data, &b); err != nil {
+		if errors.Is(err, storage.ErrPeerUnmarshalMustInvalidate) {
+			return storage.Peer{}, storage.ErrPeerNotFound
+		}
 		return storage.Peer{}, errors.Wrap(err, "unmarshal")
 	}
 
@@ -0,0 +1,58 @@
+package redis_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	redisclient "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/internal/tests"
+	"github.com/gotd/contrib/redis"
+	"github.com/gotd/contrib/storage"
+)
+
+func TestPeerStorageOutdated(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("Set REDIS_ADDR to run E2E test")
+	}
+
+	client := redisclient.NewClient(&redisclient.Options{
+		Addr: addr,
+	})
+	tests.RetryUntilAvailable(t, "Redis", addr, func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	})
+
+	a := require.New(t)
+	ctx := context.Background()
+	st := redis.NewPeerStorage(client)
+
+	var outdated, valid storage.Peer
+	a.True(outdated.FromUser(&tg.User{ID: 20, AccessHash: 20}))
+	outdated.Version = storage.LatestVersion - 1
+	a.True(valid.FromUser(&tg.User{ID: 21, AccessHash: 21}))
+	a.NoError(st.Add(ctx, outdated))
+	a.NoError(st.Add(ctx, valid))
+
+	_, err := st.Find(ctx, storage.KeyFromPeer(outdated))
+	a.ErrorIs(err, storage.ErrPeerNotFound)
+
+	iter, err := st.Iterate(ctx)
+	a.NoError(err)
+	defer func() {
+		a.NoError(iter.Close())
+	}()
+
+	got := map[storage.PeerKey]struct{}{}
+	a.NoError(storage.ForEach(ctx, iter, func(p storage.Peer) error {
+		got[storage.KeyFromPeer(p)] = struct{}{}
+		return nil
+	}))
+	a.Contains(got, storage.KeyFromPeer(valid))
+	a.NotContains(got, storage.KeyFromPeer(outdated))
+}
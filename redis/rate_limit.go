@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/time/rate"
+
+	"github.com/gotd/contrib/middleware/ratelimit"
+)
+
+var _ ratelimit.Store = (*RateLimit)(nil)
+
+// reserveToken atomically reserves a token of bucket using GCRA.
+//
+// Key holds theoretical arrival time of the next request in Unix
+// microseconds and expires when bucket is full again.
+//
+// Returns delay in microseconds.
+var reserveToken = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local tolerance = interval * (tonumber(ARGV[3]) - 1)
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+local delay = tat - tolerance - now
+if delay < 0 then
+	delay = 0
+end
+tat = tat + interval
+redis.call("SET", KEYS[1], string.format("%.0f", tat), "PX", math.max(1, math.ceil((tat - now) / 1000)))
+return delay
+`) // nolint:gochecknoglobals
+
+// RateLimit is ratelimit.Store implementation using Redis.
+//
+// It allows multiple processes using the same account to share rate limits.
+// Every bucket is stored as a separate <prefix>:<key> key.
+//
+// Buckets use the time of processes, so their clocks should be synchronized.
+type RateLimit struct {
+	redis  *redis.Client
+	prefix string
+}
+
+// NewRateLimit creates new shared rate limit state over Redis.
+func NewRateLimit(client *redis.Client) *RateLimit {
+	return &RateLimit{redis: client, prefix: "ratelimit"}
+}
+
+// WithPrefix sets key prefix to use. Default is "ratelimit".
+func (s *RateLimit) WithPrefix(prefix string) *RateLimit {
+	s.prefix = prefix
+	return s
+}
+
+// Reserve implements ratelimit.Store.
+func (s *RateLimit) Reserve(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	limit rate.Limit,
+	burst int,
+) (time.Duration, error) {
+	if limit == rate.Inf {
+		return 0, nil
+	}
+	if limit <= 0 {
+		return 0, errors.Errorf("invalid limit %v", limit)
+	}
+
+	k := s.prefix + ":" + key
+	interval := time.Duration(float64(time.Second) / float64(limit))
+	delay, err := reserveToken.Run(ctx, s.redis, []string{k},
+		now.UnixMicro(),
+		interval.Microseconds(),
+		burst,
+	).Int64()
+	if err != nil {
+		return 0, errors.Wrapf(err, "reserve %q", k)
+	}
+	return time.Duration(delay) * time.Microsecond, nil
+}
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/gotd/contrib/middleware/cache"
+)
+
+var _ cache.Store = (*ResponseCache)(nil)
+
+// ResponseCache is cache.Store implementation using Redis.
+//
+// Every response is stored as a separate <prefix>:<key> key, expiring
+// with response.
+type ResponseCache struct {
+	redis  *redis.Client
+	prefix string
+}
+
+// NewResponseCache creates new response cache over Redis.
+func NewResponseCache(client *redis.Client) *ResponseCache {
+	return &ResponseCache{redis: client, prefix: "cache"}
+}
+
+// WithPrefix sets key prefix to use. Default is "cache".
+func (s *ResponseCache) WithPrefix(prefix string) *ResponseCache {
+	s.prefix = prefix
+	return s
+}
+
+// Get implements cache.Store.
+func (s *ResponseCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	k := s.prefix + ":" + key
+	data, err := s.redis.Get(ctx, k).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		}
+		return nil, false, errors.Wrapf(err, "get %q", k)
+	}
+	return data, true, nil
+}
+
+// Set implements cache.Store.
+func (s *ResponseCache) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	k := s.prefix + ":" + key
+	if err := s.redis.Set(ctx, k, data, ttl).Err(); err != nil {
+		return errors.Wrapf(err, "set %q", k)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-faster/errors"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+var _ updates.StateStorage = (*State)(nil)
+
+const (
+	fieldPts  = "pts"
+	fieldQts  = "qts"
+	fieldDate = "date"
+	fieldSeq  = "seq"
+)
+
+// setStateFields atomically sets given fields of existing state hash.
+//
+// Returns 0 if state hash does not exist.
+var setStateFields = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], unpack(ARGV))
+return 1
+`) // nolint:gochecknoglobals
+
+// State is updates.StateStorage implementation using Redis.
+//
+// User state is stored as a hash with pts, qts, date and seq fields,
+// channel pts are stored as a separate hash keyed by channel ID.
+type State struct {
+	redis  *redis.Client
+	prefix string
+}
+
+// NewStateStorage creates new state storage over Redis.
+func NewStateStorage(client *redis.Client) *State {
+	return &State{redis: client, prefix: "state"}
+}
+
+// WithPrefix sets key prefix to use. Default is "state".
+func (s *State) WithPrefix(prefix string) *State {
+	s.prefix = prefix
+	return s
+}
+
+func (s *State) stateKey(userID int64) string {
+	return s.prefix + ":" + strconv.FormatInt(userID, 10)
+}
+
+func (s *State) channelsKey(userID int64) string {
+	return s.prefix + ":" + strconv.FormatInt(userID, 10) + ":channels"
+}
+
+// GetState implements updates.StateStorage.
+func (s *State) GetState(ctx context.Context, userID int64) (state updates.State, found bool, err error) {
+	key := s.stateKey(userID)
+	values, err := s.redis.HMGet(ctx, key, fieldPts, fieldQts, fieldDate, fieldSeq).Result()
+	if err != nil {
+		return updates.State{}, false, errors.Wrapf(err, "get %q", key)
+	}
+
+	var fields [4]int
+	for i, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			return updates.State{}, false, nil
+		}
+		n, err := strconv.Atoi(str)
+		if err != nil {
+			return updates.State{}, false, errors.Wrapf(err, "parse %q", key)
+		}
+		fields[i] = n
+	}
+
+	return updates.State{
+		Pts:  fields[0],
+		Qts:  fields[1],
+		Date: fields[2],
+		Seq:  fields[3],
+	}, true, nil
+}
+
+// SetState implements updates.StateStorage.
+func (s *State) SetState(ctx context.Context, userID int64, state updates.State) error {
+	key := s.stateKey(userID)
+	if err := s.redis.HSet(ctx, key,
+		fieldPts, state.Pts,
+		fieldQts, state.Qts,
+		fieldDate, state.Date,
+		fieldSeq, state.Seq,
+	).Err(); err != nil {
+		return errors.Wrapf(err, "set %q", key)
+	}
+	return nil
+}
+
+func (s *State) set(ctx context.Context, userID int64, fields ...interface{}) error {
+	key := s.stateKey(userID)
+	r, err := setStateFields.Run(ctx, s.redis, []string{key}, fields...).Int()
+	if err != nil {
+		return errors.Wrapf(err, "set %q", key)
+	}
+	if r == 0 {
+		return errors.New("state not found")
+	}
+	return nil
+}
+
+// SetPts implements updates.StateStorage.
+func (s *State) SetPts(ctx context.Context, userID int64, pts int) error {
+	return s.set(ctx, userID, fieldPts, pts)
+}
+
+// SetQts implements updates.StateStorage.
+func (s *State) SetQts(ctx context.Context, userID int64, qts int) error {
+	return s.set(ctx, userID, fieldQts, qts)
+}
+
+// SetDate implements updates.StateStorage.
+func (s *State) SetDate(ctx context.Context, userID int64, date int) error {
+	return s.set(ctx, userID, fieldDate, date)
+}
+
+// SetSeq implements updates.StateStorage.
+func (s *State) SetSeq(ctx context.Context, userID int64, seq int) error {
+	return s.set(ctx, userID, fieldSeq, seq)
+}
+
+// SetDateSeq implements updates.StateStorage.
+func (s *State) SetDateSeq(ctx context.Context, userID int64, date, seq int) error {
+	return s.set(ctx, userID, fieldDate, date, fieldSeq, seq)
+}
+
+// GetChannelPts implements updates.StateStorage.
+func (s *State) GetChannelPts(ctx context.Context, userID, channelID int64) (pts int, found bool, err error) {
+	key := s.channelsKey(userID)
+	pts, err = s.redis.HGet(ctx, key, strconv.FormatInt(channelID, 10)).Int()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, false, nil
+		}
+		return 0, false, errors.Wrapf(err, "get %q", key)
+	}
+	return pts, true, nil
+}
+
+// SetChannelPts implements updates.StateStorage.
+func (s *State) SetChannelPts(ctx context.Context, userID, channelID int64, pts int) error {
+	key := s.channelsKey(userID)
+	if err := s.redis.HSet(ctx, key, strconv.FormatInt(channelID, 10), pts).Err(); err != nil {
+		return errors.Wrapf(err, "set %q", key)
+	}
+	return nil
+}
+
+// ForEachChannels implements updates.StateStorage.
+func (s *State) ForEachChannels(
+	ctx context.Context,
+	userID int64,
+	f func(ctx context.Context, channelID int64, pts int) error,
+) error {
+	key := s.channelsKey(userID)
+	channels, err := s.redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return errors.Wrapf(err, "get %q", key)
+	}
+
+	for k, v := range channels {
+		channelID, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "parse channel id %q", k)
+		}
+		pts, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrapf(err, "parse pts of %d", channelID)
+		}
+		if err := f(ctx, channelID, pts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
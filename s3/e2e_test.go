@@ -10,6 +10,7 @@ import (
 
 	"github.com/gotd/contrib/internal/tests"
 	"github.com/gotd/contrib/s3"
+	"github.com/gotd/contrib/storage/storagetest"
 )
 
 func TestE2E(t *testing.T) {
@@ -33,5 +34,5 @@ func TestE2E(t *testing.T) {
 		return err
 	})
 
-	tests.TestSessionStorage(t, s3.NewSessionStorage(db, "testsession", "session"))
+	storagetest.TestSessionStorage(t, s3.NewSessionStorage(db, "testsession", "session"))
 }
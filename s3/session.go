@@ -34,12 +34,25 @@ func (s SessionStorage) LoadSession(ctx context.Context) ([]byte, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "get %q/%q", s.bucketName, s.objectName)
 	}
-	return io.ReadAll(obj)
+	defer func() {
+		_ = obj.Close()
+	}()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case minio.NoSuchKey, minio.NoSuchBucket:
+			return nil, session.ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "read %q/%q", s.bucketName, s.objectName)
+	}
+	return data, nil
 }
 
 // StoreSession implements session.Storage.
 func (s SessionStorage) StoreSession(ctx context.Context, data []byte) error {
-	if err := s.client.MakeBucket(ctx, s.bucketName, minio.MakeBucketOptions{}); err != nil {
+	if err := s.client.MakeBucket(ctx, s.bucketName, minio.MakeBucketOptions{}); err != nil &&
+		minio.ToErrorResponse(err).Code != minio.BucketAlreadyOwnedByYou {
 		return errors.Wrapf(err, "create bucket %q", s.bucketName)
 	}
 
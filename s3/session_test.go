@@ -0,0 +1,107 @@
+package s3_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/session"
+
+	"github.com/gotd/contrib/s3"
+)
+
+// fakeS3 is a minimal in-memory S3 server, enough for SessionStorage.
+type fakeS3 struct {
+	mux     sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+func (f *fakeS3) fail(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	bucketName, objectName, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	bucket, ok := f.buckets[bucketName]
+	switch {
+	case r.Method == http.MethodPut && objectName == "":
+		if ok {
+			f.fail(w, http.StatusConflict, minio.BucketAlreadyOwnedByYou)
+			return
+		}
+		f.buckets[bucketName] = map[string][]byte{}
+	case !ok:
+		f.fail(w, http.StatusNotFound, minio.NoSuchBucket)
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			f.fail(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		bucket[objectName] = data
+	case r.Method == http.MethodGet:
+		data, ok := bucket[objectName]
+		if !ok {
+			f.fail(w, http.StatusNotFound, minio.NoSuchKey)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		_, _ = w.Write(data)
+	default:
+		f.fail(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func newClient(t *testing.T) *minio.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(&fakeS3{buckets: map[string]map[string][]byte{}})
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4("", "", ""),
+		Region: "us-east-1",
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func TestSessionStorage(t *testing.T) {
+	ctx := t.Context()
+	a := require.New(t)
+	client := newClient(t)
+
+	_, err := s3.NewSessionStorage(client, "missing", "session").LoadSession(ctx)
+	a.ErrorIs(err, session.ErrNotFound, "missing bucket")
+
+	s := s3.NewSessionStorage(client, "bucket", "session")
+	a.NoError(s.StoreSession(ctx, []byte("first")))
+
+	_, err = s3.NewSessionStorage(client, "bucket", "other").LoadSession(ctx)
+	a.ErrorIs(err, session.ErrNotFound, "missing object")
+
+	// Bucket already exists.
+	a.NoError(s.StoreSession(ctx, []byte("second")))
+
+	data, err := s.LoadSession(ctx)
+	a.NoError(err)
+	a.Equal([]byte("second"), data)
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/go-faster/errors"
+
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+)
+
+type accessHasher struct {
+	storage PeerStorage
+}
+
+// AccessHasher creates updates.ChannelAccessHasher over given PeerStorage.
+//
+// Channel access hashes are read from and written to channel peers of the storage,
+// so hashes collected by UpdateHook or PeerCollector are not stored twice.
+//
+// Note that PeerStorage is not keyed by user ID, so given storage must belong to
+// a single account.
+func AccessHasher(storage PeerStorage) updates.ChannelAccessHasher {
+	return accessHasher{storage: storage}
+}
+
+// SetChannelAccessHash implements updates.ChannelAccessHasher.
+func (h accessHasher) SetChannelAccessHash(ctx context.Context, userID, channelID, accessHash int64) error {
+	key := PeerKey{Kind: dialogs.Channel, ID: channelID}
+
+	p, err := h.storage.Find(ctx, key)
+	switch {
+	case errors.Is(err, ErrPeerNotFound):
+		if err := p.FromInputPeer(&tg.InputPeerChannel{
+			ChannelID:  channelID,
+			AccessHash: accessHash,
+		}); err != nil {
+			return errors.Wrap(err, "create peer")
+		}
+	case err != nil:
+		return errors.Wrap(err, "find")
+	case p.Key.AccessHash == accessHash:
+		return nil
+	default:
+		p.Key.AccessHash = accessHash
+		if p.Channel != nil {
+			c := *p.Channel
+			c.AccessHash = accessHash
+			p.Channel = &c
+		}
+	}
+
+	if err := h.storage.Add(ctx, p); err != nil {
+		return errors.Wrap(err, "add")
+	}
+	return nil
+}
+
+// GetChannelAccessHash implements updates.ChannelAccessHasher.
+func (h accessHasher) GetChannelAccessHash(ctx context.Context, userID, channelID int64) (accessHash int64, found bool, err error) {
+	p, err := h.storage.Find(ctx, PeerKey{Kind: dialogs.Channel, ID: channelID})
+	if err != nil {
+		if errors.Is(err, ErrPeerNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, errors.Wrap(err, "find")
+	}
+	return p.Key.AccessHash, true, nil
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessHasher(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	mem := newMemStorage()
+	h := AccessHasher(mem)
+
+	_, found, err := h.GetChannelAccessHash(ctx, 1, 20)
+	a.NoError(err)
+	a.False(found)
+
+	// Hash of collected channel is reused.
+	var p Peer
+	a.True(p.FromChat(testChannel()))
+	a.NoError(mem.Add(ctx, p))
+
+	hash, found, err := h.GetChannelAccessHash(ctx, 1, 20)
+	a.NoError(err)
+	a.True(found)
+	a.Equal(int64(20), hash)
+
+	// Updated hash is written to the channel peer.
+	a.NoError(h.SetChannelAccessHash(ctx, 1, 20, 30))
+	hash, _, err = h.GetChannelAccessHash(ctx, 1, 20)
+	a.NoError(err)
+	a.Equal(int64(30), hash)
+
+	p, err = mem.Resolve(ctx, testChannel().Username)
+	a.NoError(err)
+	a.Equal(int64(30), p.Channel.AccessHash)
+
+	// Unknown channel is added.
+	a.NoError(h.SetChannelAccessHash(ctx, 1, 40, 50))
+	hash, found, err = h.GetChannelAccessHash(ctx, 1, 40)
+	a.NoError(err)
+	a.True(found)
+	a.Equal(int64(50), hash)
+}
@@ -0,0 +1,15 @@
+// Package storagetest contains conformance test suites for storage implementations.
+//
+// Every suite expects a fresh (empty) storage, because it checks behavior of
+// missing values.
+//
+// Example:
+//
+//	func TestStorage(t *testing.T) {
+//		db := openDB(t)
+//
+//		storagetest.TestSessionStorage(t, NewSessionStorage(db))
+//		storagetest.TestPeerStorage(t, NewPeerStorage(db))
+//		storagetest.TestStateStorage(t, NewStateStorage(db))
+//	}
+package storagetest
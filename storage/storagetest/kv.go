@@ -0,0 +1,135 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/contrib/auth"
+	"github.com/gotd/contrib/auth/kv"
+)
+
+// Credentials is a KV credential storage abstraction.
+type Credentials interface {
+	auth.Credentials
+	SavePhone(ctx context.Context, phone string) error
+	SavePassword(ctx context.Context, password string) error
+}
+
+// TestCredentials runs conformance tests for given credentials storage implementation.
+func TestCredentials(t *testing.T, cred Credentials) {
+	ctx := testContext(t)
+
+	t.Run("Credentials", func(t *testing.T) {
+		a := require.New(t)
+
+		phone, password := "phone", "password"
+		a.NoError(cred.SavePhone(ctx, phone))
+		a.NoError(cred.SavePassword(ctx, password))
+
+		gotPhone, err := cred.Phone(ctx)
+		a.NoError(err)
+		a.Equal(phone, gotPhone)
+
+		gotPassword, err := cred.Password(ctx)
+		a.NoError(err)
+		a.Equal(password, gotPassword)
+	})
+}
+
+// TestKV runs conformance tests for given kv.Storage implementation.
+//
+// If storage implements kv.Lister, listing is tested too.
+func TestKV(t *testing.T, s kv.Storage) {
+	ctx := testContext(t)
+
+	t.Run("KV", func(t *testing.T) {
+		t.Run("NotFound", func(t *testing.T) {
+			_, err := s.Get(ctx, "storagetest_missing")
+			require.ErrorIs(t, err, kv.ErrKeyNotFound)
+		})
+		t.Run("SetGet", func(t *testing.T) {
+			a := require.New(t)
+
+			for k, v := range map[string]string{
+				"storagetest_ascii":   "value",
+				"storagetest_unicode": "значение",
+				"storagetest_json":    `{"key":"value"}`,
+			} {
+				a.NoError(s.Set(ctx, k, v))
+				got, err := s.Get(ctx, k)
+				a.NoError(err)
+				a.Equal(v, got)
+			}
+		})
+		t.Run("Overwrite", func(t *testing.T) {
+			a := require.New(t)
+
+			a.NoError(s.Set(ctx, "storagetest_overwrite", "old"))
+			a.NoError(s.Set(ctx, "storagetest_overwrite", "new"))
+			got, err := s.Get(ctx, "storagetest_overwrite")
+			a.NoError(err)
+			a.Equal("new", got)
+		})
+		t.Run("Concurrent", func(t *testing.T) {
+			a := require.New(t)
+
+			key := func(i int) string { return fmt.Sprintf("storagetest_concurrent_%d", i) }
+			runConcurrently(t, func(i int) error {
+				return s.Set(ctx, key(i), fmt.Sprint(i))
+			})
+			for i := 0; i < concurrency; i++ {
+				got, err := s.Get(ctx, key(i))
+				a.NoError(err)
+				a.Equal(fmt.Sprint(i), got)
+			}
+		})
+		t.Run("Canceled", func(t *testing.T) {
+			a := require.New(t)
+
+			a.NoError(s.Set(ctx, "storagetest_canceled", "value"))
+			noHang(t, func() {
+				_ = s.Set(canceledContext(), "storagetest_canceled", "canceled")
+				_, _ = s.Get(canceledContext(), "storagetest_canceled")
+			})
+
+			// Write is either applied or not.
+			got, err := s.Get(ctx, "storagetest_canceled")
+			a.NoError(err)
+			a.Contains([]string{"value", "canceled"}, got)
+		})
+
+		lister, ok := s.(kv.Lister)
+		if !ok {
+			return
+		}
+		t.Run("Lister", func(t *testing.T) {
+			a := require.New(t)
+
+			values := map[string]string{
+				"storagetest_list_1": "1",
+				"storagetest_list_2": "2",
+				"storagetest_list_3": "3",
+			}
+			for k, v := range values {
+				a.NoError(s.Set(ctx, k, v))
+			}
+			a.NoError(s.Set(ctx, "storagetest_lis", "not listed"))
+
+			got := map[string]string{}
+			a.NoError(lister.Iterate(ctx, "storagetest_list_", func(k, v string) error {
+				got[k] = v
+				return nil
+			}))
+			a.Equal(values, got)
+
+			testErr := errors.New("test error")
+			a.ErrorIs(lister.Iterate(ctx, "storagetest_list_", func(k, v string) error {
+				return testErr
+			}), testErr)
+		})
+	})
+}
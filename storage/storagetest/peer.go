@@ -0,0 +1,218 @@
+package storagetest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/tg"
+
+	"github.com/gotd/contrib/storage"
+)
+
+func userPeer(t *testing.T, id int64, username string) storage.Peer {
+	var p storage.Peer
+	require.True(t, p.FromUser(&tg.User{
+		ID:         id,
+		AccessHash: id * 10,
+		FirstName:  fmt.Sprintf("User %d", id),
+		Username:   username,
+	}))
+	return p
+}
+
+func requirePeer(t *testing.T, expected, got storage.Peer) {
+	t.Helper()
+
+	a := require.New(t)
+	a.Equal(expected.Key, got.Key)
+	a.Equal(expected.Version, got.Version)
+	if expected.User != nil {
+		a.NotNil(got.User)
+		a.Equal(expected.User.ID, got.User.ID)
+		a.Equal(expected.User.Username, got.User.Username)
+		a.Equal(expected.User.FirstName, got.User.FirstName)
+	}
+}
+
+// TestPeerStorage runs conformance tests for given peer storage implementation.
+func TestPeerStorage(t *testing.T, st storage.PeerStorage) {
+	ctx := testContext(t)
+
+	t.Run("PeerStorage", func(t *testing.T) {
+		// Valid peers added by subtests, used to check iteration.
+		added := map[storage.PeerKey]storage.Peer{}
+
+		t.Run("NotFound", func(t *testing.T) {
+			a := require.New(t)
+
+			_, err := st.Resolve(ctx, "storagetest_missing")
+			a.ErrorIs(err, storage.ErrPeerNotFound)
+			_, err = st.Find(ctx, storage.KeyFromPeer(userPeer(t, 1, "")))
+			a.ErrorIs(err, storage.ErrPeerNotFound)
+		})
+		t.Run("AddFind", func(t *testing.T) {
+			a := require.New(t)
+
+			var p storage.Peer
+			a.NoError(p.FromInputPeer(&tg.InputPeerUser{
+				UserID:     10,
+				AccessHash: 10,
+			}))
+			a.NoError(st.Add(ctx, p))
+			added[storage.KeyFromPeer(p)] = p
+
+			got, err := st.Find(ctx, storage.KeyFromPeer(p))
+			a.NoError(err)
+			requirePeer(t, p, got)
+
+			// Associated keys of peer are resolvable.
+			p = userPeer(t, 11, "storagetest_user")
+			a.NoError(st.Add(ctx, p))
+			added[storage.KeyFromPeer(p)] = p
+
+			got, err = st.Resolve(ctx, "storagetest_user")
+			a.NoError(err)
+			requirePeer(t, p, got)
+		})
+		t.Run("Update", func(t *testing.T) {
+			a := require.New(t)
+
+			p := userPeer(t, 12, "")
+			a.NoError(st.Add(ctx, p))
+			p.User.FirstName = "Updated"
+			a.NoError(st.Add(ctx, p))
+			added[storage.KeyFromPeer(p)] = p
+
+			got, err := st.Find(ctx, storage.KeyFromPeer(p))
+			a.NoError(err)
+			requirePeer(t, p, got)
+		})
+		t.Run("AssignResolve", func(t *testing.T) {
+			a := require.New(t)
+
+			p := userPeer(t, 13, "")
+			a.NoError(st.Assign(ctx, "storagetest_assigned", p))
+			added[storage.KeyFromPeer(p)] = p
+
+			got, err := st.Resolve(ctx, "storagetest_assigned")
+			a.NoError(err)
+			requirePeer(t, p, got)
+
+			// Assign also adds peer itself.
+			got, err = st.Find(ctx, storage.KeyFromPeer(p))
+			a.NoError(err)
+			requirePeer(t, p, got)
+
+			// Key can be re-assigned to another peer.
+			other := userPeer(t, 14, "")
+			a.NoError(st.Assign(ctx, "storagetest_assigned", other))
+			added[storage.KeyFromPeer(other)] = other
+
+			got, err = st.Resolve(ctx, "storagetest_assigned")
+			a.NoError(err)
+			requirePeer(t, other, got)
+		})
+		t.Run("Invalidation", func(t *testing.T) {
+			a := require.New(t)
+
+			// Peers persisted by older versions must be treated as cache miss.
+			p := userPeer(t, 15, "storagetest_outdated")
+			p.Version = storage.LatestVersion - 1
+			a.NoError(st.Assign(ctx, "storagetest_outdated_key", p))
+
+			_, err := st.Find(ctx, storage.KeyFromPeer(p))
+			a.ErrorIs(err, storage.ErrPeerNotFound)
+			_, err = st.Resolve(ctx, "storagetest_outdated")
+			a.ErrorIs(err, storage.ErrPeerNotFound)
+			_, err = st.Resolve(ctx, "storagetest_outdated_key")
+			a.ErrorIs(err, storage.ErrPeerNotFound)
+
+			// Re-adding latest version replaces outdated peer.
+			p = userPeer(t, 16, "")
+			p.Version = storage.LatestVersion - 1
+			a.NoError(st.Add(ctx, p))
+			p.Version = storage.LatestVersion
+			a.NoError(st.Add(ctx, p))
+			added[storage.KeyFromPeer(p)] = p
+
+			got, err := st.Find(ctx, storage.KeyFromPeer(p))
+			a.NoError(err)
+			requirePeer(t, p, got)
+		})
+		t.Run("Concurrent", func(t *testing.T) {
+			a := require.New(t)
+
+			peers := make([]storage.Peer, concurrency)
+			for i := range peers {
+				peers[i] = userPeer(t, int64(100+i), fmt.Sprintf("storagetest_concurrent_%d", i))
+				added[storage.KeyFromPeer(peers[i])] = peers[i]
+			}
+			runConcurrently(t, func(i int) error {
+				return st.Add(ctx, peers[i])
+			})
+
+			for i, p := range peers {
+				got, err := st.Find(ctx, storage.KeyFromPeer(p))
+				a.NoError(err)
+				requirePeer(t, p, got)
+
+				got, err = st.Resolve(ctx, fmt.Sprintf("storagetest_concurrent_%d", i))
+				a.NoError(err)
+				requirePeer(t, p, got)
+			}
+		})
+		t.Run("Iterate", func(t *testing.T) {
+			a := require.New(t)
+
+			iter, err := st.Iterate(ctx)
+			a.NoError(err)
+			defer func() {
+				a.NoError(iter.Close())
+			}()
+
+			// Iterator must yield every valid peer exactly once, skipping
+			// associated keys and outdated peers.
+			got := map[storage.PeerKey]storage.Peer{}
+			for iter.Next(ctx) {
+				p := iter.Value()
+				key := storage.KeyFromPeer(p)
+				a.NotContains(got, key, "peer %s yielded twice", key)
+				got[key] = p
+			}
+			a.NoError(iter.Err())
+
+			a.Len(got, len(added))
+			for key, p := range added {
+				a.Contains(got, key)
+				requirePeer(t, p, got[key])
+			}
+		})
+		t.Run("Canceled", func(t *testing.T) {
+			a := require.New(t)
+
+			p := userPeer(t, 17, "storagetest_canceled")
+			noHang(t, func() {
+				ctx := canceledContext()
+				_ = st.Add(ctx, p)
+				_ = st.Assign(ctx, "storagetest_canceled_key", p)
+				_, _ = st.Find(ctx, storage.KeyFromPeer(p))
+				_, _ = st.Resolve(ctx, "storagetest_canceled")
+
+				if iter, err := st.Iterate(ctx); err == nil {
+					for iter.Next(ctx) {
+						_ = iter.Value()
+					}
+					_ = iter.Close()
+				}
+			})
+
+			// Storage must remain usable.
+			a.NoError(st.Add(ctx, p))
+			got, err := st.Find(ctx, storage.KeyFromPeer(p))
+			a.NoError(err)
+			requirePeer(t, p, got)
+		})
+	})
+}
@@ -0,0 +1,81 @@
+package storagetest
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/session"
+)
+
+// TestSessionStorage runs conformance tests for given session storage implementation.
+func TestSessionStorage(t *testing.T, s session.Storage) {
+	ctx := testContext(t)
+
+	t.Run("Session", func(t *testing.T) {
+		t.Run("NotFound", func(t *testing.T) {
+			_, err := s.LoadSession(ctx)
+			require.ErrorIs(t, err, session.ErrNotFound)
+		})
+		t.Run("StoreLoad", func(t *testing.T) {
+			a := require.New(t)
+
+			data := []byte(`{"Version":1,"Data":{"DC":2}}`)
+			a.NoError(s.StoreSession(ctx, data))
+
+			got, err := s.LoadSession(ctx)
+			a.NoError(err)
+			a.Equal(data, got)
+		})
+		t.Run("Overwrite", func(t *testing.T) {
+			a := require.New(t)
+
+			data := []byte(`{"Version":1,"Data":{"DC":4}}`)
+			a.NoError(s.StoreSession(ctx, data))
+
+			got, err := s.LoadSession(ctx)
+			a.NoError(err)
+			a.Equal(data, got)
+		})
+		t.Run("Concurrent", func(t *testing.T) {
+			a := require.New(t)
+
+			sessions := make([][]byte, concurrency)
+			for i := range sessions {
+				sessions[i] = []byte(fmt.Sprintf(`{"Version":1,"Data":{"DC":%d}}`, i))
+			}
+			runConcurrently(t, func(i int) error {
+				return s.StoreSession(ctx, sessions[i])
+			})
+
+			// Storage must contain one of stored sessions, not a mix of them.
+			got, err := s.LoadSession(ctx)
+			a.NoError(err)
+			var found bool
+			for _, data := range sessions {
+				if bytes.Equal(data, got) {
+					found = true
+					break
+				}
+			}
+			a.True(found, "unexpected session %q", got)
+		})
+		t.Run("Canceled", func(t *testing.T) {
+			a := require.New(t)
+
+			data := []byte(`{"Version":1,"Data":{"DC":5}}`)
+			a.NoError(s.StoreSession(ctx, data))
+
+			noHang(t, func() {
+				_ = s.StoreSession(canceledContext(), []byte(`{"Version":1,"Data":{"DC":1}}`))
+				_, _ = s.LoadSession(canceledContext())
+			})
+
+			// Storage must remain usable.
+			_, err := s.LoadSession(ctx)
+			a.NoError(err)
+		})
+	})
+}
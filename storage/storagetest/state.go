@@ -0,0 +1,217 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+// TestStateStorage runs conformance tests for given updates state storage implementation.
+func TestStateStorage(t *testing.T, st updates.StateStorage) {
+	ctx := testContext(t)
+
+	t.Run("StateStorage", func(t *testing.T) {
+		const (
+			userID      = 10
+			otherUserID = 11
+		)
+
+		t.Run("NotFound", func(t *testing.T) {
+			a := require.New(t)
+
+			_, found, err := st.GetState(ctx, userID)
+			a.NoError(err)
+			a.False(found)
+
+			// Setters must fail if state does not exist.
+			a.Error(st.SetPts(ctx, userID, 1), "state not found expected")
+			a.Error(st.SetQts(ctx, userID, 1), "state not found expected")
+			a.Error(st.SetDate(ctx, userID, 1), "state not found expected")
+			a.Error(st.SetSeq(ctx, userID, 1), "state not found expected")
+			a.Error(st.SetDateSeq(ctx, userID, 1, 1), "state not found expected")
+
+			_, found, err = st.GetState(ctx, userID)
+			a.NoError(err)
+			a.False(found, "failed setter must not create state")
+		})
+		t.Run("State", func(t *testing.T) {
+			a := require.New(t)
+
+			state := updates.State{Pts: 1, Qts: 2, Date: 3, Seq: 4}
+			a.NoError(st.SetState(ctx, userID, state))
+			got, found, err := st.GetState(ctx, userID)
+			a.NoError(err)
+			a.True(found)
+			a.Equal(state, got)
+
+			a.NoError(st.SetPts(ctx, userID, 10))
+			a.NoError(st.SetQts(ctx, userID, 20))
+			a.NoError(st.SetDate(ctx, userID, 30))
+			a.NoError(st.SetSeq(ctx, userID, 40))
+			got, _, err = st.GetState(ctx, userID)
+			a.NoError(err)
+			a.Equal(updates.State{Pts: 10, Qts: 20, Date: 30, Seq: 40}, got)
+
+			a.NoError(st.SetDateSeq(ctx, userID, 50, 60))
+			got, _, err = st.GetState(ctx, userID)
+			a.NoError(err)
+			a.Equal(updates.State{Pts: 10, Qts: 20, Date: 50, Seq: 60}, got)
+
+			// State of other user is independent.
+			_, found, err = st.GetState(ctx, otherUserID)
+			a.NoError(err)
+			a.False(found)
+		})
+		t.Run("Channels", func(t *testing.T) {
+			a := require.New(t)
+
+			_, found, err := st.GetChannelPts(ctx, userID, 1)
+			a.NoError(err)
+			a.False(found)
+
+			channels := map[int64]int{1: 100, 2: 200, 3: 300}
+			for id, pts := range channels {
+				a.NoError(st.SetChannelPts(ctx, userID, id, pts))
+			}
+			a.NoError(st.SetChannelPts(ctx, otherUserID, 4, 400))
+
+			pts, found, err := st.GetChannelPts(ctx, userID, 2)
+			a.NoError(err)
+			a.True(found)
+			a.Equal(200, pts)
+
+			a.NoError(st.SetChannelPts(ctx, userID, 2, 250))
+			channels[2] = 250
+
+			got := map[int64]int{}
+			a.NoError(st.ForEachChannels(ctx, userID, func(ctx context.Context, channelID int64, pts int) error {
+				got[channelID] = pts
+				return nil
+			}))
+			a.Equal(channels, got)
+
+			testErr := errors.New("test error")
+			a.ErrorIs(st.ForEachChannels(ctx, userID, func(ctx context.Context, channelID int64, pts int) error {
+				return testErr
+			}), testErr)
+		})
+		t.Run("Concurrent", func(t *testing.T) {
+			a := require.New(t)
+			const concurrentUserID = 12
+
+			a.NoError(st.SetState(ctx, concurrentUserID, updates.State{}))
+			runConcurrently(t, func(i int) error {
+				if err := st.SetChannelPts(ctx, concurrentUserID, int64(i+1), i); err != nil {
+					return err
+				}
+				return st.SetPts(ctx, concurrentUserID, i)
+			})
+
+			got := map[int64]int{}
+			a.NoError(st.ForEachChannels(ctx, concurrentUserID, func(ctx context.Context, channelID int64, pts int) error {
+				got[channelID] = pts
+				return nil
+			}))
+			a.Len(got, concurrency)
+			for i := 0; i < concurrency; i++ {
+				a.Equal(i, got[int64(i+1)])
+			}
+
+			state, found, err := st.GetState(ctx, concurrentUserID)
+			a.NoError(err)
+			a.True(found)
+			a.GreaterOrEqual(state.Pts, 0)
+			a.Less(state.Pts, concurrency)
+		})
+		t.Run("Canceled", func(t *testing.T) {
+			a := require.New(t)
+			const canceledUserID = 13
+
+			initial := updates.State{Pts: 1, Qts: 1, Date: 1, Seq: 1}
+			a.NoError(st.SetState(ctx, canceledUserID, initial))
+			next := updates.State{Pts: 2, Qts: 2, Date: 2, Seq: 2}
+			noHang(t, func() {
+				ctx := canceledContext()
+				_ = st.SetState(ctx, canceledUserID, next)
+				_ = st.SetChannelPts(ctx, canceledUserID, 1, 1)
+				_, _, _ = st.GetState(ctx, canceledUserID)
+				_ = st.ForEachChannels(ctx, canceledUserID, func(ctx context.Context, channelID int64, pts int) error {
+					return nil
+				})
+			})
+
+			// Storage must remain usable, and state is either updated or not.
+			got, found, err := st.GetState(ctx, canceledUserID)
+			a.NoError(err)
+			a.True(found)
+			a.Contains([]updates.State{initial, next}, got)
+		})
+	})
+}
+
+// TestAccessHasher runs conformance tests for given channel access hash storage implementation.
+func TestAccessHasher(t *testing.T, h updates.ChannelAccessHasher) {
+	ctx := testContext(t)
+
+	t.Run("AccessHasher", func(t *testing.T) {
+		const (
+			userID      = 10
+			otherUserID = 11
+			channelID   = 1
+		)
+
+		t.Run("Hash", func(t *testing.T) {
+			a := require.New(t)
+
+			_, found, err := h.GetChannelAccessHash(ctx, userID, channelID)
+			a.NoError(err)
+			a.False(found)
+
+			a.NoError(h.SetChannelAccessHash(ctx, userID, channelID, -100))
+			hash, found, err := h.GetChannelAccessHash(ctx, userID, channelID)
+			a.NoError(err)
+			a.True(found)
+			a.Equal(int64(-100), hash)
+
+			a.NoError(h.SetChannelAccessHash(ctx, userID, channelID, 200))
+			hash, _, err = h.GetChannelAccessHash(ctx, userID, channelID)
+			a.NoError(err)
+			a.Equal(int64(200), hash)
+
+			_, found, err = h.GetChannelAccessHash(ctx, otherUserID, channelID)
+			a.NoError(err)
+			a.False(found)
+		})
+		t.Run("Concurrent", func(t *testing.T) {
+			a := require.New(t)
+
+			runConcurrently(t, func(i int) error {
+				return h.SetChannelAccessHash(ctx, userID, int64(100+i), int64(i))
+			})
+			for i := 0; i < concurrency; i++ {
+				hash, found, err := h.GetChannelAccessHash(ctx, userID, int64(100+i))
+				a.NoError(err)
+				a.True(found)
+				a.Equal(int64(i), hash)
+			}
+		})
+		t.Run("Canceled", func(t *testing.T) {
+			a := require.New(t)
+
+			noHang(t, func() {
+				ctx := canceledContext()
+				_ = h.SetChannelAccessHash(ctx, userID, channelID, 300)
+				_, _, _ = h.GetChannelAccessHash(ctx, userID, channelID)
+			})
+
+			// Storage must remain usable.
+			_, found, err := h.GetChannelAccessHash(ctx, userID, channelID)
+			a.NoError(err)
+			a.True(found)
+		})
+	})
+}
@@ -0,0 +1,65 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// suiteTimeout is a timeout of whole suite.
+	suiteTimeout = time.Minute
+	// concurrency is a number of goroutines used in concurrency tests.
+	concurrency = 16
+)
+
+// testContext returns context for suite.
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), suiteTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// canceledContext returns already canceled context.
+func canceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+// noHang ensures that f returns in suiteTimeout.
+//
+// Storage may ignore context cancellation, but it must not block on it.
+func noHang(t *testing.T, f func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(suiteTimeout):
+		require.FailNow(t, "operation with canceled context hangs")
+	}
+}
+
+// runConcurrently calls f concurrently with given goroutine indexes and waits
+// for all calls.
+func runConcurrently(t *testing.T, f func(i int) error) {
+	t.Helper()
+
+	errs := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func(i int) {
+			errs <- f(i)
+		}(i)
+	}
+	for i := 0; i < concurrency; i++ {
+		require.NoError(t, <-errs)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/hashicorp/vault/api"
 
 	"github.com/gotd/contrib/internal/tests"
+	"github.com/gotd/contrib/storage/storagetest"
 	"github.com/gotd/contrib/vault"
 )
 
@@ -43,6 +44,6 @@ func TestE2E(t *testing.T) {
 		return err
 	})
 
-	tests.TestSessionStorage(t, vault.NewSessionStorage(client, "cubbyhole/testsession", "session"))
-	tests.TestCredentials(t, vault.NewCredentials(client, "cubbyhole/testauth"))
+	storagetest.TestSessionStorage(t, vault.NewSessionStorage(client, "cubbyhole/testsession", "session"))
+	storagetest.TestCredentials(t, vault.NewCredentials(client, "cubbyhole/testauth"))
 }